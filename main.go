@@ -14,7 +14,9 @@ import (
 	"image/jpeg"
 	"image/png"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/tjboldt/ProDOS-Utilities/prodos"
 )
@@ -24,6 +26,7 @@ const version = "0.6.0"
 func main() {
 	var fileName string
 	var pathName string
+	var newPathName string
 	var command string
 	var outFileName string
 	var inFileName string
@@ -32,19 +35,32 @@ func main() {
 	var volumeName string
 	var fileType uint
 	var auxType uint
-	flag.StringVar(&fileName, "d", "", "A ProDOS format drive image")
+	var recursive bool
+	var force bool
+	var comment string
+	var creator string
+	var exportFormat string
+	var convertFiles bool
+	flag.StringVar(&fileName, "d", "", "A ProDOS format drive image (.po, .do, .dsk, .2mg, .2img or read-only .woz)")
 	flag.StringVar(&pathName, "p", "", "Path name in ProDOS drive image (default is root of volume)")
-	flag.StringVar(&command, "c", "ls", "Command to execute: ls, create, rm, mkdir, get, getraw, put, putall, putallrecursive, readblock, writeblock")
-	flag.StringVar(&outFileName, "o", "", "Name of file to write")
-	flag.StringVar(&inFileName, "i", "", "Name of file to read")
-	flag.UintVar(&volumeSize, "s", 65535, "Number of blocks to create the volume with (default 65535, 64 to 65535, 0x0040 to 0xFFFF hex input accepted)")
+	flag.StringVar(&newPathName, "n", "", "New path name or destination directory in ProDOS drive image for mv, destination path for cp, new file name for undelete")
+	flag.StringVar(&command, "c", "ls", "Command to execute: ls, create, convert, rm, mv, cp, mkdir, rmdir, get, getraw, getall, getallrecursive, put, putall, putallrecursive, putshk, unsdk, shk, verify, repair, revert, lsdeleted, undelete, defrag, resize, chtype, lock, unlock, touch, readblock, writeblock")
+	flag.StringVar(&outFileName, "o", "", "Name of file to write (or drive image to convert to with convert, host directory for getall, block backup for repair, .bny wraps get output in Binary II)")
+	flag.StringVar(&inFileName, "i", "", "Name of file to read (or drive image to convert from with convert, drive image to copy from with cp, block backup for revert)")
+	flag.UintVar(&volumeSize, "s", 65535, "Number of blocks to create or resize the volume with (default 65535, 64 to 65535, 0x0040 to 0xFFFF hex input accepted)")
 	flag.StringVar(&volumeName, "v", "NO.NAME", "Specifiy a name for the volume from 1 to 15 characters")
-	flag.UintVar(&blockNumber, "b", 0, "A block number to read/write from 0 to 65535 (0x0000 to 0xFFFF hex input accepted)")
-	flag.UintVar(&fileType, "t", 0, "ProDOS FileType: 0x04 for TXT, 0x06 for BIN, 0xFC for BAS, 0xFF for SYS etc., omit to autodetect")
-	flag.UintVar(&auxType, "a", 0, "ProDOS AuxType from 0 to 65535 (0x0000 to 0xFFFF hex input accepted), omit to autodetect")
+	flag.UintVar(&blockNumber, "b", 0, "A block number to read/write from 0 to 65535 (0x0000 to 0xFFFF hex input accepted), entry number from lsdeleted for undelete")
+	flag.UintVar(&fileType, "t", 0, "ProDOS FileType: 0x04 for TXT, 0x06 for BIN, 0xFC for BAS, 0xFF for SYS etc., omit to autodetect, new type for chtype")
+	flag.UintVar(&auxType, "a", 0, "ProDOS AuxType from 0 to 65535 (0x0000 to 0xFFFF hex input accepted), omit to autodetect, new aux type for chtype")
+	flag.BoolVar(&recursive, "r", false, "Recursively delete files and subdirectories with rmdir, move subdirectories as well as files with defrag")
+	flag.BoolVar(&force, "f", false, "Force put and putall to replace existing files keeping their creation time and access, cp to replace existing files")
+	flag.StringVar(&comment, "m", "", "Comment to store in the header when creating a .2mg/.2img drive image")
+	flag.StringVar(&creator, "k", "PDOU", "Four character creator code to store when creating a .2mg/.2img drive image")
+	flag.StringVar(&exportFormat, "x", "", "Export format for get to keep forks and attributes: applesingle or appledouble (writes ._NAME beside the file), getall also accepts type (default, NAME#06a000) and plain")
+	flag.BoolVar(&convertFiles, "e", false, "Convert Applesoft BASIC to .bas, text to .txt and hi-res images to .png with getall and getallrecursive")
 	flag.Parse()
 
-	if len(fileName) == 0 {
+	if len(fileName) == 0 && command != "convert" {
 		printReadme()
 		flag.PrintDefaults()
 		os.Exit(1)
@@ -54,25 +70,65 @@ func main() {
 	case "ls":
 		ls(fileName, pathName)
 	case "get":
-		get(fileName, pathName, outFileName)
+		get(fileName, pathName, outFileName, exportFormat)
 	case "getraw":
 		getRaw(fileName, pathName)
+	case "getall":
+		getall(fileName, pathName, outFileName, false, exportFormat, convertFiles)
+	case "getallrecursive":
+		getall(fileName, pathName, outFileName, true, exportFormat, convertFiles)
 	case "put":
-		put(fileName, pathName, uint8(fileType), uint16(auxType), inFileName)
+		put(fileName, pathName, uint8(fileType), uint16(auxType), inFileName, force)
 	case "readblock":
 		readBlock(uint16(blockNumber), fileName)
 	case "writeblock":
 		writeBlock(uint16(blockNumber), fileName, inFileName)
 	case "create":
-		create(fileName, volumeName, uint16(volumeSize))
+		create(fileName, volumeName, uint16(volumeSize), comment, creator)
 	case "putall":
-		putall(fileName, inFileName, pathName, false)
+		putall(fileName, inFileName, pathName, false, force)
 	case "putallrecursive":
-		putall(fileName, inFileName, pathName, true)
+		putall(fileName, inFileName, pathName, true, force)
+	case "convert":
+		convert(inFileName, outFileName, comment, creator)
+	case "shk":
+		shk(fileName, pathName, outFileName)
+	case "unsdk":
+		unsdk(fileName, inFileName)
+	case "putshk":
+		putshk(fileName, inFileName, pathName, force)
+	case "verify":
+		verify(fileName)
+	case "lsdeleted":
+		lsdeleted(fileName, pathName)
+	case "undelete":
+		undelete(fileName, pathName, blockNumber, newPathName)
+	case "chtype":
+		chtype(fileName, pathName, uint8(fileType), uint16(auxType))
+	case "lock":
+		setAccess(fileName, pathName, true)
+	case "unlock":
+		setAccess(fileName, pathName, false)
+	case "touch":
+		touch(fileName, pathName)
+	case "resize":
+		resize(fileName, uint16(volumeSize))
+	case "defrag":
+		defrag(fileName, recursive)
+	case "repair":
+		repair(fileName, outFileName)
+	case "revert":
+		revert(fileName, inFileName)
 	case "rm":
 		rm(fileName, pathName)
+	case "mv":
+		mv(fileName, pathName, newPathName)
+	case "cp":
+		cp(fileName, inFileName, pathName, newPathName, force)
 	case "mkdir":
 		mkdir(fileName, pathName)
+	case "rmdir":
+		rmdir(fileName, pathName, recursive)
 	case "dumpfile":
 		dumpFile(fileName, pathName)
 	case "dumpdirectory":
@@ -86,13 +142,9 @@ func main() {
 
 func dumpFile(fileName string, pathName string) {
 	checkPathName(pathName)
-	file, err := os.OpenFile(fileName, os.O_RDONLY, 0755)
-	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
-		os.Exit(1)
-	}
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
 	defer file.Close()
-	fileEntry, err := prodos.GetFileEntry(file, pathName)
+	fileEntry, err := prodos.GetFileEntry(driveImage, pathName)
 	if err != nil {
 		fmt.Printf("Failed to path %s:\n  %s", pathName, err)
 		os.Exit(1)
@@ -102,13 +154,9 @@ func dumpFile(fileName string, pathName string) {
 
 func dumpDirectory(fileName string, pathName string) {
 	checkPathName(pathName)
-	file, err := os.OpenFile(fileName, os.O_RDONLY, 0755)
-	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
-		os.Exit(1)
-	}
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
 	defer file.Close()
-	_, directoryheader, _, err := prodos.ReadDirectory(file, pathName)
+	_, directoryheader, _, err := prodos.ReadDirectory(driveImage, pathName)
 	if err != nil {
 		fmt.Printf("Failed to read directory %s:\n  %s", pathName, err)
 		os.Exit(1)
@@ -118,83 +166,475 @@ func dumpDirectory(fileName string, pathName string) {
 
 func mkdir(fileName string, pathName string) {
 	checkPathName(pathName)
-	file, err := os.OpenFile(fileName, os.O_RDWR, 0755)
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	err := prodos.CreateDirectory(driveImage, pathName)
 	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
+		fmt.Printf("failed to create directory %s: %s\n", pathName, err)
 		os.Exit(1)
 	}
+}
+
+func verify(fileName string) {
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
 	defer file.Close()
-	err = prodos.CreateDirectory(file, pathName)
+	report, err := prodos.Verify(driveImage)
 	if err != nil {
-		fmt.Printf("failed to create directory %s: %s\n", pathName, err)
+		fmt.Printf("Failed to verify %s: %s\n", fileName, err)
+		os.Exit(1)
+	}
+	for _, problem := range report.Problems {
+		if len(problem.Path) > 0 {
+			fmt.Printf("%s: %s\n", problem.Path, problem.Message)
+		} else {
+			fmt.Printf("%s\n", problem.Message)
+		}
+	}
+	fmt.Printf("%d directories, %d files, %d of %d blocks used, %d problems found\n",
+		report.Directories, report.Files, report.UsedBlocks, report.TotalBlocks, len(report.Problems))
+	if report.HasProblems() {
+		os.Exit(1)
+	}
+}
+
+func lsdeleted(fileName string, pathName string) {
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
+	defer file.Close()
+	pathName = strings.ToUpper(pathName)
+	volumeHeader, _, _, err := prodos.ReadDirectory(driveImage, pathName)
+	if err != nil {
+		fmt.Printf("Failed to read directory %s: %s\n", pathName, err)
+		os.Exit(1)
+	}
+	if len(pathName) == 0 {
+		pathName = "/" + volumeHeader.VolumeName
+	}
+	deletedFiles, err := prodos.ListDeleted(driveImage, pathName)
+	if err != nil {
+		fmt.Printf("Failed to list deleted files in %s: %s\n", pathName, err)
+		os.Exit(1)
+	}
+	prodos.DumpDeletedFiles(pathName, deletedFiles)
+}
+
+func undelete(fileName string, pathName string, entryNumber uint, newPathName string) {
+	if len(newPathName) == 0 {
+		fmt.Printf("Missing new file name (use -n NEWNAME)\n")
+		os.Exit(1)
+	}
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	deletedFiles, err := prodos.ListDeleted(driveImage, pathName)
+	if err != nil {
+		fmt.Printf("Failed to list deleted files in %s: %s\n", pathName, err)
+		os.Exit(1)
+	}
+	if entryNumber >= uint(len(deletedFiles)) {
+		fmt.Printf("Invalid entry number %d, use lsdeleted to list deleted files\n", entryNumber)
+		os.Exit(1)
+	}
+	err = prodos.Undelete(driveImage, deletedFiles[entryNumber], newPathName)
+	if err != nil {
+		fmt.Printf("Failed to undelete %s: %s\n", newPathName, err)
+		os.Exit(1)
+	}
+}
+
+func chtype(fileName string, pathName string, fileType uint8, auxType uint16) {
+	checkPathName(pathName)
+	update := prodos.FileInfoUpdate{}
+	if flagPassed("t") {
+		update.FileType = &fileType
+	}
+	if flagPassed("a") {
+		update.AuxType = &auxType
+	}
+	if update.FileType == nil && update.AuxType == nil {
+		fmt.Printf("Missing file type or aux type (use -t TYPE and/or -a AUXTYPE)\n")
+		os.Exit(1)
+	}
+	setFileInfo(fileName, pathName, update)
+}
+
+func setAccess(fileName string, pathName string, locked bool) {
+	checkPathName(pathName)
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
+	fileEntry, err := prodos.GetFileEntry(driveImage, pathName)
+	file.Close()
+	if err != nil {
+		fmt.Printf("Failed to find %s: %s\n", pathName, err)
+		os.Exit(1)
+	}
+	access := fileEntry.Access | prodos.AccessDestroy | prodos.AccessRename | prodos.AccessWrite
+	if locked {
+		access = fileEntry.Access &^ (prodos.AccessDestroy | prodos.AccessRename | prodos.AccessWrite)
+	}
+	setFileInfo(fileName, pathName, prodos.FileInfoUpdate{Access: &access})
+}
+
+func touch(fileName string, pathName string) {
+	checkPathName(pathName)
+	modifiedTime := time.Now()
+	setFileInfo(fileName, pathName, prodos.FileInfoUpdate{ModifiedTime: &modifiedTime})
+}
+
+func setFileInfo(fileName string, pathName string, update prodos.FileInfoUpdate) {
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	err := prodos.SetFileInfo(driveImage, pathName, update)
+	if err != nil {
+		fmt.Printf("Failed to update %s: %s\n", pathName, err)
+		os.Exit(1)
+	}
+}
+
+// flagPassed returns true if a flag was given on the command line
+// rather than left at its default
+func flagPassed(name string) bool {
+	passed := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			passed = true
+		}
+	})
+	return passed
+}
+
+func resize(fileName string, volumeSize uint16) {
+	// the default size is for create so resize needs it to be given
+	if !flagPassed("s") {
+		fmt.Printf("Missing new volume size (use -s BLOCKS)\n")
+		os.Exit(1)
+	}
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	if driveImage != prodos.ReaderWriterAt(file) {
+		fmt.Printf("Resize only supports ProDOS order images, use convert to create a .po image first\n")
+		os.Exit(1)
+	}
+	err := prodos.ResizeVolume(driveImage, volumeSize)
+	if err != nil {
+		fmt.Printf("Failed to resize %s: %s\n", fileName, err)
+		os.Exit(1)
+	}
+	err = file.Truncate(int64(volumeSize) * 512)
+	if err != nil {
+		fmt.Printf("Failed to resize %s: %s\n", fileName, err)
+		os.Exit(1)
+	}
+}
+
+func defrag(fileName string, recursive bool) {
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	report, err := prodos.Defragment(driveImage, prodos.DefragmentOptions{Directories: recursive})
+	if err != nil {
+		fmt.Printf("Failed to defragment %s: %s\n", fileName, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d blocks moved, fragmentation %.1f%% before and %.1f%% after\n",
+		report.BlocksMoved, report.ScoreBefore, report.ScoreAfter)
+}
+
+func repair(fileName string, outFileName string) {
+	if len(outFileName) == 0 {
+		outFileName = fileName + ".repair"
+	}
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	// an earlier backup is never replaced as it may be the only way back
+	backupFile, err := os.OpenFile(outFileName, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		fmt.Printf("Failed to create block backup %s: %s\n", outFileName, err)
+		os.Exit(1)
+	}
+	defer backupFile.Close()
+	fixes, err := prodos.Repair(driveImage, backupFile)
+	for _, fix := range fixes {
+		fmt.Printf("%s\n", fix)
+	}
+	if err != nil {
+		fmt.Printf("Failed to repair %s: %s\n", fileName, err)
+		os.Exit(1)
+	}
+	fmt.Printf("%d fixes made, changed blocks backed up to %s\n", len(fixes), outFileName)
+}
+
+func revert(fileName string, inFileName string) {
+	if len(inFileName) == 0 {
+		fmt.Printf("Missing block backup file name (use -i FILENAME)\n")
+		os.Exit(1)
+	}
+	backupFile, err := os.Open(inFileName)
+	if err != nil {
+		fmt.Printf("Failed to open block backup %s: %s\n", inFileName, err)
+		os.Exit(1)
+	}
+	defer backupFile.Close()
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	err = prodos.RestoreBlockBackup(driveImage, backupFile)
+	if err != nil {
+		fmt.Printf("Failed to revert %s: %s\n", fileName, err)
 		os.Exit(1)
 	}
 }
 
 func rm(fileName string, pathName string) {
 	checkPathName(pathName)
-	file, err := os.OpenFile(fileName, os.O_RDWR, 0755)
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	err := prodos.DeleteFile(driveImage, pathName)
 	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
+		fmt.Printf("failed to delete file %s: %s\n", pathName, err)
+		os.Exit(1)
+	}
+}
+
+func mv(fileName string, pathName string, newPathName string) {
+	checkPathName(pathName)
+	if len(newPathName) == 0 {
+		fmt.Printf("Missing new path name (use -n NEWPATHNAME)\n")
+		os.Exit(1)
+	}
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	err := prodos.Move(driveImage, pathName, newPathName)
+	if err != nil {
+		fmt.Printf("failed to move %s: %s\n", pathName, err)
+		os.Exit(1)
+	}
+}
+
+func cp(fileName string, inFileName string, pathName string, newPathName string, force bool) {
+	checkInFileName(inFileName)
+	checkPathName(pathName)
+	if len(newPathName) == 0 {
+		_, newPathName = prodos.GetDirectoryAndFileNameFromPath(pathName)
+	}
+	sourceFile, source := openDriveImage(inFileName, os.O_RDONLY)
+	defer sourceFile.Close()
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	err := prodos.CopyFile(source, pathName, driveImage, newPathName, prodos.WriteFileOptions{Overwrite: force})
+	if err != nil {
+		fmt.Printf("failed to copy %s: %s\n", pathName, err)
 		os.Exit(1)
 	}
+}
+
+func rmdir(fileName string, pathName string, recursive bool) {
+	checkPathName(pathName)
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
 	defer file.Close()
-	prodos.DeleteFile(file, pathName)
+	err := prodos.DeleteDirectory(driveImage, pathName, recursive)
+	if err != nil {
+		fmt.Printf("failed to delete directory %s: %s\n", pathName, err)
+		os.Exit(1)
+	}
 }
 
-func putall(fileName string, inFileName string, pathName string, recursive bool) {
+func putall(fileName string, inFileName string, pathName string, recursive bool, force bool) {
 	if len(inFileName) == 0 {
 		inFileName = "."
 	}
-	file, err := os.OpenFile(fileName, os.O_RDWR, 0755)
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
+	defer file.Close()
+	options := prodos.WriteFileOptions{
+		IgnoreDuplicates: true,
+		Overwrite:        force,
+		PreserveCreated:  force,
+		PreserveAccess:   force,
+	}
+	err := prodos.AddFilesFromHostDirectoryWithOptions(driveImage, inFileName, pathName, recursive, options)
 	if err != nil {
-		fmt.Printf("failed to create file: %s\n", err)
+		fmt.Printf("failed to add host files: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func getall(fileName string, pathName string, outFileName string, recursive bool, exportFormat string, convertFiles bool) {
+	if len(outFileName) == 0 {
+		outFileName = "."
+	}
+	options := prodos.ExtractOptions{
+		Recursive: recursive,
+		Convert:   convertFiles,
+	}
+	switch strings.ToLower(exportFormat) {
+	case "", "type":
+		options.Naming = prodos.ExtractNamingCiderPress
+	case "plain":
+		options.Naming = prodos.ExtractNamingPlain
+	case "applesingle":
+		options.Naming = prodos.ExtractNamingAppleSingle
+	case "appledouble":
+		options.Naming = prodos.ExtractNamingAppleDouble
+	default:
+		fmt.Printf("Invalid export format: %s (use type, plain, applesingle or appledouble)\n", exportFormat)
 		os.Exit(1)
 	}
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
 	defer file.Close()
-	err = prodos.AddFilesFromHostDirectory(file, inFileName, pathName, recursive)
+	err := prodos.ExtractFilesToHostDirectory(driveImage, pathName, outFileName, options)
 	if err != nil {
-		fmt.Printf("failed to add host files: %s\n", err)
+		fmt.Printf("failed to extract files: %s\n", err)
 		os.Exit(1)
 	}
 }
 
-func create(fileName string, volumeName string, volumeSize uint16) {
-	file, err := os.Create(fileName)
+func readNuFXArchive(inFileName string) []prodos.NuFXRecord {
+	checkInFileName(inFileName)
+	inFile, err := os.Open(inFileName)
 	if err != nil {
-		fmt.Printf("failed to create file: %s\n", err)
+		fmt.Printf("Failed to open archive %s: %s\n", inFileName, err)
 		os.Exit(1)
 	}
+	defer inFile.Close()
+	fileInfo, err := inFile.Stat()
+	if err != nil {
+		fmt.Printf("Failed to get size of archive %s: %s\n", inFileName, err)
+		os.Exit(1)
+	}
+	records, err := prodos.ReadNuFXArchive(inFile, fileInfo.Size())
+	if err != nil {
+		fmt.Printf("Failed to read archive %s: %s\n", inFileName, err)
+		os.Exit(1)
+	}
+	return records
+}
+
+func unsdk(fileName string, inFileName string) {
+	records := readNuFXArchive(inFileName)
+	for _, record := range records {
+		if !record.IsDisk {
+			continue
+		}
+		file, driveImage := createDriveImage(fileName, uint16(len(record.DataFork)/512), "", "PDOU")
+		defer file.Close()
+		_, err := driveImage.WriteAt(record.DataFork, 0)
+		if err != nil {
+			fmt.Printf("Failed to write drive image %s: %s\n", fileName, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Printf("No disk image found in archive %s\n", inFileName)
+	os.Exit(1)
+}
+
+func putshk(fileName string, inFileName string, pathName string, force bool) {
+	records := readNuFXArchive(inFileName)
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
 	defer file.Close()
-	prodos.CreateVolume(file, volumeName, volumeSize)
+	options := prodos.WriteFileOptions{
+		Overwrite:       force,
+		PreserveCreated: force,
+		PreserveAccess:  force,
+	}
+	err := prodos.AddFilesFromNuFXArchive(driveImage, records, pathName, options)
+	if err != nil {
+		fmt.Printf("failed to add files from archive: %s\n", err)
+		os.Exit(1)
+	}
 }
 
-func writeBlock(blockNumber uint16, fileName string, inFileName string) {
-	checkInFileName(inFileName)
-	fmt.Printf("Writing block 0x%04X (%d):\n\n", blockNumber, blockNumber)
-	file, err := os.OpenFile(fileName, os.O_RDWR, 0755)
+func shk(fileName string, pathName string, outFileName string) {
+	if len(outFileName) == 0 {
+		fmt.Printf("Missing output file name (use -o FILENAME)\n")
+		os.Exit(1)
+	}
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
+	defer file.Close()
+
+	var records []prodos.NuFXRecord
+	if strings.HasSuffix(strings.ToLower(outFileName), ".sdk") {
+		record, err := prodos.GetNuFXDiskRecord(driveImage)
+		if err != nil {
+			fmt.Printf("Failed to read volume: %s\n", err)
+			os.Exit(1)
+		}
+		records = append(records, record)
+	} else {
+		var err error
+		records, err = prodos.GetNuFXRecords(driveImage, pathName)
+		if err != nil {
+			fmt.Printf("Failed to read files from %s: %s\n", pathName, err)
+			os.Exit(1)
+		}
+	}
+
+	outFile, err := os.Create(outFileName)
 	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
+		fmt.Printf("Failed to create output file %s: %s\n", outFileName, err)
+		os.Exit(1)
+	}
+	defer outFile.Close()
+	err = prodos.CreateNuFXArchive(outFile, records)
+	if err != nil {
+		fmt.Printf("Failed to write archive %s: %s\n", outFileName, err)
 		os.Exit(1)
 	}
+}
+
+func create(fileName string, volumeName string, volumeSize uint16, comment string, creator string) {
+	file, driveImage := createDriveImage(fileName, volumeSize, comment, creator)
+	defer file.Close()
+	err := prodos.CreateVolume(driveImage, volumeName, volumeSize)
+	if err != nil {
+		fmt.Printf("Failed to create volume %s: %s\n", volumeName, err)
+		os.Exit(1)
+	}
+}
+
+func convert(inFileName string, outFileName string, comment string, creator string) {
+	checkInFileName(inFileName)
+	if len(outFileName) == 0 {
+		fmt.Printf("Missing output file name (use -o FILENAME)\n")
+		os.Exit(1)
+	}
+	inFile, inDriveImage := openDriveImage(inFileName, os.O_RDONLY)
+	defer inFile.Close()
+	blocks := getDriveImageBlockCount(inFile, inDriveImage)
+	outFile, outDriveImage := createDriveImage(outFileName, blocks, comment, creator)
+	defer outFile.Close()
+
+	for block := 0; block < int(blocks); block++ {
+		buffer, err := prodos.ReadBlock(inDriveImage, uint16(block))
+		if err != nil {
+			fmt.Printf("Failed to read drive image %s:\n  %s\n", inFileName, err)
+			os.Exit(1)
+		}
+		err = prodos.WriteBlock(outDriveImage, uint16(block), buffer)
+		if err != nil {
+			fmt.Printf("Failed to write drive image %s:\n  %s\n", outFileName, err)
+			os.Exit(1)
+		}
+	}
+}
+
+func writeBlock(blockNumber uint16, fileName string, inFileName string) {
+	checkInFileName(inFileName)
+	fmt.Printf("Writing block 0x%04X (%d):\n\n", blockNumber, blockNumber)
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
 	defer file.Close()
 	inFile, err := os.ReadFile(inFileName)
 	if err != nil {
 		fmt.Printf("Failed to open input file %s: %s", inFileName, err)
 		os.Exit(1)
 	}
-	prodos.WriteBlock(file, blockNumber, inFile)
+	err = prodos.WriteBlock(driveImage, blockNumber, inFile)
+	if err != nil {
+		fmt.Printf("Failed to write block %04X: %s\n", blockNumber, err)
+		os.Exit(1)
+	}
 }
 
 func readBlock(blockNumber uint16, fileName string) {
 	fmt.Printf("Reading block 0x%04X (%d):\n\n", blockNumber, blockNumber)
-	file, err := os.OpenFile(fileName, os.O_RDONLY, 0755)
-	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
-		os.Exit(1)
-	}
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
 	defer file.Close()
-	block, err := prodos.ReadBlock(file, blockNumber)
+	block, err := prodos.ReadBlock(driveImage, blockNumber)
 	if err != nil {
 		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
 		os.Exit(1)
@@ -202,35 +642,32 @@ func readBlock(blockNumber uint16, fileName string) {
 	prodos.DumpBlock(block)
 }
 
-func put(fileName string, pathName string, fileType uint8, auxType uint16, inFileName string) {
+func put(fileName string, pathName string, fileType uint8, auxType uint16, inFileName string, force bool) {
 	checkPathName(pathName)
 	checkInFileName(inFileName)
-	file, err := os.OpenFile(fileName, os.O_RDWR, 0755)
-	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
-		os.Exit(1)
-	}
+	file, driveImage := openDriveImage(fileName, os.O_RDWR)
 	defer file.Close()
 	fileInfo, err := os.Stat(fileName)
 	if err != nil {
 		fmt.Printf("Failed get fileInfo for %s - %s", fileName, err)
 	}
 
-	err = prodos.WriteFileFromFile(file, pathName, fileType, auxType, fileInfo.ModTime(), inFileName, nil, false)
+	options := prodos.WriteFileOptions{
+		Overwrite:       force,
+		PreserveCreated: force,
+		PreserveAccess:  force,
+	}
+	err = prodos.WriteFileFromFileWithOptions(driveImage, pathName, fileType, auxType, fileInfo.ModTime(), inFileName, nil, options)
 	if err != nil {
 		fmt.Printf("Failed to write file %s", err)
 	}
 }
 
-func get(fileName string, pathName string, outFileName string) {
+func get(fileName string, pathName string, outFileName string, exportFormat string) {
 	checkPathName(pathName)
-	file, err := os.OpenFile(fileName, os.O_RDONLY, 0755)
-	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
-		os.Exit(1)
-	}
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
 	defer file.Close()
-	getFile, err := prodos.LoadFile(file, pathName)
+	getFile, err := prodos.LoadFile(driveImage, pathName)
 	if err != nil {
 		fmt.Printf("Failed to read file %s: %s\n", pathName, err)
 		os.Exit(1)
@@ -238,12 +675,20 @@ func get(fileName string, pathName string, outFileName string) {
 	if len(outFileName) == 0 {
 		_, outFileName = prodos.GetDirectoryAndFileNameFromPath(pathName)
 	}
+	if len(exportFormat) > 0 {
+		getAppleSingle(driveImage, pathName, outFileName, exportFormat)
+		return
+	}
+	outLower := strings.ToLower(outFileName)
+	if strings.HasSuffix(outLower, ".bqy") {
+		fmt.Printf("Squeezed Binary II output is not supported, use .bny instead\n")
+		os.Exit(1)
+	}
 	outFile, err := os.Create(outFileName)
 	if err != nil {
 		fmt.Printf("Failed to create output file %s: %s\n", outFileName, err)
 		os.Exit(1)
 	}
-	outLower := strings.ToLower(outFileName)
 	if strings.HasSuffix(outLower, ".bas") {
 		fmt.Fprint(outFile, prodos.ConvertBasicToText(getFile))
 	} else if strings.HasSuffix(outLower, ".png") {
@@ -268,25 +713,99 @@ func get(fileName string, pathName string, outFileName string) {
 			fmt.Printf("Failed to encode JPEG: %s\n", err)
 			os.Exit(1)
 		}
+	} else if strings.HasSuffix(outLower, ".bny") {
+		fileEntry, err := prodos.GetFileEntry(driveImage, pathName)
+		if err != nil {
+			fmt.Printf("Failed to read file entry %s: %s\n", pathName, err)
+			os.Exit(1)
+		}
+		err = prodos.WriteBinaryII(outFile, []prodos.BinaryIIFile{{
+			FileName:     fileEntry.FileName,
+			Access:       fileEntry.Access,
+			FileType:     fileEntry.FileType,
+			AuxType:      fileEntry.AuxType,
+			StorageType:  fileEntry.StorageType,
+			CreationTime: fileEntry.CreationTime,
+			ModifiedTime: fileEntry.ModifiedTime,
+			Data:         getFile,
+		}})
+		if err != nil {
+			fmt.Printf("Failed to write Binary II file: %s\n", err)
+			os.Exit(1)
+		}
 	} else {
 		outFile.Write(getFile)
 	}
 }
 
-func getRaw(fileName string, pathName string) {
-	checkPathName(pathName)
-	file, err := os.OpenFile(fileName, os.O_RDONLY, 0755)
+func getAppleSingle(driveImage prodos.ReaderWriterAt, pathName string, outFileName string, exportFormat string) {
+	fileEntry, err := prodos.GetFileEntry(driveImage, pathName)
 	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
+		fmt.Printf("Failed to read file entry %s: %s\n", pathName, err)
 		os.Exit(1)
 	}
+	dataFork, resourceFork, finderInfo, err := prodos.LoadFileForks(driveImage, pathName)
+	if err != nil {
+		fmt.Printf("Failed to read file %s: %s\n", pathName, err)
+		os.Exit(1)
+	}
+	appleSingleFile := prodos.AppleSingleFile{
+		RealName:        fileEntry.FileName,
+		HasFileInfo:     true,
+		Access:          fileEntry.Access,
+		FileType:        fileEntry.FileType,
+		AuxType:         fileEntry.AuxType,
+		CreationTime:    fileEntry.CreationTime,
+		ModifiedTime:    fileEntry.ModifiedTime,
+		DataFork:        dataFork,
+		ResourceFork:    resourceFork,
+		HasResourceFork: fileEntry.StorageType == prodos.StorageExtended,
+		FinderInfo:      finderInfo,
+	}
+
+	headerFileName := outFileName
+	switch strings.ToLower(exportFormat) {
+	case "applesingle":
+	case "appledouble":
+		directory, name := filepath.Split(outFileName)
+		headerFileName = filepath.Join(directory, "._"+name)
+		err = os.WriteFile(outFileName, dataFork, 0644)
+		if err != nil {
+			fmt.Printf("Failed to write output file %s: %s\n", outFileName, err)
+			os.Exit(1)
+		}
+	default:
+		fmt.Printf("Invalid export format: %s (use applesingle or appledouble)\n", exportFormat)
+		os.Exit(1)
+	}
+
+	headerFile, err := os.Create(headerFileName)
+	if err != nil {
+		fmt.Printf("Failed to create output file %s: %s\n", headerFileName, err)
+		os.Exit(1)
+	}
+	defer headerFile.Close()
+	if headerFileName == outFileName {
+		err = prodos.WriteAppleSingle(headerFile, appleSingleFile)
+	} else {
+		err = prodos.WriteAppleDouble(headerFile, appleSingleFile)
+	}
+	if err != nil {
+		fmt.Printf("Failed to write %s: %s\n", headerFileName, err)
+		os.Exit(1)
+	}
+}
+
+func getRaw(fileName string, pathName string) {
+	checkPathName(pathName)
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
 	defer file.Close()
-	getFile, err := prodos.LoadFile(file, pathName)
+	getFile, err := prodos.LoadFile(driveImage, pathName)
 	if err != nil {
 		fmt.Printf("Failed to read file %s: %s\n", pathName, err)
 		os.Exit(1)
 	}
-	fileEntry, err := prodos.GetFileEntry(file, pathName)
+	fileEntry, err := prodos.GetFileEntry(driveImage, pathName)
 	if err != nil {
 		fmt.Printf("Failed to get file entry %s: %s\n", pathName, err)
 		os.Exit(1)
@@ -304,21 +823,17 @@ func getRaw(fileName string, pathName string) {
 }
 
 func ls(fileName string, pathName string) {
-	file, err := os.OpenFile(fileName, os.O_RDONLY, 0755)
-	if err != nil {
-		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
-		os.Exit(1)
-	}
+	file, driveImage := openDriveImage(fileName, os.O_RDONLY)
 	defer file.Close()
 	pathName = strings.ToUpper(pathName)
-	volumeHeader, _, fileEntries, err := prodos.ReadDirectory(file, pathName)
+	volumeHeader, _, fileEntries, err := prodos.ReadDirectory(driveImage, pathName)
 	if err != nil {
 		fmt.Printf("Error: %s", err)
 	}
 	if len(pathName) == 0 {
 		pathName = "/" + volumeHeader.VolumeName
 	}
-	volumeBitmap, err := prodos.ReadVolumeBitmap(file)
+	volumeBitmap, err := prodos.ReadVolumeBitmap(driveImage)
 	if err != nil {
 		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
 		os.Exit(1)
@@ -327,6 +842,128 @@ func ls(fileName string, pathName string) {
 	prodos.DumpDirectory(freeBlocks, volumeHeader.TotalBlocks, pathName, fileEntries)
 }
 
+// openDriveImage opens a drive image and returns the file to close along
+// with the block device to use, unwrapping 2IMG images when detected and
+// translating DOS 3.3 sector ordered images
+func openDriveImage(fileName string, flag int) (*os.File, prodos.ReaderWriterAt) {
+	file, err := os.OpenFile(fileName, flag, 0755)
+	if err != nil {
+		fmt.Printf("Failed to open drive image %s:\n  %s", fileName, err)
+		os.Exit(1)
+	}
+
+	if prodos.IsWoz(file) {
+		fileInfo, err := file.Stat()
+		if err != nil {
+			fmt.Printf("Failed to get size of drive image %s:\n  %s", fileName, err)
+			os.Exit(1)
+		}
+		woz, err := prodos.OpenWoz(file, fileInfo.Size())
+		if err != nil {
+			fmt.Printf("Failed to open WOZ drive image %s:\n  %s", fileName, err)
+			os.Exit(1)
+		}
+		return file, woz
+	}
+
+	if !prodos.IsTwoImg(file) {
+		fileInfo, err := file.Stat()
+		if err != nil {
+			fmt.Printf("Failed to get size of drive image %s:\n  %s", fileName, err)
+			os.Exit(1)
+		}
+		fileNameLower := strings.ToLower(fileName)
+		if strings.HasSuffix(fileNameLower, ".do") ||
+			(strings.HasSuffix(fileNameLower, ".dsk") && prodos.IsDOSOrder(file, fileInfo.Size())) {
+			dosOrder, err := prodos.OpenDOSOrder(file, fileInfo.Size())
+			if err != nil {
+				fmt.Printf("Failed to open DOS order drive image %s:\n  %s\n", fileName, err)
+				os.Exit(1)
+			}
+			return file, dosOrder
+		}
+		return file, file
+	}
+
+	twoImg, err := prodos.OpenTwoImg(file)
+	if err != nil {
+		fmt.Printf("Failed to open 2IMG drive image %s:\n  %s", fileName, err)
+		os.Exit(1)
+	}
+	switch twoImg.Format {
+	case prodos.TwoImgFormatProDOS:
+		return file, twoImg
+	case prodos.TwoImgFormatDOS:
+		dosOrder, err := prodos.OpenDOSOrder(twoImg, int64(twoImg.DataLength))
+		if err != nil {
+			fmt.Printf("Failed to open 2IMG drive image %s:\n  %s\n", fileName, err)
+			os.Exit(1)
+		}
+		return file, dosOrder
+	}
+
+	fmt.Printf("Unsupported 2IMG format %d in %s\n", twoImg.Format, fileName)
+	os.Exit(1)
+	return nil, nil
+}
+
+// createDriveImage creates a drive image of the specified number of
+// blocks with the format chosen by the file extension
+func createDriveImage(fileName string, blocks uint16, comment string, creator string) (*os.File, prodos.ReaderWriterAt) {
+	fileNameLower := strings.ToLower(fileName)
+	isDOSOrder := strings.HasSuffix(fileNameLower, ".do") || strings.HasSuffix(fileNameLower, ".dsk")
+	if isDOSOrder && int64(blocks)*512 != prodos.DOSOrderImageSize {
+		fmt.Printf("DOS order drive images (.do and .dsk) can only be 280 blocks, use .po for %d blocks\n", blocks)
+		os.Exit(1)
+	}
+
+	file, err := os.Create(fileName)
+	if err != nil {
+		fmt.Printf("failed to create file: %s\n", err)
+		os.Exit(1)
+	}
+
+	switch {
+	case strings.HasSuffix(fileNameLower, ".2mg") || strings.HasSuffix(fileNameLower, ".2img"):
+		twoImg, err := prodos.CreateTwoImg(file, blocks, comment, creator)
+		if err != nil {
+			fmt.Printf("failed to create 2IMG header: %s\n", err)
+			os.Exit(1)
+		}
+		return file, twoImg
+	case isDOSOrder:
+		return file, prodos.NewDOSOrder(file)
+	}
+
+	return file, file
+}
+
+// getDriveImageBlockCount returns the number of blocks in a drive image
+// based on its size or its WOZ or 2IMG header
+func getDriveImageBlockCount(file *os.File, driveImage prodos.ReaderWriterAt) uint16 {
+	if woz, ok := driveImage.(*prodos.Woz); ok {
+		return uint16(woz.Blocks)
+	}
+	if prodos.IsTwoImg(file) {
+		twoImg, err := prodos.OpenTwoImg(file)
+		if err != nil {
+			fmt.Printf("Failed to open 2IMG drive image %s:\n  %s", file.Name(), err)
+			os.Exit(1)
+		}
+		return uint16(twoImg.DataLength / 512)
+	}
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		fmt.Printf("Failed to get size of drive image %s:\n  %s", file.Name(), err)
+		os.Exit(1)
+	}
+	if fileInfo.Size() > 65535*512 {
+		return 65535
+	}
+	return uint16(fileInfo.Size() / 512)
+}
+
 func checkPathName(pathName string) {
 	if len(pathName) == 0 {
 		fmt.Printf("Missing path name (use -p PATHNAME)\n")
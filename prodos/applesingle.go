@@ -0,0 +1,211 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides access to read and write AppleSingle and AppleDouble
+// files which keep the forks and ProDOS attributes of files on other systems
+
+package prodos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	appleSingleMagic     = 0x00051600
+	appleDoubleMagic     = 0x00051607
+	appleSingleVersion   = 0x00020000
+	appleSingleHeaderLen = 26
+	appleSingleEntryLen  = 12
+)
+
+const (
+	appleSingleEntryDataFork     = 1
+	appleSingleEntryResourceFork = 2
+	appleSingleEntryRealName     = 3
+	appleSingleEntryFileDates    = 8
+	appleSingleEntryFinderInfo   = 9
+	appleSingleEntryProDOSInfo   = 11
+)
+
+// AppleSingle and AppleDouble dates are seconds since the start of 2000
+// with the most negative value meaning unknown
+var appleSingleEpoch = time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+const appleSingleUnknownDate = -0x80000000
+
+// AppleSingleFile is the contents of an AppleSingle file or of an
+// AppleDouble header file and its data file
+type AppleSingleFile struct {
+	RealName        string
+	HasFileInfo     bool
+	Access          uint8
+	FileType        uint8
+	AuxType         uint16
+	CreationTime    time.Time
+	ModifiedTime    time.Time
+	DataFork        []byte
+	ResourceFork    []byte
+	HasResourceFork bool
+	FinderInfo      []byte
+}
+
+// IsAppleSingle returns true if the data starts with an AppleSingle header
+func IsAppleSingle(data []byte) bool {
+	return len(data) >= appleSingleHeaderLen && binary.BigEndian.Uint32(data) == appleSingleMagic
+}
+
+// IsAppleDouble returns true if the data starts with an AppleDouble header
+func IsAppleDouble(data []byte) bool {
+	return len(data) >= appleSingleHeaderLen && binary.BigEndian.Uint32(data) == appleDoubleMagic
+}
+
+// ReadAppleSingle reads the entries of an AppleSingle file or AppleDouble
+// header file in any order, ignoring entries that are not needed by ProDOS
+func ReadAppleSingle(data []byte) (AppleSingleFile, error) {
+	if !IsAppleSingle(data) && !IsAppleDouble(data) {
+		return AppleSingleFile{}, errors.New("missing AppleSingle header")
+	}
+
+	entryCount := int(binary.BigEndian.Uint16(data[24:]))
+	if appleSingleHeaderLen+entryCount*appleSingleEntryLen > len(data) {
+		return AppleSingleFile{}, errors.New("truncated AppleSingle entry table")
+	}
+
+	appleSingleFile := AppleSingleFile{Access: 0xE3}
+	for i := 0; i < entryCount; i++ {
+		entry := data[appleSingleHeaderLen+i*appleSingleEntryLen:]
+		id := binary.BigEndian.Uint32(entry[0:])
+		offset := int64(binary.BigEndian.Uint32(entry[4:]))
+		length := int64(binary.BigEndian.Uint32(entry[8:]))
+		if offset+length > int64(len(data)) {
+			errString := fmt.Sprintf("truncated AppleSingle entry %d", id)
+			return AppleSingleFile{}, errors.New(errString)
+		}
+		entryData := data[offset : offset+length]
+
+		switch id {
+		case appleSingleEntryDataFork:
+			appleSingleFile.DataFork = entryData
+		case appleSingleEntryResourceFork:
+			appleSingleFile.ResourceFork = entryData
+			appleSingleFile.HasResourceFork = true
+		case appleSingleEntryRealName:
+			appleSingleFile.RealName = string(entryData)
+		case appleSingleEntryFileDates:
+			if length < 8 {
+				return AppleSingleFile{}, errors.New("invalid AppleSingle file dates")
+			}
+			appleSingleFile.CreationTime = appleSingleDateTime(entryData[0:])
+			appleSingleFile.ModifiedTime = appleSingleDateTime(entryData[4:])
+		case appleSingleEntryFinderInfo:
+			if length >= 32 {
+				appleSingleFile.FinderInfo = entryData[0:32]
+			}
+		case appleSingleEntryProDOSInfo:
+			if length < 8 {
+				return AppleSingleFile{}, errors.New("invalid AppleSingle ProDOS file info")
+			}
+			appleSingleFile.HasFileInfo = true
+			appleSingleFile.Access = byte(binary.BigEndian.Uint16(entryData[0:]))
+			appleSingleFile.FileType = byte(binary.BigEndian.Uint16(entryData[2:]))
+			appleSingleFile.AuxType = uint16(binary.BigEndian.Uint32(entryData[4:]))
+		}
+	}
+
+	return appleSingleFile, nil
+}
+
+// WriteAppleSingle writes the forks and attributes of a file as AppleSingle
+func WriteAppleSingle(writer io.Writer, appleSingleFile AppleSingleFile) error {
+	return writeAppleSingle(writer, appleSingleFile, appleSingleMagic)
+}
+
+// WriteAppleDouble writes the resource fork and attributes of a file as an
+// AppleDouble header file, the data fork is written separately by the caller
+func WriteAppleDouble(writer io.Writer, appleSingleFile AppleSingleFile) error {
+	return writeAppleSingle(writer, appleSingleFile, appleDoubleMagic)
+}
+
+func writeAppleSingle(writer io.Writer, appleSingleFile AppleSingleFile, magic uint32) error {
+	type appleSingleEntry struct {
+		id   uint32
+		data []byte
+	}
+
+	fileInfo := make([]byte, 8)
+	binary.BigEndian.PutUint16(fileInfo[0:], uint16(appleSingleFile.Access))
+	binary.BigEndian.PutUint16(fileInfo[2:], uint16(appleSingleFile.FileType))
+	binary.BigEndian.PutUint32(fileInfo[4:], uint32(appleSingleFile.AuxType))
+
+	fileDates := make([]byte, 16)
+	binary.BigEndian.PutUint32(fileDates[0:], appleSingleDateTimeToBytes(appleSingleFile.CreationTime))
+	binary.BigEndian.PutUint32(fileDates[4:], appleSingleDateTimeToBytes(appleSingleFile.ModifiedTime))
+	binary.BigEndian.PutUint32(fileDates[8:], uint32(0x80000000))
+	binary.BigEndian.PutUint32(fileDates[12:], uint32(0x80000000))
+
+	entries := []appleSingleEntry{
+		{appleSingleEntryProDOSInfo, fileInfo},
+		{appleSingleEntryFileDates, fileDates},
+	}
+	if len(appleSingleFile.RealName) > 0 {
+		entries = append(entries, appleSingleEntry{appleSingleEntryRealName, []byte(appleSingleFile.RealName)})
+	}
+	if len(appleSingleFile.FinderInfo) == 32 {
+		entries = append(entries, appleSingleEntry{appleSingleEntryFinderInfo, appleSingleFile.FinderInfo})
+	}
+	if appleSingleFile.HasResourceFork {
+		entries = append(entries, appleSingleEntry{appleSingleEntryResourceFork, appleSingleFile.ResourceFork})
+	}
+	if magic == appleSingleMagic {
+		entries = append(entries, appleSingleEntry{appleSingleEntryDataFork, appleSingleFile.DataFork})
+	}
+
+	header := make([]byte, appleSingleHeaderLen+len(entries)*appleSingleEntryLen)
+	binary.BigEndian.PutUint32(header[0:], magic)
+	binary.BigEndian.PutUint32(header[4:], appleSingleVersion)
+	binary.BigEndian.PutUint16(header[24:], uint16(len(entries)))
+
+	offset := len(header)
+	for i, entry := range entries {
+		entryHeader := header[appleSingleHeaderLen+i*appleSingleEntryLen:]
+		binary.BigEndian.PutUint32(entryHeader[0:], entry.id)
+		binary.BigEndian.PutUint32(entryHeader[4:], uint32(offset))
+		binary.BigEndian.PutUint32(entryHeader[8:], uint32(len(entry.data)))
+		offset += len(entry.data)
+	}
+
+	_, err := writer.Write(header)
+	for _, entry := range entries {
+		if err != nil {
+			break
+		}
+		_, err = writer.Write(entry.data)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write AppleSingle file: %w", err)
+	}
+
+	return nil
+}
+
+func appleSingleDateTime(buffer []byte) time.Time {
+	seconds := int32(binary.BigEndian.Uint32(buffer))
+	if seconds == appleSingleUnknownDate {
+		return time.Time{}
+	}
+
+	return appleSingleEpoch.Add(time.Duration(seconds) * time.Second).Local()
+}
+
+func appleSingleDateTimeToBytes(dateTime time.Time) uint32 {
+	if dateTime.IsZero() {
+		return uint32(0x80000000)
+	}
+
+	return uint32(int32(dateTime.Sub(appleSingleEpoch) / time.Second))
+}
@@ -0,0 +1,217 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for reading and writing AppleSingle and AppleDouble files
+
+package prodos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadAppleSingle(t *testing.T) {
+	program := []byte{0xA9, 0xC1, 0x20, 0xED, 0xFD, 0x60}
+
+	// cc65 writes the ProDOS file info then the data fork
+	cc65 := make([]byte, 0x3A)
+	binary.BigEndian.PutUint32(cc65[0x00:], 0x00051600)
+	binary.BigEndian.PutUint32(cc65[0x04:], 0x00020000)
+	binary.BigEndian.PutUint16(cc65[0x18:], 2)
+	binary.BigEndian.PutUint32(cc65[0x1A:], 1)
+	binary.BigEndian.PutUint32(cc65[0x1E:], 0x3A)
+	binary.BigEndian.PutUint32(cc65[0x22:], uint32(len(program)))
+	binary.BigEndian.PutUint32(cc65[0x26:], 11)
+	binary.BigEndian.PutUint32(cc65[0x2A:], 0x32)
+	binary.BigEndian.PutUint32(cc65[0x2E:], 8)
+	binary.BigEndian.PutUint16(cc65[0x32:], 0xC3)
+	binary.BigEndian.PutUint16(cc65[0x34:], 0x06)
+	binary.BigEndian.PutUint32(cc65[0x36:], 0x0803)
+	cc65 = append(cc65, program...)
+
+	// entries in a different order with a real name and dates
+	reordered := make([]byte, 26+4*12)
+	binary.BigEndian.PutUint32(reordered[0:], 0x00051600)
+	binary.BigEndian.PutUint16(reordered[24:], 4)
+	entries := []struct {
+		id   uint32
+		data []byte
+	}{
+		{3, []byte("SHOUT")},
+		{1, program},
+		{8, []byte{0x10, 0x00, 0x00, 0x00, 0x20, 0x00, 0x00, 0x00, 0x80, 0, 0, 0, 0x80, 0, 0, 0}},
+		{11, []byte{0x00, 0x21, 0x00, 0xFF, 0x00, 0x00, 0x20, 0x00}},
+	}
+	for i, entry := range entries {
+		binary.BigEndian.PutUint32(reordered[26+i*12:], entry.id)
+		binary.BigEndian.PutUint32(reordered[30+i*12:], uint32(len(reordered)))
+		binary.BigEndian.PutUint32(reordered[34+i*12:], uint32(len(entry.data)))
+		reordered = append(reordered, entry.data...)
+	}
+
+	var tests = []struct {
+		testName     string
+		data         []byte
+		wantName     string
+		wantType     uint8
+		wantAux      uint16
+		wantAccess   uint8
+		wantModified time.Time
+	}{
+		{"cc65", cc65, "", 0x06, 0x0803, 0xC3, time.Time{}},
+		{"reordered", reordered, "SHOUT", 0xFF, 0x2000, 0x21, time.Unix(946684800+0x20000000, 0)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			got, err := ReadAppleSingle(tt.data)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if got.RealName != tt.wantName || got.FileType != tt.wantType || got.AuxType != tt.wantAux || got.Access != tt.wantAccess {
+				t.Errorf("got %s %02X %04X %02X, want %s %02X %04X %02X",
+					got.RealName, got.FileType, got.AuxType, got.Access,
+					tt.wantName, tt.wantType, tt.wantAux, tt.wantAccess)
+			}
+			if !got.ModifiedTime.Equal(tt.wantModified) {
+				t.Errorf("got %s, want %s", got.ModifiedTime, tt.wantModified)
+			}
+			if !bytes.Equal(got.DataFork, program) {
+				t.Errorf("data fork does not match")
+			}
+
+			_, err = ReadAppleSingle(tt.data[:len(tt.data)-1])
+			if err == nil {
+				t.Errorf("got no error for truncated file")
+			}
+		})
+	}
+}
+
+func TestAppleSingleRoundTrip(t *testing.T) {
+	modifiedTime := time.Date(2023, time.May, 6, 7, 8, 0, 0, time.Local)
+	createdTime := time.Date(1987, time.April, 5, 6, 7, 0, 0, time.Local)
+	finderInfo := make([]byte, 32)
+	copy(finderInfo, "pB3 pdos")
+	want := AppleSingleFile{
+		RealName:        "FORKED",
+		HasFileInfo:     true,
+		Access:          0xC3,
+		FileType:        0xB3,
+		AuxType:         0xDB07,
+		CreationTime:    createdTime,
+		ModifiedTime:    modifiedTime,
+		DataFork:        bytes.Repeat([]byte("DATA"), 300),
+		ResourceFork:    bytes.Repeat([]byte("RSRC"), 200),
+		HasResourceFork: true,
+		FinderInfo:      finderInfo,
+	}
+
+	for _, format := range []string{"applesingle", "appledouble"} {
+		t.Run(format, func(t *testing.T) {
+			directory := t.TempDir()
+			hostFile := filepath.Join(directory, "forked")
+			var buffer bytes.Buffer
+			if format == "applesingle" {
+				WriteAppleSingle(&buffer, want)
+				os.WriteFile(hostFile, buffer.Bytes(), 0644)
+			} else {
+				WriteAppleDouble(&buffer, want)
+				os.WriteFile(hostFile, want.DataFork, 0644)
+				os.WriteFile(filepath.Join(directory, "._forked"), buffer.Bytes(), 0644)
+			}
+
+			volume := NewMemoryFile(0x2000000)
+			CreateVolume(volume, "as", 2048)
+			err := WriteFileFromFile(volume, "/as/", 0, 0, time.Now(), hostFile, nil, false)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			fileEntry, err := GetFileEntry(volume, "/as/forked")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if fileEntry.FileType != want.FileType || fileEntry.AuxType != want.AuxType || fileEntry.Access != want.Access {
+				t.Errorf("got %02X %04X %02X", fileEntry.FileType, fileEntry.AuxType, fileEntry.Access)
+			}
+			if !fileEntry.ModifiedTime.Equal(modifiedTime) || !fileEntry.CreationTime.Equal(createdTime) {
+				t.Errorf("got dates %s %s", fileEntry.CreationTime, fileEntry.ModifiedTime)
+			}
+			dataFork, resourceFork, gotFinderInfo, err := LoadFileForks(volume, "/as/forked")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !bytes.Equal(dataFork, want.DataFork) || !bytes.Equal(resourceFork, want.ResourceFork) {
+				t.Errorf("forks do not match")
+			}
+			if !bytes.Equal(gotFinderInfo, finderInfo) {
+				t.Errorf("got finder info % X", gotFinderInfo)
+			}
+		})
+	}
+}
+
+func TestWriteFileFromShortFile(t *testing.T) {
+	hostFile := filepath.Join(t.TempDir(), "ab")
+	os.WriteFile(hostFile, []byte("AB"), 0644)
+
+	volume := NewMemoryFile(0x2000000)
+	CreateVolume(volume, "short", 2048)
+	err := WriteFileFromFile(volume, "", 0, 0, time.Now(), hostFile, nil, false)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	got, _ := LoadFile(volume, "/short/ab")
+	if string(got) != "AB" {
+		t.Errorf("got %q, want %q", got, "AB")
+	}
+}
+
+func TestWriteFileFromAppleSingleExisting(t *testing.T) {
+	var tests = []struct {
+		testName   string
+		options    WriteFileOptions
+		wantData   string
+		wantAccess uint8
+	}{
+		{"skipped", WriteFileOptions{IgnoreDuplicates: true}, "OLD", 0xC3},
+		{"overwritePreserveAccess", WriteFileOptions{Overwrite: true, PreserveAccess: true}, "NEW", 0xC3},
+		{"overwrite", WriteFileOptions{Overwrite: true}, "NEW", 0x21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			hostFile := filepath.Join(t.TempDir(), "readme")
+			var buffer bytes.Buffer
+			WriteAppleSingle(&buffer, AppleSingleFile{HasFileInfo: true, Access: 0x21, FileType: 0x04, DataFork: []byte("NEW")})
+			os.WriteFile(hostFile, buffer.Bytes(), 0644)
+
+			volume := NewMemoryFile(0x2000000)
+			CreateVolume(volume, "as", 2048)
+			WriteFile(volume, "/as/readme", 0x04, 0, time.Now(), time.Now(), []byte("OLD"))
+			access := uint8(0xC3)
+			SetFileInfo(volume, "/as/readme", FileInfoUpdate{Access: &access})
+
+			err := WriteFileFromFileWithOptions(volume, "/as/", 0, 0, time.Now(), hostFile, nil, tt.options)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			fileEntry, _ := GetFileEntry(volume, "/as/readme")
+			if fileEntry.Access != tt.wantAccess {
+				t.Errorf("got access %02X, want %02X", fileEntry.Access, tt.wantAccess)
+			}
+			data, _ := LoadFile(volume, "/as/readme")
+			if string(data) != tt.wantData {
+				t.Errorf("got %s, want %s", data, tt.wantData)
+			}
+		})
+	}
+}
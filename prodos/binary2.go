@@ -0,0 +1,314 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides access to read and write Binary II (.bny/.bqy) archives
+// which keep the ProDOS attributes of files stored on other systems
+
+package prodos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	binaryIIHeaderSize     = 128
+	binaryIIMaxFileName    = 64
+	binaryIIVersion        = 1
+	binaryIIFlagSqueezed   = 0x80
+	binaryIIFlagEncrypted  = 0x40
+	squeezeMagic           = 0xFF76
+	squeezeEndOfFile       = 256
+	squeezeRepeatCharacter = 0x90
+	squeezeMaxNodes        = 257
+)
+
+// BinaryIIFile is a file or directory stored in a Binary II archive
+type BinaryIIFile struct {
+	FileName     string
+	Access       uint8
+	FileType     uint8
+	AuxType      uint16
+	StorageType  uint8
+	CreationTime time.Time
+	ModifiedTime time.Time
+	Data         []byte
+}
+
+// IsBinaryIIArchive returns true if the data starts with a Binary II header
+func IsBinaryIIArchive(reader io.ReaderAt) bool {
+	header := make([]byte, binaryIIHeaderSize)
+	n, _ := reader.ReadAt(header, 0)
+
+	return isBinaryIIHeader(header[:n])
+}
+
+// ReadBinaryII reads all files of a Binary II archive of the specified
+// size in bytes, unsqueezing any files that were compressed (.bqy)
+func ReadBinaryII(reader io.ReaderAt, size int64) ([]BinaryIIFile, error) {
+	data := make([]byte, size)
+	_, err := reader.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read Binary II archive: %w", err)
+	}
+
+	var files []BinaryIIFile
+	offset := 0
+	for {
+		if !isBinaryIIHeader(data[offset:]) {
+			return nil, errors.New("missing Binary II header")
+		}
+		header := data[offset : offset+binaryIIHeaderSize]
+		offset += binaryIIHeaderSize
+
+		fileNameLength := int(header[23])
+		if fileNameLength == 0 || fileNameLength > binaryIIMaxFileName {
+			return nil, errors.New("invalid Binary II file name")
+		}
+		fileName := string(header[24 : 24+fileNameLength])
+
+		length := int(header[20]) + int(header[21])<<8 + int(header[22])<<16 + int(header[116])<<24
+		if offset+length > len(data) {
+			errString := fmt.Sprintf("truncated Binary II file %s", fileName)
+			return nil, errors.New(errString)
+		}
+		fileData := data[offset : offset+length]
+		offset += (length + binaryIIHeaderSize - 1) / binaryIIHeaderSize * binaryIIHeaderSize
+
+		dataFlags := header[125]
+		if dataFlags&binaryIIFlagEncrypted != 0 {
+			errString := fmt.Sprintf("encrypted Binary II file %s is not supported", fileName)
+			return nil, errors.New(errString)
+		}
+		if dataFlags&binaryIIFlagSqueezed != 0 {
+			fileData, err = unsqueeze(fileData)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unsqueeze %s: %w", fileName, err)
+			}
+		}
+
+		// phantom files hold data for other programs and are not real files
+		if header[124] == 0 {
+			files = append(files, BinaryIIFile{
+				FileName:     fileName,
+				Access:       header[3],
+				FileType:     header[4],
+				AuxType:      binary.LittleEndian.Uint16(header[5:]),
+				StorageType:  header[7],
+				ModifiedTime: DateTimeFromProDOS(header[10:14]),
+				CreationTime: DateTimeFromProDOS(header[14:18]),
+				Data:         fileData,
+			})
+		}
+
+		if header[127] == 0 {
+			break
+		}
+	}
+
+	return files, nil
+}
+
+// WriteBinaryII writes the files to a Binary II archive
+func WriteBinaryII(writer io.Writer, files []BinaryIIFile) error {
+	totalBlocks := 0
+	for _, file := range files {
+		totalBlocks += (len(file.Data) + 511) / 512
+	}
+
+	for i, file := range files {
+		fileName := strings.ToUpper(file.FileName)
+		if len(fileName) == 0 || len(fileName) > binaryIIMaxFileName {
+			errString := fmt.Sprintf("invalid Binary II file name %s", file.FileName)
+			return errors.New(errString)
+		}
+		if len(files)-i-1 > 0xFF {
+			return errors.New("too many files for Binary II archive")
+		}
+
+		length := len(file.Data)
+		storageType := file.StorageType
+		if storageType == 0 {
+			storageType = StorageSeedling
+		}
+
+		blocks := (length + 511) / 512
+		header := make([]byte, binaryIIHeaderSize)
+		copy(header, []byte{0x0A, 0x47, 0x4C})
+		header[3] = file.Access
+		header[4] = file.FileType
+		binary.LittleEndian.PutUint16(header[5:], file.AuxType)
+		header[7] = storageType
+		binary.LittleEndian.PutUint16(header[8:], uint16(blocks))
+		copy(header[10:14], DateTimeToProDOS(file.ModifiedTime))
+		copy(header[14:18], DateTimeToProDOS(file.CreationTime))
+		header[18] = 0x02
+		header[20] = byte(length)
+		header[21] = byte(length >> 8)
+		header[22] = byte(length >> 16)
+		header[23] = byte(len(fileName))
+		copy(header[24:], fileName)
+		// GS/OS high bytes of the size in blocks and end of file
+		binary.LittleEndian.PutUint16(header[114:], uint16(blocks>>16))
+		header[116] = byte(length >> 24)
+		binary.LittleEndian.PutUint32(header[117:], uint32(totalBlocks))
+		header[126] = binaryIIVersion
+		header[127] = byte(len(files) - i - 1)
+
+		padding := (binaryIIHeaderSize - length%binaryIIHeaderSize) % binaryIIHeaderSize
+		_, err := writer.Write(append(append(header, file.Data...), make([]byte, padding)...))
+		if err != nil {
+			return fmt.Errorf("failed to write Binary II archive: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// AddFilesFromBinaryII writes the files of a Binary II archive to the
+// specified path keeping their file type, aux type, access and dates,
+// creating subdirectories as needed
+func AddFilesFromBinaryII(readerWriter ReaderWriterAt, files []BinaryIIFile, path string, options WriteFileOptions) error {
+	path, err := makeFullPath(strings.ToUpper(path), readerWriter)
+	if err != nil {
+		return err
+	}
+	path = strings.TrimSuffix(path, "/")
+
+	for _, file := range files {
+		filePath := path + "/" + strings.ToUpper(strings.Trim(file.FileName, "/"))
+		err = createParentDirectories(readerWriter, filePath, path)
+		if err != nil {
+			return err
+		}
+
+		if file.StorageType == StorageDirectory || file.FileType == 0x0F {
+			existingFileEntry, _ := GetFileEntry(readerWriter, filePath)
+			if existingFileEntry.StorageType != StorageDirectory {
+				err = CreateDirectory(readerWriter, filePath)
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		exists, err := fileExists(readerWriter, filePath)
+		if err != nil {
+			return err
+		}
+		if exists && options.IgnoreDuplicates && !options.Overwrite {
+			continue
+		}
+
+		err = WriteFileWithOptions(readerWriter, filePath, file.FileType, file.AuxType,
+			file.CreationTime, file.ModifiedTime, file.Data, options)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.FileName, err)
+		}
+		if exists && options.PreserveAccess {
+			continue
+		}
+
+		err = setFileAccess(readerWriter, filePath, file.Access)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unsqueeze expands a file compressed with the SQ Huffman encoding
+// and run length encoding used by .bqy archives
+func unsqueeze(data []byte) ([]byte, error) {
+	if len(data) < 4 || binary.LittleEndian.Uint16(data) != squeezeMagic {
+		return nil, errors.New("missing squeeze header")
+	}
+	checksum := binary.LittleEndian.Uint16(data[2:])
+
+	// the original file name is stored null terminated
+	position := bytes.IndexByte(data[4:], 0)
+	if position < 0 {
+		return nil, errors.New("truncated squeeze header")
+	}
+	position += 5
+
+	if position+2 > len(data) {
+		return nil, errors.New("truncated squeeze header")
+	}
+	nodeCount := int(binary.LittleEndian.Uint16(data[position:]))
+	position += 2
+	if nodeCount > squeezeMaxNodes || position+nodeCount*4 > len(data) {
+		return nil, errors.New("invalid squeeze tree")
+	}
+
+	// each node has two children, negative values are leaves
+	// holding the one's complement of the value
+	nodes := make([][2]int, nodeCount)
+	for i := 0; i < nodeCount; i++ {
+		nodes[i][0] = int(int16(binary.LittleEndian.Uint16(data[position:])))
+		nodes[i][1] = int(int16(binary.LittleEndian.Uint16(data[position+2:])))
+		position += 4
+		if nodes[i][0] >= nodeCount || nodes[i][1] >= nodeCount {
+			return nil, errors.New("invalid squeeze tree")
+		}
+	}
+
+	var output []byte
+	var lastValue byte
+	repeat := false
+	bitPosition := position * 8
+
+	for nodeCount > 0 {
+		node := 0
+		for node >= 0 {
+			if bitPosition >= len(data)*8 {
+				return nil, errors.New("truncated squeeze data")
+			}
+			bit := int(data[bitPosition/8]>>(bitPosition%8)) & 1
+			bitPosition++
+			node = nodes[node][bit]
+		}
+
+		value := -(node + 1)
+		if value == squeezeEndOfFile {
+			break
+		}
+
+		switch {
+		case repeat:
+			repeat = false
+			if value == 0 {
+				output = append(output, squeezeRepeatCharacter)
+				lastValue = squeezeRepeatCharacter
+				continue
+			}
+			// the count includes the byte already output
+			for i := 1; i < value; i++ {
+				output = append(output, lastValue)
+			}
+		case value == squeezeRepeatCharacter:
+			repeat = true
+		default:
+			output = append(output, byte(value))
+			lastValue = byte(value)
+		}
+	}
+
+	sum := uint16(0)
+	for _, value := range output {
+		sum += uint16(value)
+	}
+	if sum != checksum {
+		return nil, errors.New("squeeze checksum mismatch")
+	}
+
+	return output, nil
+}
@@ -0,0 +1,226 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for reading and writing Binary II archives
+
+package prodos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBinaryIIRoundTrip(t *testing.T) {
+	modifiedTime := time.Date(2024, time.June, 7, 8, 9, 0, 0, time.Local)
+	createdTime := time.Date(1991, time.January, 2, 3, 4, 0, 0, time.Local)
+	files := []BinaryIIFile{
+		{FileName: "GAMES", Access: 0xC3, FileType: 0x0F, StorageType: StorageDirectory},
+		{FileName: "GAMES/ARCADE", Access: 0x21, FileType: 0x06, AuxType: 0x0803, Data: bytes.Repeat([]byte{0xA9, 0x00}, 700)},
+		{FileName: "README", Access: 0xE3, FileType: 0x04, Data: []byte("HELLO WORLD\r")},
+	}
+	for i := range files {
+		files[i].CreationTime = createdTime
+		files[i].ModifiedTime = modifiedTime
+	}
+
+	var buffer bytes.Buffer
+	err := WriteBinaryII(&buffer, files)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if buffer.Len()%128 != 0 {
+		t.Errorf("got archive of %d bytes, want multiple of 128", buffer.Len())
+	}
+	if !IsBinaryIIArchive(bytes.NewReader(buffer.Bytes())) {
+		t.Fatalf("got IsBinaryIIArchive false, want true")
+	}
+
+	gotFiles, err := ReadBinaryII(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(gotFiles) != len(files) {
+		t.Fatalf("got %d files, want %d", len(gotFiles), len(files))
+	}
+	for i, file := range files {
+		got := gotFiles[i]
+		if got.FileName != file.FileName || got.FileType != file.FileType ||
+			got.AuxType != file.AuxType || got.Access != file.Access {
+			t.Errorf("got %s %02X %04X %02X, want %s %02X %04X %02X",
+				got.FileName, got.FileType, got.AuxType, got.Access,
+				file.FileName, file.FileType, file.AuxType, file.Access)
+		}
+		if !got.ModifiedTime.Equal(modifiedTime) || !got.CreationTime.Equal(createdTime) {
+			t.Errorf("got dates %s %s", got.CreationTime, got.ModifiedTime)
+		}
+		if !bytes.Equal(got.Data, file.Data) {
+			t.Errorf("data of %s does not match", file.FileName)
+		}
+	}
+
+	hostFile := filepath.Join(t.TempDir(), "archive.bny")
+	os.WriteFile(hostFile, buffer.Bytes(), 0644)
+
+	volume := NewMemoryFile(0x2000000)
+	CreateVolume(volume, "bny", 2048)
+	err = WriteFileFromFile(volume, "/bny/", 0, 0, time.Now(), hostFile, nil, false)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	fileEntry, err := GetFileEntry(volume, "/bny/games/arcade")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if fileEntry.FileType != 0x06 || fileEntry.AuxType != 0x0803 || fileEntry.Access != 0x21 ||
+		!fileEntry.ModifiedTime.Equal(modifiedTime) || !fileEntry.CreationTime.Equal(createdTime) {
+		t.Errorf("got %02X %04X %02X %s %s", fileEntry.FileType, fileEntry.AuxType,
+			fileEntry.Access, fileEntry.CreationTime, fileEntry.ModifiedTime)
+	}
+	gotFile, _ := LoadFile(volume, "/bny/readme")
+	if !bytes.Equal(gotFile, files[2].Data) {
+		t.Errorf("file written from archive does not match")
+	}
+}
+
+func TestReadSqueezedBinaryII(t *testing.T) {
+	squeezed, want := squeezedTestData()
+
+	var buffer bytes.Buffer
+	WriteBinaryII(&buffer, []BinaryIIFile{{FileName: "HELLO", Access: 0xE3, FileType: 0x04, Data: squeezed}})
+	archive := buffer.Bytes()
+	archive[125] = binaryIIFlagSqueezed
+
+	gotFiles, err := ReadBinaryII(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if !bytes.Equal(gotFiles[0].Data, want) {
+		t.Errorf("got %q, want %q", gotFiles[0].Data, want)
+	}
+
+	archive[128+2] ^= 0xFF
+	_, err = ReadBinaryII(bytes.NewReader(archive), int64(len(archive)))
+	if err == nil {
+		t.Errorf("got no error for checksum mismatch")
+	}
+}
+
+func TestBinaryIIHeaderLayout(t *testing.T) {
+	modifiedTime := time.Date(2024, time.June, 7, 8, 9, 0, 0, time.Local)
+	readme := []byte("HELLO WORLD\r")
+	squeezed, want := squeezedTestData()
+
+	// a file, a phantom file and a squeezed file
+	var archive []byte
+	archive = append(archive, binaryIITestHeader("README", len(readme), 0, 0, 2)...)
+	archive = append(archive, readme...)
+	archive = append(archive, make([]byte, 128-len(readme))...)
+	archive = append(archive, binaryIITestHeader("PHANTOM", 0, 1, 0, 1)...)
+	archive = append(archive, binaryIITestHeader("HELLO", len(squeezed), 0, 0x80, 0)...)
+	archive = append(archive, squeezed...)
+	archive = append(archive, make([]byte, 128-len(squeezed))...)
+
+	gotFiles, err := ReadBinaryII(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(gotFiles) != 2 || gotFiles[0].FileName != "README" || gotFiles[1].FileName != "HELLO" {
+		t.Fatalf("got %d files, want README and HELLO", len(gotFiles))
+	}
+	if !bytes.Equal(gotFiles[0].Data, readme) || !bytes.Equal(gotFiles[1].Data, want) {
+		t.Errorf("got %q and %q, want %q and %q", gotFiles[0].Data, gotFiles[1].Data, readme, want)
+	}
+	if gotFiles[0].FileType != 0x04 || gotFiles[0].Access != 0xE3 || !gotFiles[0].ModifiedTime.Equal(modifiedTime) {
+		t.Errorf("got %02X %02X %s, want 04 E3 %s", gotFiles[0].FileType, gotFiles[0].Access, gotFiles[0].ModifiedTime, modifiedTime)
+	}
+
+	var buffer bytes.Buffer
+	WriteBinaryII(&buffer, []BinaryIIFile{{FileName: "README", Access: 0xE3, FileType: 0x04,
+		StorageType: StorageSeedling, CreationTime: modifiedTime, ModifiedTime: modifiedTime, Data: readme}})
+	wantHeader := binaryIITestHeader("README", len(readme), 0, 0, 0)
+	if !bytes.Equal(buffer.Bytes()[:128], wantHeader) {
+		t.Errorf("got header\n% X\nwant\n% X", buffer.Bytes()[:128], wantHeader)
+	}
+}
+
+// binaryIITestHeader builds a header for a text file modified and created
+// on June 7, 2024 at 08:09 at the offsets of the Binary II specification
+func binaryIITestHeader(fileName string, length int, phantom byte, flags byte, filesToFollow byte) []byte {
+	header := make([]byte, 128)
+	copy(header[0:], []byte{0x0A, 0x47, 0x4C})        // +000 ID bytes
+	header[3] = 0xE3                                  // +003 access
+	header[4] = 0x04                                  // +004 file type
+	header[7] = 0x01                                  // +007 storage type
+	header[8] = byte((length + 511) / 512)            // +008 size in blocks
+	copy(header[10:], []byte{0xC7, 0x30, 0x09, 0x08}) // +010 modified date and time
+	copy(header[14:], []byte{0xC7, 0x30, 0x09, 0x08}) // +014 created date and time
+	header[18] = 0x02                                 // +018 ID byte
+	header[20] = byte(length)                         // +020 end of file
+	header[23] = byte(len(fileName))                  // +023 file name length
+	copy(header[24:], fileName)                       // +024 file name
+	header[117] = byte((length + 511) / 512)          // +117 disk space needed
+	header[124] = phantom                             // +124 phantom file flag
+	header[125] = flags                               // +125 data flags
+	header[126] = 0x01                                // +126 Binary II version
+	header[127] = filesToFollow                       // +127 files to follow
+	return header
+}
+
+// squeezedTestData returns squeezed data with Huffman codes for a tree of
+// A, B, the repeat marker, a count of five and end of file, giving AAAAAB
+// after run length expansion
+func squeezedTestData() ([]byte, []byte) {
+	codes := [][]int{{0}, {1, 1, 0}, {1, 1, 1, 0}, {1, 0}, {1, 1, 1, 1}}
+	tree := []int16{^int16('A'), 1, ^int16('B'), 2, ^int16(0x90), 3, ^int16(5), ^int16(256)}
+	want := []byte("AAAAAB")
+
+	squeezed := []byte{0x76, 0xFF, 0, 0}
+	checksum := uint16(0)
+	for _, value := range want {
+		checksum += uint16(value)
+	}
+	binary.LittleEndian.PutUint16(squeezed[2:], checksum)
+	squeezed = append(squeezed, []byte("HELLO.TXT\x00")...)
+	squeezed = binary.LittleEndian.AppendUint16(squeezed, uint16(len(tree)/2))
+	for _, node := range tree {
+		squeezed = binary.LittleEndian.AppendUint16(squeezed, uint16(node))
+	}
+	var bits []int
+	for _, code := range codes {
+		bits = append(bits, code...)
+	}
+	encoded := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		encoded[i/8] |= byte(bit << (i % 8))
+	}
+
+	return append(squeezed, encoded...), want
+}
+
+func TestAddFilesFromBinaryIIKeepsSkippedAccess(t *testing.T) {
+	files := []BinaryIIFile{{FileName: "README", FileType: 0x04, Access: 0xE3, Data: []byte("NEW")}}
+	volume := NewMemoryFile(0x2000000)
+	CreateVolume(volume, "target", 2048)
+	WriteFile(volume, "/target/readme", 0x04, 0, time.Now(), time.Now(), []byte("OLD"))
+	access := uint8(AccessRead)
+	SetFileInfo(volume, "/target/readme", FileInfoUpdate{Access: &access})
+
+	err := AddFilesFromBinaryII(volume, files, "", WriteFileOptions{IgnoreDuplicates: true})
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	fileEntry, _ := GetFileEntry(volume, "/target/readme")
+	if fileEntry.Access != AccessRead {
+		t.Errorf("got access %02X, want %02X", fileEntry.Access, AccessRead)
+	}
+	data, _ := LoadFile(volume, "/target/readme")
+	if string(data) != "OLD" {
+		t.Errorf("got %s, want OLD", data)
+	}
+}
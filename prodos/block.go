@@ -8,7 +8,6 @@
 package prodos
 
 import (
-	"errors"
 	"fmt"
 	"io"
 )
@@ -19,8 +18,7 @@ func ReadBlock(reader io.ReaderAt, block uint16) ([]byte, error) {
 
 	_, err := reader.ReadAt(buffer, int64(block)*512)
 	if err != nil {
-		errString := fmt.Sprintf("failed to read block %04X: %s", block, err.Error())
-		err = errors.New(errString)
+		err = fmt.Errorf("failed to read block %04X: %w", block, err)
 	}
 
 	return buffer, err
@@ -30,8 +28,7 @@ func ReadBlock(reader io.ReaderAt, block uint16) ([]byte, error) {
 func WriteBlock(writer io.WriterAt, block uint16, buffer []byte) error {
 	_, err := writer.WriteAt(buffer, int64(block)*512)
 	if err != nil {
-		errString := fmt.Sprintf("failed to write block %04X: %s", block, err.Error())
-		err = errors.New(errString)
+		err = fmt.Errorf("failed to write block %04X: %w", block, err)
 	}
 
 	return err
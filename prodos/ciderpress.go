@@ -0,0 +1,147 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides access to the attribute preserving host file names used
+// by CiderPress II and NuLib2 (NAPS) such as HELLO#fc0801 and ICON#ca0000r
+// along with a .prodosattributes file in each host directory for the access
+// and creation time that do not fit in the names
+
+package prodos
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ciderPressNamePattern = regexp.MustCompile("^(.+)#([0-9A-Fa-f]{2})([0-9A-Fa-f]{4})([rR]?)$")
+
+const (
+	ciderPressAttributesFileName = ".prodosattributes"
+	ciderPressTimeLayout         = "2006-01-02T15:04"
+)
+
+// ciderPressAttributes has the attributes of a file that are not part of
+// its CiderPress host file name
+type ciderPressAttributes struct {
+	Access       uint8
+	CreationTime time.Time
+}
+
+// GetCiderPressName returns the host file name of a ProDOS file with its file
+// type and aux type appended, ending in r for the resource fork of a file
+func GetCiderPressName(fileName string, fileType uint8, auxType uint16, resourceFork bool) string {
+	hostFileName := fmt.Sprintf("%s#%02x%04x", fileName, fileType, auxType)
+	if resourceFork {
+		hostFileName += "r"
+	}
+
+	return hostFileName
+}
+
+// ParseCiderPressName returns the ProDOS file name, file type, aux type and
+// whether the host file holds a resource fork, the last value is false if
+// the host file name does not have a CiderPress attribute suffix
+func ParseCiderPressName(hostFileName string) (string, uint8, uint16, bool, bool) {
+	match := ciderPressNamePattern.FindStringSubmatch(hostFileName)
+	if match == nil {
+		return "", 0, 0, false, false
+	}
+
+	fileType, _ := strconv.ParseUint(match[2], 16, 8)
+	auxType, _ := strconv.ParseUint(match[3], 16, 16)
+
+	return strings.ToUpper(match[1]), uint8(fileType), uint16(auxType), len(match[4]) > 0, true
+}
+
+// writeCiderPressAttributes writes the access and creation time of the files
+// in a host directory with one line per file such as
+// HELLO#fc0801 e3 2024-06-07T08:09
+// the modification time is kept as the modification time of the host file
+func writeCiderPressAttributes(directory string, fileEntries []FileEntry) error {
+	var builder strings.Builder
+	for _, fileEntry := range fileEntries {
+		if fileEntry.StorageType == StorageDirectory {
+			continue
+		}
+		fmt.Fprintf(&builder, "%s %02x %s\n",
+			GetCiderPressName(fileEntry.FileName, fileEntry.FileType, fileEntry.AuxType, false),
+			fileEntry.Access,
+			formatCiderPressTime(fileEntry.CreationTime))
+	}
+	if builder.Len() == 0 {
+		return nil
+	}
+
+	err := os.WriteFile(filepath.Join(directory, ciderPressAttributesFileName), []byte(builder.String()), 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write attributes: %w", err)
+	}
+
+	return nil
+}
+
+// readCiderPressAttributes returns the attributes in a host directory by
+// upper case host file name, there are none if the file does not exist
+func readCiderPressAttributes(directory string) (map[string]ciderPressAttributes, error) {
+	attributes := make(map[string]ciderPressAttributes)
+
+	data, err := os.ReadFile(filepath.Join(directory, ciderPressAttributesFileName))
+	if os.IsNotExist(err) {
+		return attributes, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attributes: %w", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			errString := fmt.Sprintf("invalid attributes line: %s", line)
+			return nil, errors.New(errString)
+		}
+		access, err := strconv.ParseUint(fields[1], 16, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid access in attributes: %w", err)
+		}
+		creationTime, err := parseCiderPressTime(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		attributes[strings.ToUpper(fields[0])] = ciderPressAttributes{
+			Access:       uint8(access),
+			CreationTime: creationTime,
+		}
+	}
+
+	return attributes, nil
+}
+
+// formatCiderPressTime returns a time to the minute as ProDOS stores it
+// or a dash if there is no time
+func formatCiderPressTime(dateTime time.Time) string {
+	if dateTime.IsZero() {
+		return "-"
+	}
+	return dateTime.Format(ciderPressTimeLayout)
+}
+
+func parseCiderPressTime(text string) (time.Time, error) {
+	if text == "-" {
+		return time.Time{}, nil
+	}
+	dateTime, err := time.ParseInLocation(ciderPressTimeLayout, text, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time in attributes: %w", err)
+	}
+	return dateTime, nil
+}
@@ -0,0 +1,143 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for CiderPress host file names
+
+package prodos
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCiderPressName(t *testing.T) {
+	var tests = []struct {
+		hostFileName     string
+		wantFileName     string
+		wantFileType     uint8
+		wantAuxType      uint16
+		wantResourceFork bool
+		wantOk           bool
+	}{
+		{"HELLO#fc0801", "HELLO", 0xFC, 0x0801, false, true},
+		{"icon#CA0000r", "ICON", 0xCA, 0x0000, true, true},
+		{"A.B#062000", "A.B", 0x06, 0x2000, false, true},
+		{"HELLO", "", 0, 0, false, false},
+		{"HELLO#fc08", "", 0, 0, false, false},
+		{"#062000", "", 0, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.hostFileName, func(t *testing.T) {
+			fileName, fileType, auxType, resourceFork, ok := ParseCiderPressName(tt.hostFileName)
+			if fileName != tt.wantFileName || fileType != tt.wantFileType || auxType != tt.wantAuxType ||
+				resourceFork != tt.wantResourceFork || ok != tt.wantOk {
+				t.Errorf("got %s %02X %04X %t %t, want %s %02X %04X %t %t",
+					fileName, fileType, auxType, resourceFork, ok,
+					tt.wantFileName, tt.wantFileType, tt.wantAuxType, tt.wantResourceFork, tt.wantOk)
+			}
+			if ok {
+				got := GetCiderPressName(fileName, fileType, auxType, resourceFork)
+				if !strings.EqualFold(got, tt.hostFileName) {
+					t.Errorf("got %s, want %s", got, tt.hostFileName)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractFilesToHostDirectoryRoundTrip(t *testing.T) {
+	creationTime := time.Date(2021, time.December, 24, 23, 59, 0, 0, time.Local)
+	modifiedTime := time.Date(2022, time.February, 3, 4, 5, 0, 0, time.Local)
+	source := NewMemoryFile(0x2000000)
+	CreateVolume(source, "source", 2048)
+	CreateDirectory(source, "/source/games")
+	WriteFile(source, "/source/startup", 0xFC, 0x0801, creationTime, modifiedTime, []byte{0x00, 0x08, 0x0A, 0x00, 0xBA, 0x00})
+	WriteFile(source, "/source/games/arcade", 0x06, 0x4000, creationTime, modifiedTime, bytes.Repeat([]byte{0xEA}, 3000))
+	WriteFile(source, "/source/empty", 0x04, 0x0000, creationTime, modifiedTime, []byte{})
+	WriteForkedFile(source, "/source/icon", 0xCA, 0x0000, creationTime, modifiedTime, []byte{1, 2, 3}, []byte{4, 5, 6, 7}, nil, WriteFileOptions{})
+	setFileAccess(source, "/source/startup", 0x21)
+	setFileAccess(source, "/source/games/arcade", 0xC7)
+	setFileAccess(source, "/source/empty", 0x41)
+
+	directory := t.TempDir()
+	err := ExtractFilesToHostDirectory(source, "", directory, ExtractOptions{Recursive: true})
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	for _, hostFileName := range []string{"STARTUP#fc0801", "EMPTY#040000", "ICON#ca0000", "ICON#ca0000r", "GAMES/ARCADE#064000"} {
+		info, err := os.Stat(filepath.Join(directory, hostFileName))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if !info.ModTime().Equal(modifiedTime) {
+			t.Errorf("got %s modified %s, want %s", hostFileName, info.ModTime(), modifiedTime)
+		}
+	}
+
+	target := NewMemoryFile(0x2000000)
+	CreateVolume(target, "target", 2048)
+	err = AddFilesFromHostDirectory(target, directory, "", true)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	for _, path := range []string{"STARTUP", "EMPTY", "ICON", "GAMES/ARCADE"} {
+		want, _ := GetFileEntry(source, "/source/"+path)
+		got, err := GetFileEntry(target, "/target/"+path)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if got.FileType != want.FileType || got.AuxType != want.AuxType || got.Access != want.Access ||
+			got.StorageType != want.StorageType || !got.ModifiedTime.Equal(want.ModifiedTime) ||
+			!got.CreationTime.Equal(want.CreationTime) {
+			t.Errorf("got %s %02X %04X %02X %d %s %s, want %02X %04X %02X %d %s %s", path,
+				got.FileType, got.AuxType, got.Access, got.StorageType, got.CreationTime, got.ModifiedTime,
+				want.FileType, want.AuxType, want.Access, want.StorageType, want.CreationTime, want.ModifiedTime)
+		}
+
+		wantData, wantResource, _, _ := LoadFileForks(source, "/source/"+path)
+		gotData, gotResource, _, _ := LoadFileForks(target, "/target/"+path)
+		if !bytes.Equal(gotData, wantData) || !bytes.Equal(gotResource, wantResource) {
+			t.Errorf("%s does not match", path)
+		}
+	}
+}
+
+func TestAddFilesFromHostDirectorySkipsCiderPressDuplicates(t *testing.T) {
+	source := NewMemoryFile(0x2000000)
+	CreateVolume(source, "source", 2048)
+	WriteFile(source, "/source/readme", 0x04, 0x0000, time.Now(), time.Now(), []byte("NEW"))
+	setFileAccess(source, "/source/readme", 0x21)
+
+	directory := t.TempDir()
+	err := ExtractFilesToHostDirectory(source, "", directory, ExtractOptions{})
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	target := NewMemoryFile(0x2000000)
+	CreateVolume(target, "target", 2048)
+	WriteFile(target, "/target/readme", 0x04, 0x0000, time.Now(), time.Now(), []byte("OLD"))
+	setFileAccess(target, "/target/readme", 0xC3)
+
+	err = AddFilesFromHostDirectory(target, directory, "", false)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	fileEntry, _ := GetFileEntry(target, "/target/readme")
+	if fileEntry.Access != 0xC3 {
+		t.Errorf("got access %02X, want C3", fileEntry.Access)
+	}
+	data, _ := LoadFile(target, "/target/readme")
+	if string(data) != "OLD" {
+		t.Errorf("got %s, want OLD", data)
+	}
+}
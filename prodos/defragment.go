@@ -0,0 +1,358 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides defragmenting of a ProDOS drive image so each file
+// is in a contiguous run of blocks with the free space at the end
+
+package prodos
+
+import (
+	"fmt"
+	"io"
+)
+
+// DefragmentOptions controls how Defragment lays out a volume
+type DefragmentOptions struct {
+	// Directories moves subdirectories as well as files, the
+	// volume directory always stays where it is
+	Directories bool
+}
+
+// DefragmentReport is the result of defragmenting a volume with the
+// fragmentation score before and after as returned by GetFragmentationScore
+type DefragmentReport struct {
+	ScoreBefore float64
+	ScoreAfter  float64
+	BlocksMoved int
+}
+
+const (
+	blockRoleData = iota
+	blockRoleIndex
+	blockRoleExtendedKey
+	blockRoleDirectory
+)
+
+// blockLayout is every block in use on a volume with the role of
+// each block and the blocks of each file in the order they are read
+type blockLayout struct {
+	totalBlocks uint16
+	fixed       map[uint16]bool
+	roles       map[uint16]int
+	files       []layoutFile
+}
+
+type layoutFile struct {
+	blocks []uint16
+	fixed  bool
+}
+
+// GetFragmentationScore returns the percentage of blocks in files and
+// directories that do not follow on from the previous block of the same
+// file, so 0 means every file is contiguous
+func GetFragmentationScore(reader io.ReaderAt) (float64, error) {
+	layout, err := readBlockLayout(reader, DefragmentOptions{Directories: true})
+	if err != nil {
+		return 0, err
+	}
+
+	return layout.fragmentationScore(), nil
+}
+
+// Defragment rewrites the files and optionally the directories of a
+// volume into contiguous runs of blocks packed at the start of the
+// volume, leaving all of the free space at the end. Index blocks,
+// key pointers and directory links are updated for the new locations.
+// Deleted entries are cleared as the blocks they point to are reused.
+// The volume must pass Verify first as blocks that are not referenced
+// by any file would be overwritten.
+func Defragment(readerWriter ReaderWriterAt, options DefragmentOptions) (DefragmentReport, error) {
+	return defragment(readerWriter, options, nil)
+}
+
+// defragment lays out the volume keeping the reserved blocks free
+func defragment(readerWriter ReaderWriterAt, options DefragmentOptions, reservedBlocks []uint16) (DefragmentReport, error) {
+	verifyReport, err := Verify(readerWriter)
+	if err != nil {
+		return DefragmentReport{}, err
+	}
+	if verifyReport.HasProblems() {
+		return DefragmentReport{}, fmt.Errorf("%w, volume has %d problems, run repair first", ErrCorrupt, len(verifyReport.Problems))
+	}
+
+	layout, err := readBlockLayout(readerWriter, options)
+	if err != nil {
+		return DefragmentReport{}, err
+	}
+
+	report := DefragmentReport{ScoreBefore: layout.fragmentationScore()}
+	for _, block := range reservedBlocks {
+		layout.fixed[block] = true
+	}
+
+	// place the blocks of each file that can move one after another
+	// skipping over blocks that stay where they are
+	newBlocks := make(map[uint16]uint16)
+	nextBlock := uint16(0)
+	for _, file := range layout.files {
+		if file.fixed {
+			continue
+		}
+		for _, block := range file.blocks {
+			for layout.fixed[nextBlock] {
+				nextBlock++
+			}
+			newBlocks[block] = nextBlock
+			if block != nextBlock {
+				report.BlocksMoved++
+			}
+			nextBlock++
+		}
+	}
+	moveBlock := func(block uint16) uint16 {
+		if newBlock, moved := newBlocks[block]; moved {
+			return newBlock
+		}
+		return block
+	}
+
+	// every block is read before any are written as the new
+	// location of one block is often the old location of another
+	buffers := make(map[uint16][]byte)
+	for block, role := range layout.roles {
+		buffer, err := ReadBlock(readerWriter, block)
+		if err != nil {
+			return DefragmentReport{}, err
+		}
+		switch role {
+		case blockRoleIndex:
+			for i := 0; i < 256; i++ {
+				movePointer(buffer, i, i+256, moveBlock)
+			}
+		case blockRoleExtendedKey:
+			movePointer(buffer, 0x001, 0x002, moveBlock)
+			movePointer(buffer, 0x101, 0x102, moveBlock)
+		case blockRoleDirectory:
+			moveDirectoryBlockPointers(buffer, moveBlock)
+		}
+		buffers[moveBlock(block)] = buffer
+	}
+
+	volumeBitmap, err := ReadVolumeBitmap(readerWriter)
+	if err != nil {
+		return DefragmentReport{}, err
+	}
+	for block := uint16(0); block < layout.totalBlocks; block++ {
+		_, used := buffers[block]
+		if used || layout.fixed[block] {
+			markBlockInVolumeBitmap(volumeBitmap, block)
+		} else {
+			freeBlockInVolumeBitmap(volumeBitmap, block)
+		}
+	}
+	for _, block := range reservedBlocks {
+		if block < layout.totalBlocks {
+			freeBlockInVolumeBitmap(volumeBitmap, block)
+		}
+	}
+
+	for block, buffer := range buffers {
+		err = WriteBlock(readerWriter, block, buffer)
+		if err != nil {
+			return DefragmentReport{}, err
+		}
+	}
+	err = writeVolumeBitmap(readerWriter, volumeBitmap)
+	if err != nil {
+		return DefragmentReport{}, err
+	}
+
+	layout, err = readBlockLayout(readerWriter, options)
+	if err != nil {
+		return DefragmentReport{}, err
+	}
+	report.ScoreAfter = layout.fragmentationScore()
+
+	return report, nil
+}
+
+// movePointer updates a block pointer split into low and high bytes
+func movePointer(buffer []byte, low int, high int, moveBlock func(uint16) uint16) {
+	block := uint16(buffer[low]) + uint16(buffer[high])*256
+	if block == 0 {
+		return
+	}
+	block = moveBlock(block)
+	buffer[low] = byte(block)
+	buffer[high] = byte(block >> 8)
+}
+
+// moveDirectoryBlockPointers updates the links, parent block and the
+// key and header pointers of each entry in a directory block
+func moveDirectoryBlockPointers(buffer []byte, moveBlock func(uint16) uint16) {
+	movePointer(buffer, 0x00, 0x01, moveBlock)
+	movePointer(buffer, 0x02, 0x03, moveBlock)
+
+	entryOffset := 4
+	if buffer[0x04]>>4 == 0x0F || buffer[0x04]>>4 == 0x0E {
+		if buffer[0x04]>>4 == 0x0E {
+			movePointer(buffer, 0x27, 0x28, moveBlock)
+		}
+		entryOffset += 39
+	}
+
+	for ; entryOffset+39 <= 512; entryOffset += 39 {
+		if buffer[entryOffset]>>4 == StorageDeleted {
+			// the blocks of a deleted entry are about to be reused
+			copy(buffer[entryOffset:entryOffset+39], make([]byte, 39))
+			continue
+		}
+		movePointer(buffer, entryOffset+0x11, entryOffset+0x12, moveBlock)
+		movePointer(buffer, entryOffset+0x25, entryOffset+0x26, moveBlock)
+	}
+}
+
+// readBlockLayout follows every directory and file from the volume
+// directory to find the role of each block in use
+func readBlockLayout(reader io.ReaderAt, options DefragmentOptions) (blockLayout, error) {
+	buffer, err := ReadBlock(reader, 2)
+	if err != nil {
+		return blockLayout{}, err
+	}
+	volumeHeader := parseVolumeHeader(buffer)
+
+	layout := blockLayout{
+		totalBlocks: volumeHeader.TotalBlocks,
+		fixed:       map[uint16]bool{0: true, 1: true},
+		roles:       make(map[uint16]int),
+	}
+	bitmapBlocks := (uint32(volumeHeader.TotalBlocks) + 4095) / 4096
+	for i := uint16(0); i < uint16(bitmapBlocks); i++ {
+		layout.fixed[volumeHeader.BitmapStartBlock+i] = true
+	}
+
+	err = layout.addDirectory(reader, 2, true, options)
+	return layout, err
+}
+
+func (layout *blockLayout) addDirectory(reader io.ReaderAt, keyBlock uint16, fixed bool, options DefragmentOptions) error {
+	_, fileEntries, err := readDirectoryEntries(reader, keyBlock)
+	if err != nil {
+		return err
+	}
+	blocks, err := getDirectoryBlocks(reader, keyBlock)
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		layout.roles[block] = blockRoleDirectory
+		if fixed {
+			layout.fixed[block] = true
+		}
+	}
+	layout.files = append(layout.files, layoutFile{blocks: blocks, fixed: fixed})
+
+	for _, fileEntry := range fileEntries {
+		var fileBlocks []uint16
+		switch fileEntry.StorageType {
+		case StorageSeedling, StorageSapling, StorageTree:
+			fileBlocks, err = layout.addFileBlocks(reader, fileEntry.StorageType, fileEntry.KeyPointer, nil)
+		case StorageExtended:
+			fileBlocks, err = layout.addExtendedFileBlocks(reader, fileEntry.KeyPointer)
+		case StorageDirectory:
+			err = layout.addDirectory(reader, fileEntry.KeyPointer, !options.Directories, options)
+		default:
+			err = &PathError{Op: "defragment", Path: fileEntry.FileName, Block: fileEntry.KeyPointer, Err: ErrUnsupportedStorage}
+		}
+		if err != nil {
+			return err
+		}
+		if len(fileBlocks) > 0 {
+			layout.files = append(layout.files, layoutFile{blocks: fileBlocks})
+		}
+	}
+
+	return nil
+}
+
+func (layout *blockLayout) addExtendedFileBlocks(reader io.ReaderAt, keyBlock uint16) ([]uint16, error) {
+	buffer, err := ReadBlock(reader, keyBlock)
+	if err != nil {
+		return nil, err
+	}
+	layout.roles[keyBlock] = blockRoleExtendedKey
+	fileBlocks := []uint16{keyBlock}
+
+	for _, offset := range []int{0x000, 0x100} {
+		forkEntry := parseForkEntry(buffer[offset:])
+		fileBlocks, err = layout.addFileBlocks(reader, forkEntry.StorageType, forkEntry.KeyPointer, fileBlocks)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return fileBlocks, nil
+}
+
+// addFileBlocks appends the blocks of a seedling, sapling or tree with
+// each index block followed by the data blocks it points to
+func (layout *blockLayout) addFileBlocks(reader io.ReaderAt, storageType uint8, keyBlock uint16, fileBlocks []uint16) ([]uint16, error) {
+	if storageType == StorageSeedling {
+		layout.roles[keyBlock] = blockRoleData
+		return append(fileBlocks, keyBlock), nil
+	}
+
+	indexBlocks := []uint16{keyBlock}
+	if storageType == StorageTree {
+		masterIndex, err := ReadBlock(reader, keyBlock)
+		if err != nil {
+			return nil, err
+		}
+		layout.roles[keyBlock] = blockRoleIndex
+		fileBlocks = append(fileBlocks, keyBlock)
+		indexBlocks = nil
+		for i := 0; i < 128; i++ {
+			indexBlock := uint16(masterIndex[i]) + uint16(masterIndex[i+256])*256
+			if indexBlock != 0 {
+				indexBlocks = append(indexBlocks, indexBlock)
+			}
+		}
+	}
+
+	for _, indexBlock := range indexBlocks {
+		index, err := ReadBlock(reader, indexBlock)
+		if err != nil {
+			return nil, err
+		}
+		layout.roles[indexBlock] = blockRoleIndex
+		fileBlocks = append(fileBlocks, indexBlock)
+		for i := 0; i < 256; i++ {
+			dataBlock := uint16(index[i]) + uint16(index[i+256])*256
+			if dataBlock != 0 {
+				layout.roles[dataBlock] = blockRoleData
+				fileBlocks = append(fileBlocks, dataBlock)
+			}
+		}
+	}
+
+	return fileBlocks, nil
+}
+
+func (layout *blockLayout) fragmentationScore() float64 {
+	following := 0
+	breaks := 0
+	for _, file := range layout.files {
+		for i := 1; i < len(file.blocks); i++ {
+			following++
+			if file.blocks[i] != file.blocks[i-1]+1 {
+				breaks++
+			}
+		}
+	}
+	if following == 0 {
+		return 0
+	}
+
+	return float64(breaks) * 100 / float64(following)
+}
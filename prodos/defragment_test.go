@@ -0,0 +1,109 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for defragmenting a volume
+
+package prodos
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func createFragmentedVolume() *MemoryFile {
+	volume := NewMemoryFile(0x2000000)
+	CreateVolume(volume, "frag", 2048)
+	CreateDirectory(volume, "/frag/docs")
+	for i := 0; i < 8; i++ {
+		WriteFile(volume, "/frag/filler"+string(rune('A'+i)), 0x06, 0, time.Now(), time.Now(), bytes.Repeat([]byte{byte(i)}, 1000))
+	}
+	for i := 0; i < 8; i += 2 {
+		DeleteFile(volume, "/frag/filler"+string(rune('A'+i)))
+	}
+	WriteFile(volume, "/frag/docs/medium", 0x06, 0x2000, time.Now(), time.Now(), bytes.Repeat([]byte{0x11}, 5000))
+	WriteFile(volume, "/frag/large", 0x06, 0x0000, time.Now(), time.Now(), bytes.Repeat([]byte{0x22}, 200000))
+	WriteForkedFile(volume, "/frag/forked", 0xB3, 0, time.Now(), time.Now(), []byte{1}, bytes.Repeat([]byte{0x33}, 1000), nil, WriteFileOptions{})
+	for i := 1; i < 8; i += 2 {
+		DeleteFile(volume, "/frag/filler"+string(rune('A'+i)))
+	}
+	WriteFile(volume, "/frag/docs/last", 0x04, 0, time.Now(), time.Now(), bytes.Repeat([]byte{0x44}, 3000))
+	return volume
+}
+
+func TestDefragment(t *testing.T) {
+	paths := []string{"/frag/docs/medium", "/frag/large", "/frag/forked", "/frag/docs/last"}
+
+	var tests = []struct {
+		testName string
+		options  DefragmentOptions
+	}{
+		{"files", DefragmentOptions{}},
+		{"directories", DefragmentOptions{Directories: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			volume := createFragmentedVolume()
+			var wantData, wantResource [][]byte
+			for _, path := range paths {
+				dataFork, resourceFork, _, _ := LoadFileForks(volume, path)
+				wantData = append(wantData, dataFork)
+				wantResource = append(wantResource, resourceFork)
+			}
+			volumeBitmap, _ := ReadVolumeBitmap(volume)
+			wantFreeBlocks := GetFreeBlockCount(volumeBitmap, 2048)
+
+			report, err := Defragment(volume, tt.options)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if report.ScoreBefore == 0 || report.ScoreAfter >= report.ScoreBefore || report.BlocksMoved == 0 {
+				t.Errorf("got score before %f after %f with %d blocks moved", report.ScoreBefore, report.ScoreAfter, report.BlocksMoved)
+			}
+
+			verifyReport, _ := Verify(volume)
+			if verifyReport.HasProblems() {
+				t.Errorf("got problems %v", verifyReport.Problems)
+			}
+			for i, path := range paths {
+				dataFork, resourceFork, _, err := LoadFileForks(volume, path)
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+				if !bytes.Equal(dataFork, wantData[i]) || !bytes.Equal(resourceFork, wantResource[i]) {
+					t.Errorf("got %s data that does not match", path)
+				}
+			}
+
+			// the free blocks are all at the end of the volume
+			volumeBitmap, _ = ReadVolumeBitmap(volume)
+			freeBlocks := GetFreeBlockCount(volumeBitmap, 2048)
+			if freeBlocks != wantFreeBlocks {
+				t.Errorf("got %d free blocks, want %d", freeBlocks, wantFreeBlocks)
+			}
+			for block := 2048 - freeBlocks; block < 2048; block++ {
+				if !checkFreeBlockInVolumeBitmap(volumeBitmap, block) {
+					t.Fatalf("got block %04X used, want free space at end", block)
+				}
+			}
+
+			score, _ := GetFragmentationScore(volume)
+			if score != report.ScoreAfter {
+				t.Errorf("got score %f, want %f", score, report.ScoreAfter)
+			}
+		})
+	}
+
+	t.Run("problems", func(t *testing.T) {
+		volume := createFragmentedVolume()
+		volumeBitmap, _ := ReadVolumeBitmap(volume)
+		markBlockInVolumeBitmap(volumeBitmap, 2000)
+		writeVolumeBitmap(volume, volumeBitmap)
+		_, err := Defragment(volume, DefragmentOptions{})
+		if err == nil {
+			t.Errorf("got no error, want error for volume with problems")
+		}
+	})
+}
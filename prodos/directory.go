@@ -59,6 +59,8 @@ const (
 	StorageTree = 3
 	// StoragePascal signifies pascal storage area
 	StoragePascal = 4
+	// StorageExtended signifies file with data and resource forks
+	StorageExtended = 5
 	// StorageDirectory signifies directory
 	StorageDirectory = 13
 )
@@ -86,6 +88,18 @@ type FileEntry struct {
 // ReadDirectory reads the directory information from a specified path
 // on a ProDOS image
 func ReadDirectory(reader io.ReaderAt, path string) (VolumeHeader, DirectoryHeader, []FileEntry, error) {
+	var volumeHeader VolumeHeader
+	var directoryHeader DirectoryHeader
+	var fileEntries []FileEntry
+	err := withVolumeReader(reader, func(volume *Volume) error {
+		var err error
+		volumeHeader, directoryHeader, fileEntries, err = readDirectory(volume, path)
+		return err
+	})
+	return volumeHeader, directoryHeader, fileEntries, err
+}
+
+func readDirectory(reader io.ReaderAt, path string) (VolumeHeader, DirectoryHeader, []FileEntry, error) {
 	buffer, err := ReadBlock(reader, 2)
 	if err != nil {
 		return VolumeHeader{}, DirectoryHeader{}, nil, err
@@ -102,10 +116,13 @@ func ReadDirectory(reader io.ReaderAt, path string) (VolumeHeader, DirectoryHead
 		path = fmt.Sprintf("/%s/%s", volumeHeader.VolumeName, path)
 	}
 
-	path = strings.ToUpper(path)
+	path = strings.ToUpper(strings.TrimSuffix(path, "/"))
 	paths := strings.Split(path, "/")
 
 	directoryHeader, fileEntries, err := getFileEntriesInDirectory(reader, 2, 1, paths)
+	if errors.Is(err, ErrNotFound) {
+		return VolumeHeader{}, DirectoryHeader{}, nil, &PathError{Op: "read directory", Path: path, Err: err}
+	}
 	if err != nil {
 		return VolumeHeader{}, DirectoryHeader{}, nil, err
 	}
@@ -116,8 +133,14 @@ func ReadDirectory(reader io.ReaderAt, path string) (VolumeHeader, DirectoryHead
 // CreateDirectory creates a directory information of a specified path
 // on a ProDOS image
 func CreateDirectory(readerWriter ReaderWriterAt, path string) error {
+	return withVolume(readerWriter, func(volume *Volume) error {
+		return createDirectory(volume, path)
+	})
+}
+
+func createDirectory(readerWriter ReaderWriterAt, path string) error {
 	if len(path) == 0 {
-		return errors.New("cannot create directory without path")
+		return &PathError{Op: "create directory", Path: path, Err: ErrInvalidName}
 	}
 
 	// add volume name if not full path
@@ -130,23 +153,24 @@ func CreateDirectory(readerWriter ReaderWriterAt, path string) error {
 
 	existingFileEntry, _ := GetFileEntry(readerWriter, path)
 	if existingFileEntry.StorageType != StorageDeleted {
-		return errors.New("directory already exists")
+		return &PathError{Op: "create directory", Path: path, Err: ErrExists}
 	}
 
 	fileEntry, err := getFreeFileEntryInDirectory(readerWriter, parentPath)
 	if err != nil {
-		errString := fmt.Sprintf("failed to create directory: %s", err)
-		return errors.New(errString)
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	// get list of blocks to write file to
 	blockList, err := createBlockList(readerWriter, 512)
 	if err != nil {
-		errString := fmt.Sprintf("failed to create directory: %s", err)
-		return errors.New(errString)
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	updateVolumeBitmap(readerWriter, blockList)
+	err = updateVolumeBitmap(readerWriter, blockList)
+	if err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
 
 	fileEntry.FileName = newDirectory
 	fileEntry.BlocksUsed = 1
@@ -168,8 +192,7 @@ func CreateDirectory(readerWriter ReaderWriterAt, path string) error {
 
 	err = incrementFileCount(readerWriter, fileEntry)
 	if err != nil {
-		errString := fmt.Sprintf("failed to create directory: %s", err)
-		return errors.New(errString)
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	directoryEntry := DirectoryHeader{
@@ -186,19 +209,101 @@ func CreateDirectory(readerWriter ReaderWriterAt, path string) error {
 		ActiveFileCount:   0,
 		StartingBlock:     blockList[0],
 		ParentBlock:       fileEntry.DirectoryBlock,
-		ParentEntry:       uint16(fileEntry.DirectoryOffset-0x04) / 0x27,
+		ParentEntry:       directoryEntryNumber(fileEntry.DirectoryOffset),
 		ParentEntryLength: 0x27,
 	}
 
 	err = writeDirectoryHeader(readerWriter, directoryEntry)
 	if err != nil {
-		errString := fmt.Sprintf("failed to create directory: %s", err)
-		return errors.New(errString)
+		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
 	return nil
 }
 
+// DeleteDirectory deletes a directory from a ProDOS volume, when recursive
+// is set all files and subdirectories it contains are deleted as well
+func DeleteDirectory(readerWriter ReaderWriterAt, path string, recursive bool) error {
+	return withVolume(readerWriter, func(volume *Volume) error {
+		return deleteDirectory(volume, path, recursive)
+	})
+}
+
+func deleteDirectory(readerWriter ReaderWriterAt, path string, recursive bool) error {
+	fileEntry, err := GetFileEntry(readerWriter, path)
+	if err != nil {
+		return err
+	}
+	if fileEntry.StorageType != StorageDirectory {
+		return errors.New("path is not a directory")
+	}
+	err = checkDestroyAccess(readerWriter, path, fileEntry, recursive)
+	if err != nil {
+		return err
+	}
+
+	return deleteDirectoryEntry(readerWriter, fileEntry, recursive)
+}
+
+// checkDestroyAccess returns an error if a file or directory cannot be
+// deleted, when recursive is set everything in the directory is checked
+// first so that nothing is deleted if any of it is locked
+func checkDestroyAccess(reader io.ReaderAt, path string, fileEntry FileEntry, recursive bool) error {
+	if fileEntry.Access&AccessDestroy == 0 {
+		return &PathError{Op: "delete", Path: path, Err: ErrLocked}
+	}
+	if fileEntry.StorageType != StorageDirectory || !recursive {
+		return nil
+	}
+
+	_, fileEntries, err := readDirectoryEntries(reader, fileEntry.KeyPointer)
+	if err != nil {
+		return err
+	}
+	for _, childEntry := range fileEntries {
+		err = checkDestroyAccess(reader, path+"/"+childEntry.FileName, childEntry, recursive)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func deleteDirectoryEntry(readerWriter ReaderWriterAt, fileEntry FileEntry, recursive bool) error {
+	_, fileEntries, err := readDirectoryEntries(readerWriter, fileEntry.KeyPointer)
+	if err != nil {
+		return err
+	}
+
+	if len(fileEntries) > 0 && !recursive {
+		errString := fmt.Sprintf("directory %s is not empty", fileEntry.FileName)
+		return errors.New(errString)
+	}
+
+	for i := 0; i < len(fileEntries); i++ {
+		if fileEntries[i].StorageType == StorageDirectory {
+			err = deleteDirectoryEntry(readerWriter, fileEntries[i], recursive)
+		} else {
+			var blocks []uint16
+			blocks, err = getAllBlockList(readerWriter, fileEntries[i])
+			if err == nil {
+				err = removeFileEntry(readerWriter, fileEntries[i], blocks)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	blocks, err := getDirectoryBlocks(readerWriter, fileEntry.KeyPointer)
+	if err != nil {
+		return err
+	}
+
+	return removeFileEntry(readerWriter, fileEntry, blocks)
+}
+
 func makeFullPath(path string, reader io.ReaderAt) (string, error) {
 	if !strings.HasPrefix(path, "/") {
 		buffer, err := ReadBlock(reader, 0x0002)
@@ -231,7 +336,7 @@ func getFreeFileEntryInDirectory(readerWriter ReaderWriterAt, directory string)
 			// if we ran out of blocks in the directory, expand directory or fail
 			if nextBlockNumber == 0 {
 				if !directoryHeader.IsSubDirectory {
-					return FileEntry{}, errors.New("no free file entries found")
+					return FileEntry{}, &PathError{Op: "add entry", Path: directory, Block: blockNumber, Err: ErrDirectoryFull}
 				}
 				nextBlockNumber, err = expandDirectory(readerWriter, buffer, blockNumber, directoryHeader)
 				if err != nil {
@@ -242,7 +347,7 @@ func getFreeFileEntryInDirectory(readerWriter ReaderWriterAt, directory string)
 			// else read the next block in the directory
 			buffer, err = ReadBlock(readerWriter, blockNumber)
 			if err != nil {
-				return FileEntry{}, nil
+				return FileEntry{}, err
 			}
 
 			entryOffset = 4
@@ -264,14 +369,18 @@ func getFreeFileEntryInDirectory(readerWriter ReaderWriterAt, directory string)
 }
 
 func expandDirectory(readerWriter ReaderWriterAt, buffer []byte, blockNumber uint16, directoryHeader DirectoryHeader) (uint16, error) {
+	directoryFileEntry, err := getParentFileEntry(readerWriter, directoryHeader)
+	if err != nil {
+		return 0, err
+	}
+
 	volumeBitMap, err := ReadVolumeBitmap(readerWriter)
 	if err != nil {
-		errString := fmt.Sprintf("failed to get volume bitmap to expand directory: %s", err)
-		return 0, errors.New(errString)
+		return 0, fmt.Errorf("failed to get volume bitmap to expand directory: %w", err)
 	}
 	blockList := findFreeBlocks(volumeBitMap, 1)
 	if len(blockList) != 1 {
-		return 0, errors.New("failed to get free block to expand directory")
+		return 0, fmt.Errorf("failed to get free block to expand directory: %w", ErrDiskFull)
 	}
 
 	nextBlockNumber := blockList[0]
@@ -279,8 +388,7 @@ func expandDirectory(readerWriter ReaderWriterAt, buffer []byte, blockNumber uin
 	buffer[0x03] = byte(nextBlockNumber >> 8)
 	err = WriteBlock(readerWriter, blockNumber, buffer)
 	if err != nil {
-		errString := fmt.Sprintf("failed to write block to expand directory: %s", err)
-		return 0, errors.New(errString)
+		return 0, fmt.Errorf("failed to write block to expand directory: %w", err)
 	}
 
 	buffer = make([]byte, 0x200)
@@ -288,19 +396,14 @@ func expandDirectory(readerWriter ReaderWriterAt, buffer []byte, blockNumber uin
 	buffer[0x01] = byte(blockNumber >> 8)
 	err = WriteBlock(readerWriter, nextBlockNumber, buffer)
 	if err != nil {
-		errString := fmt.Sprintf("failed to write new block to expand directory: %s", err)
-		return 0, errors.New(errString)
+		return 0, fmt.Errorf("failed to write new block to expand directory: %w", err)
 	}
 
-	updateVolumeBitmap(readerWriter, blockList)
-
-	buffer, err = ReadBlock(readerWriter, directoryHeader.ParentBlock)
+	err = updateVolumeBitmap(readerWriter, blockList)
 	if err != nil {
-		errString := fmt.Sprintf("failed to read parent block to expand directory: %s", err)
-		return 0, errors.New(errString)
+		return 0, fmt.Errorf("failed to update volume bitmap to expand directory: %w", err)
 	}
-	directoryEntryOffset := directoryHeader.ParentEntry*uint16(directoryHeader.EntryLength) + 0x04
-	directoryFileEntry := parseFileEntry(buffer[directoryEntryOffset:directoryEntryOffset+0x28], directoryHeader.ParentBlock, directoryHeader.ParentEntry*uint16(directoryHeader.EntryLength)+0x04)
+
 	directoryFileEntry.BlocksUsed++
 	directoryFileEntry.EndOfFile += 0x200
 	err = writeFileEntry(readerWriter, directoryFileEntry)
@@ -311,58 +414,130 @@ func expandDirectory(readerWriter ReaderWriterAt, buffer []byte, blockNumber uin
 	return nextBlockNumber, nil
 }
 
+// getParentFileEntry returns the entry of a subdirectory in its parent
+// directory. ProDOS numbers entries from one with the header as the first
+// entry of the key block but this package used to number them from zero,
+// so the entry before is used if it is the one for the subdirectory.
+func getParentFileEntry(reader io.ReaderAt, directoryHeader DirectoryHeader) (FileEntry, error) {
+	buffer, err := ReadBlock(reader, directoryHeader.ParentBlock)
+	if err != nil {
+		return FileEntry{}, fmt.Errorf("failed to read parent block to expand directory: %w", err)
+	}
+
+	for _, entryNumber := range []uint16{directoryHeader.ParentEntry, directoryHeader.ParentEntry + 1} {
+		if entryNumber < 1 || entryNumber > 0x0D {
+			continue
+		}
+		entryOffset := directoryEntryOffset(entryNumber)
+		fileEntry := parseFileEntry(buffer[entryOffset:entryOffset+0x28], directoryHeader.ParentBlock, entryOffset)
+		if fileEntry.StorageType == StorageDirectory && fileEntry.KeyPointer == directoryHeader.StartingBlock {
+			return fileEntry, nil
+		}
+	}
+
+	return FileEntry{}, &PathError{Op: "expand", Path: directoryHeader.Name, Block: directoryHeader.ParentBlock, Err: ErrCorrupt}
+}
+
+// directoryEntryNumber returns the number ProDOS gives the entry at an
+// offset in a directory block, numbered from one
+func directoryEntryNumber(entryOffset uint16) uint16 {
+	return (entryOffset-0x04)/0x27 + 1
+}
+
+// directoryEntryOffset returns the offset in a directory block of an entry
+func directoryEntryOffset(entryNumber uint16) uint16 {
+	return (entryNumber-1)*0x27 + 0x04
+}
+
 func getFileEntriesInDirectory(reader io.ReaderAt, blockNumber uint16, currentPath int, paths []string) (DirectoryHeader, []FileEntry, error) {
-	buffer, err := ReadBlock(reader, blockNumber)
+	directoryHeader, fileEntries, err := readDirectoryEntries(reader, blockNumber)
 	if err != nil {
 		return DirectoryHeader{}, nil, err
 	}
 
-	directoryHeader := parseDirectoryHeader(buffer, blockNumber)
+	if currentPath >= len(paths) || paths[currentPath] != directoryHeader.Name {
+		return DirectoryHeader{}, nil, ErrNotFound
+	}
 
-	fileEntries := make([]FileEntry, directoryHeader.ActiveFileCount)
-	entryOffset := uint16(43) // start at offset after header
-	activeEntries := uint16(0)
-	entryNumber := uint8(2) // header is essentially the first entry so start at 2
+	if currentPath == len(paths)-1 {
+		return directoryHeader, fileEntries, nil
+	}
 
-	nextBlock := directoryHeader.NextBlock
+	for i := 0; i < len(fileEntries); i++ {
+		if fileEntries[i].StorageType == StorageDirectory && paths[currentPath+1] == fileEntries[i].FileName {
+			return getFileEntriesInDirectory(reader, fileEntries[i].KeyPointer, currentPath+1, paths)
+		}
+	}
 
-	matchedDirectory := (currentPath == len(paths)-1) && (paths[currentPath] == directoryHeader.Name)
+	return DirectoryHeader{}, nil, ErrNotFound
+}
 
-	if !matchedDirectory && (currentPath == len(paths)-1) {
-		// path not matched by last path part
-		return DirectoryHeader{}, nil, errors.New("path not matched")
+// readDirectoryEntries reads the header and all active file entries
+// of the directory starting at the specified key block
+func readDirectoryEntries(reader io.ReaderAt, keyBlock uint16) (DirectoryHeader, []FileEntry, error) {
+	if volume, ok := reader.(*Volume); ok {
+		return volume.cachedDirectoryEntries(keyBlock)
 	}
 
-	for {
-		if entryNumber > 13 {
-			entryOffset = 4
-			entryNumber = 1
-			if blockNumber == 0 {
-				return DirectoryHeader{}, nil, nil
-			}
-			buffer, err = ReadBlock(reader, nextBlock)
-			if err != nil {
-				return DirectoryHeader{}, nil, err
-			}
-			nextBlock = uint16(buffer[2]) + uint16(buffer[3])*256
+	blocks, err := getDirectoryBlocks(reader, keyBlock)
+	if err != nil {
+		return DirectoryHeader{}, nil, err
+	}
+
+	return parseDirectoryBlocks(reader, blocks)
+}
+
+// parseDirectoryBlocks parses the header and all active file
+// entries from the blocks of a directory
+func parseDirectoryBlocks(reader io.ReaderAt, blocks []uint16) (DirectoryHeader, []FileEntry, error) {
+	var directoryHeader DirectoryHeader
+	fileEntries := []FileEntry{}
+
+	for i, blockNumber := range blocks {
+		buffer, err := ReadBlock(reader, blockNumber)
+		if err != nil {
+			return DirectoryHeader{}, nil, err
 		}
-		fileEntry := parseFileEntry(buffer[entryOffset:entryOffset+40], blockNumber, entryOffset)
 
-		if fileEntry.StorageType != StorageDeleted {
-			if matchedDirectory && activeEntries == directoryHeader.ActiveFileCount {
-				return directoryHeader, fileEntries[0:activeEntries], nil
-			}
-			if matchedDirectory {
-				fileEntries[activeEntries] = fileEntry
-			} else if !matchedDirectory && fileEntry.FileType == 15 && paths[currentPath+1] == fileEntry.FileName {
-				return getFileEntriesInDirectory(reader, fileEntry.KeyPointer, currentPath+1, paths)
+		entryOffset := uint16(4)
+		if i == 0 {
+			directoryHeader = parseDirectoryHeader(buffer, blockNumber)
+			// header is essentially the first entry so skip it
+			entryOffset += 39
+		}
+
+		for ; entryOffset+39 <= 512; entryOffset += 39 {
+			fileEntry := parseFileEntry(buffer[entryOffset:entryOffset+39], blockNumber, entryOffset)
+			if fileEntry.StorageType != StorageDeleted {
+				fileEntries = append(fileEntries, fileEntry)
 			}
-			activeEntries++
 		}
+	}
 
-		entryNumber++
-		entryOffset += 39
+	return directoryHeader, fileEntries, nil
+}
+
+// getDirectoryBlocks follows the chain of directory blocks
+// starting from the key block of a directory
+func getDirectoryBlocks(reader io.ReaderAt, keyBlock uint16) ([]uint16, error) {
+	blocks := []uint16{}
+	visited := make(map[uint16]bool)
+
+	for blockNumber := keyBlock; blockNumber != 0; {
+		if visited[blockNumber] {
+			return nil, &PathError{Op: "read directory", Block: blockNumber, Err: fmt.Errorf("directory block linked more than once: %w", ErrCorrupt)}
+		}
+		visited[blockNumber] = true
+		blocks = append(blocks, blockNumber)
+
+		buffer, err := ReadBlock(reader, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+		blockNumber = uint16(buffer[2]) + uint16(buffer[3])*256
 	}
+
+	return blocks, nil
 }
 
 func parseFileEntry(buffer []byte, blockNumber uint16, entryOffset uint16) FileEntry {
@@ -555,7 +730,5 @@ func writeDirectoryHeader(readerWriter ReaderWriterAt, directoryHeader Directory
 	buffer[0x28] = byte(directoryHeader.ParentBlock >> 8)
 	buffer[0x29] = byte(directoryHeader.ParentEntry)
 	buffer[0x2A] = byte(directoryHeader.ParentEntryLength)
-	WriteBlock(readerWriter, directoryHeader.StartingBlock, buffer)
-
-	return nil
+	return WriteBlock(readerWriter, directoryHeader.StartingBlock, buffer)
 }
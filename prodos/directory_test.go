@@ -8,7 +8,10 @@
 package prodos
 
 import (
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 )
 
 func TestCreateDirectoryWithoutPathFails(t *testing.T) {
@@ -77,3 +80,74 @@ func TestCreateAndReadDirectory(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteDirectory(t *testing.T) {
+	var tests = []struct {
+		testName  string
+		path      string
+		recursive bool
+		wantErr   bool
+	}{
+		{"nonEmptyFails", "/test/one", false, true},
+		{"fileFails", "/test/one/file", false, true},
+		{"emptySucceeds", "/test/one/two/three", false, false},
+		{"recursiveSucceeds", "/test/one", true, false},
+		{"missingFails", "/test/one", true, true},
+	}
+
+	file := NewMemoryFile(0x2000000)
+	CreateVolume(file, "test", 1024)
+	volumeBitmap, _ := ReadVolumeBitmap(file)
+	wantFreeBlocks := GetFreeBlockCount(volumeBitmap, 1024)
+
+	CreateDirectory(file, "/test/one")
+	CreateDirectory(file, "/test/one/two")
+	CreateDirectory(file, "/test/one/two/three")
+	WriteFile(file, "/test/one/file", 6, 0x2000, time.Now(), time.Now(), make([]byte, 1000))
+	// enough files to need a second directory block
+	for i := 0; i < 20; i++ {
+		WriteFile(file, fmt.Sprintf("/test/one/two/file%d", i), 6, 0x2000, time.Now(), time.Now(), make([]byte, 100))
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			err := DeleteDirectory(file, tt.path, tt.recursive)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+
+	_, directoryHeader, fileEntries, err := ReadDirectory(file, "/test")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(fileEntries) != 0 || directoryHeader.ActiveFileCount != 0 {
+		t.Errorf("got %d files and count %d, want 0", len(fileEntries), directoryHeader.ActiveFileCount)
+	}
+	volumeBitmap, _ = ReadVolumeBitmap(file)
+	gotFreeBlocks := GetFreeBlockCount(volumeBitmap, 1024)
+	if gotFreeBlocks != wantFreeBlocks {
+		t.Errorf("got %d free blocks, want %d", gotFreeBlocks, wantFreeBlocks)
+	}
+}
+
+func TestDeleteDirectoryWithLockedFile(t *testing.T) {
+	volume := createVerifyVolume()
+	access := uint8(AccessRead)
+	SetFileInfo(volume, "/verify/docs/medium", FileInfoUpdate{Access: &access})
+
+	err := DeleteDirectory(volume, "/verify/docs", true)
+	var pathError *PathError
+	if !errors.As(err, &pathError) || pathError.Op != "delete" || pathError.Path != "/verify/docs/MEDIUM" {
+		t.Fatalf("got error %v, want delete /verify/docs/MEDIUM: %s", err, ErrLocked)
+	}
+
+	_, _, fileEntries, err := ReadDirectory(volume, "/verify/docs")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(fileEntries) != 1 {
+		t.Errorf("got %d files, want 1", len(fileEntries))
+	}
+}
@@ -0,0 +1,115 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides access to DOS 3.3 sector ordered (.do/.dsk)
+// 5.25" floppy images by translating ProDOS blocks to sectors
+
+package prodos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DOSOrderImageSize is the size of a 5.25" floppy image, the only size
+// of drive image that is DOS 3.3 sector ordered
+const DOSOrderImageSize = 143360
+
+// each ProDOS block in a track is made up of two DOS 3.3 logical sectors
+var dosOrderFirstSector = [8]int64{0, 13, 11, 9, 7, 5, 3, 1}
+var dosOrderSecondSector = [8]int64{14, 12, 10, 8, 6, 4, 2, 15}
+
+// DOSOrder is a DOS 3.3 sector ordered drive image that translates
+// ProDOS blocks to sectors so it can be used with all other
+// functions in this package
+type DOSOrder struct {
+	readerWriter ReaderWriterAt
+}
+
+// NewDOSOrder wraps a DOS 3.3 sector ordered drive image
+func NewDOSOrder(readerWriter ReaderWriterAt) *DOSOrder {
+	return &DOSOrder{readerWriter: readerWriter}
+}
+
+// OpenDOSOrder wraps a DOS 3.3 sector ordered drive image of the given
+// size in bytes, returning an error unless it is a 5.25" floppy image
+func OpenDOSOrder(readerWriter ReaderWriterAt, size int64) (*DOSOrder, error) {
+	if size != DOSOrderImageSize {
+		errString := fmt.Sprintf("DOS 3.3 sector order is only used for %d byte 5.25\" floppy images, not %d bytes", DOSOrderImageSize, size)
+		return nil, errors.New(errString)
+	}
+
+	return NewDOSOrder(readerWriter), nil
+}
+
+// ReadAt reads data from the specified ProDOS ordered offset in the image
+func (dosOrder *DOSOrder) ReadAt(data []byte, offset int64) (int, error) {
+	total := 0
+	for total < len(data) {
+		sectorOffset, length := dosOrderSectorOffset(offset+int64(total), len(data)-total)
+		n, err := dosOrder.readerWriter.ReadAt(data[total:total+length], sectorOffset)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// WriteAt writes data to the specified ProDOS ordered offset in the image
+func (dosOrder *DOSOrder) WriteAt(data []byte, offset int64) (int, error) {
+	total := 0
+	for total < len(data) {
+		sectorOffset, length := dosOrderSectorOffset(offset+int64(total), len(data)-total)
+		n, err := dosOrder.readerWriter.WriteAt(data[total:total+length], sectorOffset)
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
+
+// HasVolumeHeader returns true if block 2 of the image contains
+// a valid ProDOS volume directory header
+func HasVolumeHeader(reader io.ReaderAt) bool {
+	buffer, err := ReadBlock(reader, 2)
+	if err != nil {
+		return false
+	}
+
+	return buffer[0x00] == 0 && buffer[0x01] == 0 &&
+		buffer[0x04]>>4 == 0x0F && buffer[0x04]&0x0F > 0 &&
+		buffer[0x23] == 0x27 && buffer[0x24] == 0x0D
+}
+
+// IsDOSOrder probes an image of the given size in bytes that could be
+// either ProDOS or DOS 3.3 sector ordered (such as .dsk) and returns true
+// for a 5.25" floppy image unless a ProDOS volume header is found in
+// ProDOS order, so DOS 3.3 disks are also detected
+func IsDOSOrder(reader io.ReaderAt, size int64) bool {
+	return size == DOSOrderImageSize && !HasVolumeHeader(reader)
+}
+
+// dosOrderSectorOffset returns the offset in the DOS ordered image for a
+// ProDOS ordered offset and how many bytes can be accessed before the
+// next sector boundary
+func dosOrderSectorOffset(offset int64, length int) (int64, int) {
+	block := offset / 512
+	track := block / 8
+	sector := dosOrderFirstSector[block%8]
+	if offset%512 >= 256 {
+		sector = dosOrderSecondSector[block%8]
+	}
+
+	remaining := 256 - int(offset%256)
+	if length > remaining {
+		length = remaining
+	}
+
+	return track*4096 + sector*256 + offset%256, length
+}
@@ -0,0 +1,116 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for DOS 3.3 sector ordered drive images
+
+package prodos
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestDOSOrderSectorOffset(t *testing.T) {
+	var tests = []struct {
+		offset     int64
+		length     int
+		wantOffset int64
+		wantLength int
+	}{
+		{0x0000, 512, 0x0000, 256},
+		{0x0100, 256, 0x0E00, 256},
+		{0x0200, 512, 0x0D00, 256},
+		{0x0300, 256, 0x0C00, 256},
+		{0x0E00, 512, 0x0100, 256},
+		{0x0F00, 256, 0x0F00, 256},
+		{0x1210, 16, 0x1D10, 16},
+		{0x1380, 512, 0x1C80, 128},
+	}
+
+	for _, tt := range tests {
+		testName := fmt.Sprintf("%04X", tt.offset)
+		t.Run(testName, func(t *testing.T) {
+			gotOffset, gotLength := dosOrderSectorOffset(tt.offset, tt.length)
+			if gotOffset != tt.wantOffset {
+				t.Errorf("got offset %04X, want %04X", gotOffset, tt.wantOffset)
+			}
+			if gotLength != tt.wantLength {
+				t.Errorf("got length %d, want %d", gotLength, tt.wantLength)
+			}
+		})
+	}
+}
+
+func TestDOSOrderVolume(t *testing.T) {
+	file := NewMemoryFile(280 * 512)
+	dosOrder := NewDOSOrder(file)
+	CreateVolume(dosOrder, "floppy", 280)
+
+	if HasVolumeHeader(file) {
+		t.Errorf("got volume header in ProDOS order, want none")
+	}
+	if !HasVolumeHeader(dosOrder) {
+		t.Errorf("got no volume header in DOS order, want one")
+	}
+	if !IsDOSOrder(file, DOSOrderImageSize) {
+		t.Errorf("got IsDOSOrder false, want true")
+	}
+
+	// block 2 is made up of DOS sectors 11 and 10 on track 0
+	block, _ := ReadBlock(dosOrder, 2)
+	sectors := make([]byte, 512)
+	file.ReadAt(sectors[0:256], 11*256)
+	file.ReadAt(sectors[256:512], 10*256)
+	if !bytes.Equal(block, sectors) {
+		t.Errorf("block 2 does not match DOS sectors 11 and 10")
+	}
+
+	want := make([]byte, 3000)
+	for i := 0; i < len(want); i++ {
+		want[i] = byte(i)
+	}
+	err := WriteFile(dosOrder, "/floppy/test", 0x06, 0x2000, time.Now(), time.Now(), want)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	got, err := LoadFile(dosOrder, "/floppy/test")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("file read back through DOS order does not match")
+	}
+
+	prodosOrder := NewMemoryFile(280 * 512)
+	CreateVolume(prodosOrder, "floppy", 280)
+	if IsDOSOrder(prodosOrder, DOSOrderImageSize) {
+		t.Errorf("got IsDOSOrder true for ProDOS order image, want false")
+	}
+	if IsDOSOrder(NewMemoryFile(1600*512), 1600*512) {
+		t.Errorf("got IsDOSOrder true for 800K image, want false")
+	}
+}
+
+func TestOpenDOSOrder(t *testing.T) {
+	var tests = []struct {
+		testName string
+		size     int64
+		wantErr  bool
+	}{
+		{"floppy", DOSOrderImageSize, false},
+		{"800K", 1600 * 512, true},
+		{"hardDisk", 65535 * 512, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			_, err := OpenDOSOrder(NewMemoryFile(int(tt.size)), tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %t", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides the errors returned by operations on
+// ProDOS drive images so callers can check them with errors.Is
+
+package prodos
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrNotFound is returned when a file or directory does not exist
+	ErrNotFound = errors.New("file not found")
+	// ErrExists is returned when a file or directory already exists
+	ErrExists = errors.New("file already exists")
+	// ErrDiskFull is returned when there are not enough free blocks
+	ErrDiskFull = errors.New("not enough free blocks")
+	// ErrDirectoryFull is returned when the volume directory has no free
+	// entries, subdirectories are expanded instead
+	ErrDirectoryFull = errors.New("directory is full")
+	// ErrInvalidName is returned when a file or volume name does not
+	// follow ProDOS rules
+	ErrInvalidName = errors.New("invalid name")
+	// ErrLocked is returned when the access bits do not allow the change
+	ErrLocked = errors.New("file is locked")
+	// ErrCorrupt is returned when the structure of a volume is damaged
+	ErrCorrupt = errors.New("volume is corrupt")
+	// ErrUnsupportedStorage is returned for storage types that cannot
+	// be read or written, such as Pascal areas
+	ErrUnsupportedStorage = errors.New("unsupported file storage type")
+)
+
+// PathError records an error with the operation, the path and the block
+// where it happened, the block is zero when it is not known
+type PathError struct {
+	Op    string
+	Path  string
+	Block uint16
+	Err   error
+}
+
+func (e *PathError) Error() string {
+	errString := e.Op
+	if len(e.Path) > 0 {
+		errString += " " + e.Path
+	}
+	if e.Block != 0 {
+		errString += fmt.Sprintf(" block %04X", e.Block)
+	}
+	return errString + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error
+func (e *PathError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,118 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for errors
+
+package prodos
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	var tests = []struct {
+		testName string
+		action   func(volume *MemoryFile) error
+		wantErr  error
+	}{
+		{"notFound", func(volume *MemoryFile) error {
+			return DeleteFile(volume, "/verify/none")
+		}, ErrNotFound},
+		{"directoryNotFound", func(volume *MemoryFile) error {
+			_, _, _, err := ReadDirectory(volume, "/verify/none")
+			return err
+		}, ErrNotFound},
+		{"exists", func(volume *MemoryFile) error {
+			return Rename(volume, "/verify/small", "large")
+		}, ErrExists},
+		{"directoryExists", func(volume *MemoryFile) error {
+			return CreateDirectory(volume, "/verify/docs")
+		}, ErrExists},
+		{"diskFull", func(volume *MemoryFile) error {
+			return WriteFile(volume, "/verify/huge", 0x06, 0x0000, time.Now(), time.Now(), bytes.Repeat([]byte{1}, 0x180000))
+		}, ErrDiskFull},
+		{"directoryFull", func(volume *MemoryFile) error {
+			for i := 0; i < 60; i++ {
+				err := WriteFile(volume, fmt.Sprintf("/verify/file%d", i), 0x04, 0x0000, time.Now(), time.Now(), []byte{})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}, ErrDirectoryFull},
+		{"invalidName", func(volume *MemoryFile) error {
+			return Rename(volume, "/verify/small", "1small")
+		}, ErrInvalidName},
+		{"invalidVolumeName", func(volume *MemoryFile) error {
+			return CreateVolume(NewMemoryFile(0x23000), "bad name", 280)
+		}, ErrInvalidName},
+		{"locked", func(volume *MemoryFile) error {
+			access := uint8(AccessRead)
+			SetFileInfo(volume, "/verify/small", FileInfoUpdate{Access: &access})
+			_, err := OpenFile(volume, "/verify/small", os.O_WRONLY)
+			return err
+		}, ErrLocked},
+		{"deleteLocked", func(volume *MemoryFile) error {
+			access := uint8(AccessRead | AccessWrite | AccessRename)
+			SetFileInfo(volume, "/verify/small", FileInfoUpdate{Access: &access})
+			return DeleteFile(volume, "/verify/small")
+		}, ErrLocked},
+		{"deleteDirectoryLocked", func(volume *MemoryFile) error {
+			access := uint8(AccessRead)
+			SetFileInfo(volume, "/verify/docs", FileInfoUpdate{Access: &access})
+			return DeleteDirectory(volume, "/verify/docs", true)
+		}, ErrLocked},
+		{"unsupportedStorage", func(volume *MemoryFile) error {
+			fileEntry, _ := GetFileEntry(volume, "/verify/small")
+			fileEntry.StorageType = 4
+			writeFileEntry(volume, fileEntry)
+			_, err := Open(volume, "/verify/small")
+			return err
+		}, ErrUnsupportedStorage},
+		{"corrupt", func(volume *MemoryFile) error {
+			fileEntry, _ := GetFileEntry(volume, "/verify/docs")
+			buffer, _ := ReadBlock(volume, fileEntry.KeyPointer)
+			buffer[2] = byte(fileEntry.KeyPointer)
+			buffer[3] = byte(fileEntry.KeyPointer >> 8)
+			WriteBlock(volume, fileEntry.KeyPointer, buffer)
+			_, _, _, err := ReadDirectory(volume, "/verify/docs")
+			return err
+		}, ErrCorrupt},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			volume := createVerifyVolume()
+			err := tt.action(volume)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPathError(t *testing.T) {
+	volume := createVerifyVolume()
+	fileEntry, _ := GetFileEntry(volume, "/verify/small")
+	fileEntry.StorageType = 4
+	writeFileEntry(volume, fileEntry)
+
+	_, err := Open(volume, "/verify/small")
+	var pathError *PathError
+	if !errors.As(err, &pathError) {
+		t.Fatalf("got error %v, want PathError", err)
+	}
+	if pathError.Path != "/verify/small" || pathError.Block != fileEntry.KeyPointer {
+		t.Errorf("got path %s block %04X, want /verify/small and %04X", pathError.Path, pathError.Block, fileEntry.KeyPointer)
+	}
+	want := fmt.Sprintf("open /verify/small block %04X: unsupported file storage type", fileEntry.KeyPointer)
+	if err.Error() != want {
+		t.Errorf("got %s, want %s", err, want)
+	}
+}
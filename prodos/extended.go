@@ -0,0 +1,241 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides access to read and write extended files
+// with data and resource forks on a ProDOS drive image
+
+package prodos
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// LoadFileForks loads the data fork, resource fork and Finder info from an
+// extended file on a ProDOS volume. The Finder info is 32 bytes with the
+// FInfo followed by the FXInfo. For regular files only the data fork is
+// returned and the resource fork and Finder info are nil.
+func LoadFileForks(reader io.ReaderAt, path string) ([]byte, []byte, []byte, error) {
+	var dataFork, resourceFork, finderInfo []byte
+	err := withVolumeReader(reader, func(volume *Volume) error {
+		var err error
+		dataFork, resourceFork, finderInfo, err = loadFileForks(volume, path)
+		return err
+	})
+	return dataFork, resourceFork, finderInfo, err
+}
+
+func loadFileForks(reader io.ReaderAt, path string) ([]byte, []byte, []byte, error) {
+	fileEntry, err := GetFileEntry(reader, path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if fileEntry.StorageType != StorageExtended {
+		dataFork, err := readFileData(reader, fileEntry)
+		return dataFork, nil, nil, err
+	}
+
+	dataForkEntry, resourceForkEntry, err := readExtendedKeyBlock(reader, fileEntry)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	dataFork, err := readFileData(reader, dataForkEntry)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	resourceFork, err := readFileData(reader, resourceForkEntry)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	keyBlock, err := ReadBlock(reader, fileEntry.KeyPointer)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return dataFork, resourceFork, parseFinderInfo(keyBlock), nil
+}
+
+// WriteForkedFile writes an extended file with a data fork, resource fork
+// and optional 32 bytes of Finder info (FInfo followed by FXInfo)
+func WriteForkedFile(
+	readerWriter ReaderWriterAt,
+	path string,
+	fileType uint8,
+	auxType uint16,
+	createdTime time.Time,
+	modifiedTime time.Time,
+	dataFork []byte,
+	resourceFork []byte,
+	finderInfo []byte,
+	options WriteFileOptions,
+) error {
+	return withVolume(readerWriter, func(volume *Volume) error {
+		return writeForkedFile(volume, path, fileType, auxType, createdTime, modifiedTime, dataFork, resourceFork, finderInfo, options)
+	})
+}
+
+func writeForkedFile(
+	readerWriter ReaderWriterAt,
+	path string,
+	fileType uint8,
+	auxType uint16,
+	createdTime time.Time,
+	modifiedTime time.Time,
+	dataFork []byte,
+	resourceFork []byte,
+	finderInfo []byte,
+	options WriteFileOptions,
+) error {
+	dataAllocate := dataBlocksToAllocate(dataFork, options.sparse(len(dataFork)))
+	resourceAllocate := dataBlocksToAllocate(resourceFork, options.sparse(len(resourceFork)))
+	return writeSparseForkedFile(readerWriter, path, fileType, auxType, createdTime, modifiedTime,
+		dataFork, dataAllocate, resourceFork, resourceAllocate, finderInfo, options)
+}
+
+// writeSparseForkedFile writes an extended file allocating only the
+// blocks of data in each fork marked to allocate
+func writeSparseForkedFile(
+	readerWriter ReaderWriterAt,
+	path string,
+	fileType uint8,
+	auxType uint16,
+	createdTime time.Time,
+	modifiedTime time.Time,
+	dataFork []byte,
+	dataAllocate []bool,
+	resourceFork []byte,
+	resourceAllocate []bool,
+	finderInfo []byte,
+	options WriteFileOptions,
+) error {
+	if len(dataFork) > 0x1000000 || len(resourceFork) > 0x1000000 {
+		return errors.New("forks > 16MB not supported by ProDOS")
+	}
+	if finderInfo != nil && len(finderInfo) != 32 {
+		return errors.New("finder info must be 32 bytes")
+	}
+
+	fileEntry, oldBlockList, skip, err := getFileEntryForWrite(readerWriter, path, options)
+	if err != nil || skip {
+		return err
+	}
+
+	dataStorageType, dataBlockList, err := writeFileData(readerWriter, dataFork, dataAllocate)
+	if err != nil {
+		return err
+	}
+
+	resourceStorageType, resourceBlockList, err := writeFileData(readerWriter, resourceFork, resourceAllocate)
+	if err != nil {
+		return err
+	}
+
+	keyBlockList, err := createBlockList(readerWriter, 0x200)
+	if err != nil {
+		return err
+	}
+
+	keyBlock := make([]byte, 512)
+	writeForkEntry(keyBlock[0x000:], FileEntry{
+		StorageType: dataStorageType,
+		KeyPointer:  dataBlockList[0],
+		BlocksUsed:  uint16(len(dataBlockList)),
+		EndOfFile:   uint32(len(dataFork)),
+	})
+	writeForkEntry(keyBlock[0x100:], FileEntry{
+		StorageType: resourceStorageType,
+		KeyPointer:  resourceBlockList[0],
+		BlocksUsed:  uint16(len(resourceBlockList)),
+		EndOfFile:   uint32(len(resourceFork)),
+	})
+	if finderInfo != nil {
+		keyBlock[0x08] = 18
+		keyBlock[0x09] = 1
+		copy(keyBlock[0x0A:0x1A], finderInfo[0:16])
+		keyBlock[0x1A] = 18
+		keyBlock[0x1B] = 2
+		copy(keyBlock[0x1C:0x2C], finderInfo[16:32])
+	}
+
+	err = WriteBlock(readerWriter, keyBlockList[0], keyBlock)
+	if err != nil {
+		return err
+	}
+	err = updateVolumeBitmap(readerWriter, keyBlockList)
+	if err != nil {
+		return err
+	}
+
+	fileEntry.StorageType = StorageExtended
+	fileEntry.KeyPointer = keyBlockList[0]
+	fileEntry.BlocksUsed = uint16(1 + len(dataBlockList) + len(resourceBlockList))
+	fileEntry.EndOfFile = 0x200
+
+	return commitFileEntry(readerWriter, fileEntry, fileType, auxType, createdTime, modifiedTime, oldBlockList, options)
+}
+
+// readExtendedKeyBlock reads the extended key block of a file and returns
+// entries describing the data fork and resource fork
+func readExtendedKeyBlock(reader io.ReaderAt, fileEntry FileEntry) (FileEntry, FileEntry, error) {
+	keyBlock, err := ReadBlock(reader, fileEntry.KeyPointer)
+	if err != nil {
+		return FileEntry{}, FileEntry{}, err
+	}
+
+	dataForkEntry := parseForkEntry(keyBlock[0x000:])
+	resourceForkEntry := parseForkEntry(keyBlock[0x100:])
+
+	if dataForkEntry.StorageType < StorageSeedling || dataForkEntry.StorageType > StorageTree ||
+		resourceForkEntry.StorageType < StorageSeedling || resourceForkEntry.StorageType > StorageTree {
+		return FileEntry{}, FileEntry{}, &PathError{Op: "read forks", Path: fileEntry.FileName, Block: fileEntry.KeyPointer, Err: ErrUnsupportedStorage}
+	}
+
+	return dataForkEntry, resourceForkEntry, nil
+}
+
+// parseForkEntry parses the mini entry for a fork in an extended key block
+func parseForkEntry(buffer []byte) FileEntry {
+	return FileEntry{
+		StorageType: buffer[0] & 0x0F,
+		KeyPointer:  uint16(buffer[1]) + uint16(buffer[2])*256,
+		BlocksUsed:  uint16(buffer[3]) + uint16(buffer[4])*256,
+		EndOfFile:   uint32(buffer[5]) + uint32(buffer[6])*256 + uint32(buffer[7])*65536,
+	}
+}
+
+// writeForkEntry writes the mini entry for a fork in an extended key block
+func writeForkEntry(buffer []byte, forkEntry FileEntry) {
+	buffer[0] = forkEntry.StorageType
+	buffer[1] = byte(forkEntry.KeyPointer & 0x00FF)
+	buffer[2] = byte(forkEntry.KeyPointer >> 8)
+	buffer[3] = byte(forkEntry.BlocksUsed & 0x00FF)
+	buffer[4] = byte(forkEntry.BlocksUsed >> 8)
+	buffer[5] = byte(forkEntry.EndOfFile & 0x0000FF)
+	buffer[6] = byte(forkEntry.EndOfFile & 0x00FF00 >> 8)
+	buffer[7] = byte(forkEntry.EndOfFile & 0xFF0000 >> 16)
+}
+
+// parseFinderInfo returns the FInfo and FXInfo entries from an
+// extended key block as 32 bytes
+func parseFinderInfo(keyBlock []byte) []byte {
+	finderInfo := make([]byte, 32)
+
+	for offset := 0x08; offset <= 0x1A; offset += 18 {
+		switch {
+		case keyBlock[offset] != 18:
+			continue
+		case keyBlock[offset+1] == 1:
+			copy(finderInfo[0:16], keyBlock[offset+2:offset+18])
+		case keyBlock[offset+1] == 2:
+			copy(finderInfo[16:32], keyBlock[offset+2:offset+18])
+		}
+	}
+
+	return finderInfo
+}
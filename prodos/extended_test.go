@@ -0,0 +1,81 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for extended files with
+// data and resource forks
+
+package prodos
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteAndLoadFileForks(t *testing.T) {
+	var tests = []struct {
+		testName         string
+		dataForkSize     int
+		resourceForkSize int
+	}{
+		{"emptyForks", 0, 0},
+		{"seedlingForks", 100, 200},
+		{"saplingResourceFork", 10, 5000},
+		{"treeDataFork", 200000, 0},
+	}
+
+	file := NewMemoryFile(0x2000000)
+	CreateVolume(file, "test", 2048)
+	volumeBitmap, _ := ReadVolumeBitmap(file)
+	wantFreeBlocks := GetFreeBlockCount(volumeBitmap, 2048)
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			dataFork := make([]byte, tt.dataForkSize)
+			for i := 0; i < len(dataFork); i++ {
+				dataFork[i] = byte(i)
+			}
+			resourceFork := make([]byte, tt.resourceForkSize)
+			for i := 0; i < len(resourceFork); i++ {
+				resourceFork[i] = byte(i * 3)
+			}
+			finderInfo := make([]byte, 32)
+			copy(finderInfo, "TEXTpdos")
+
+			err := WriteForkedFile(file, "/test/forked", 0x04, 0, time.Now(), time.Now(), dataFork, resourceFork, finderInfo, WriteFileOptions{})
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			gotDataFork, gotResourceFork, gotFinderInfo, err := LoadFileForks(file, "/test/forked")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !bytes.Equal(gotDataFork, dataFork) {
+				t.Errorf("got data fork of %d bytes, want %d", len(gotDataFork), len(dataFork))
+			}
+			if !bytes.Equal(gotResourceFork, resourceFork) {
+				t.Errorf("got resource fork of %d bytes, want %d", len(gotResourceFork), len(resourceFork))
+			}
+			if !bytes.Equal(gotFinderInfo, finderInfo) {
+				t.Errorf("got finder info %v, want %v", gotFinderInfo, finderInfo)
+			}
+
+			loaded, err := LoadFile(file, "/test/forked")
+			if err != nil || !bytes.Equal(loaded, dataFork) {
+				t.Errorf("got data fork of %d bytes from LoadFile, want %d", len(loaded), len(dataFork))
+			}
+
+			err = DeleteFile(file, "/test/forked")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			volumeBitmap, _ := ReadVolumeBitmap(file)
+			gotFreeBlocks := GetFreeBlockCount(volumeBitmap, 2048)
+			if gotFreeBlocks != wantFreeBlocks {
+				t.Errorf("got %d free blocks, want %d", gotFreeBlocks, wantFreeBlocks)
+			}
+		})
+	}
+}
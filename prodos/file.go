@@ -17,11 +17,35 @@ import (
 
 // LoadFile loads in a file from a ProDOS volume into a byte array
 func LoadFile(reader io.ReaderAt, path string) ([]byte, error) {
+	var data []byte
+	err := withVolumeReader(reader, func(volume *Volume) error {
+		var err error
+		data, err = loadFile(volume, path)
+		return err
+	})
+	return data, err
+}
+
+func loadFile(reader io.ReaderAt, path string) ([]byte, error) {
 	fileEntry, err := GetFileEntry(reader, path)
 	if err != nil {
 		return nil, err
 	}
 
+	// only the data fork is loaded from extended files
+	if fileEntry.StorageType == StorageExtended {
+		dataForkEntry, _, err := readExtendedKeyBlock(reader, fileEntry)
+		if err != nil {
+			return nil, err
+		}
+		fileEntry = dataForkEntry
+	}
+
+	return readFileData(reader, fileEntry)
+}
+
+// readFileData reads the data of a seedling, sapling or tree file
+func readFileData(reader io.ReaderAt, fileEntry FileEntry) ([]byte, error) {
 	blockList, err := getDataBlocklist(reader, fileEntry)
 	if err != nil {
 		return nil, err
@@ -47,77 +71,287 @@ func LoadFile(reader io.ReaderAt, path string) ([]byte, error) {
 	return buffer, nil
 }
 
+// WriteFileOptions controls how files that already exist are handled
+// when writing a file
+type WriteFileOptions struct {
+	// Overwrite replaces an existing file instead of failing
+	Overwrite bool
+	// PreserveCreated keeps the creation time of a replaced file
+	PreserveCreated bool
+	// PreserveAccess keeps the access bits of a replaced file
+	PreserveAccess bool
+	// IgnoreDuplicates skips writing without error if the file exists
+	// and Overwrite is not set
+	IgnoreDuplicates bool
+	// Sparse controls which blocks of zeroes are left unallocated
+	Sparse SparseMode
+}
+
+// SparseMode controls which blocks of zeroes are left unallocated when
+// writing a file, the first block of data is always allocated
+type SparseMode int
+
+const (
+	// SparseLargeFiles leaves blocks of zeroes out of files over 128K
+	SparseLargeFiles SparseMode = iota
+	// SparseAlways leaves blocks of zeroes out of all files
+	SparseAlways
+	// SparseNever allocates every block of data
+	SparseNever
+)
+
+// sparse returns true if blocks of zeroes are left out of a file of the given size
+func (options WriteFileOptions) sparse(size int) bool {
+	switch options.Sparse {
+	case SparseAlways:
+		return true
+	case SparseNever:
+		return false
+	}
+	return size > 0x20000
+}
+
 // WriteFile writes a file to a ProDOS volume from a byte array
 func WriteFile(readerWriter ReaderWriterAt, path string, fileType uint8, auxType uint16, createdTime time.Time, modifiedTime time.Time, buffer []byte) error {
-	directory, fileName := GetDirectoryAndFileNameFromPath(path)
+	return WriteFileWithOptions(readerWriter, path, fileType, auxType, createdTime, modifiedTime, buffer, WriteFileOptions{})
+}
 
-	if len(fileName) > 15 {
-		return errors.New("filename too long")
+// WriteFileWithOptions writes a file to a ProDOS volume from a byte array
+// optionally replacing an existing file. New blocks are allocated and
+// written before the directory entry is swapped and the old blocks freed.
+func WriteFileWithOptions(
+	readerWriter ReaderWriterAt,
+	path string,
+	fileType uint8,
+	auxType uint16,
+	createdTime time.Time,
+	modifiedTime time.Time,
+	buffer []byte,
+	options WriteFileOptions,
+) error {
+	return withVolume(readerWriter, func(volume *Volume) error {
+		return writeFileWithOptions(volume, path, fileType, auxType, createdTime, modifiedTime, buffer, options)
+	})
+}
+
+func writeFileWithOptions(
+	readerWriter ReaderWriterAt,
+	path string,
+	fileType uint8,
+	auxType uint16,
+	createdTime time.Time,
+	modifiedTime time.Time,
+	buffer []byte,
+	options WriteFileOptions,
+) error {
+	allocate := dataBlocksToAllocate(buffer, options.sparse(len(buffer)))
+	return writeSparseFile(readerWriter, path, fileType, auxType, createdTime, modifiedTime, buffer, allocate, options)
+}
+
+// writeSparseFile writes a file allocating only the blocks of data
+// marked to allocate
+func writeSparseFile(
+	readerWriter ReaderWriterAt,
+	path string,
+	fileType uint8,
+	auxType uint16,
+	createdTime time.Time,
+	modifiedTime time.Time,
+	buffer []byte,
+	allocate []bool,
+	options WriteFileOptions,
+) error {
+	if len(buffer) > 0x1000000 {
+		return errors.New("files > 16MB not supported by ProDOS")
 	}
 
-	existingFileEntry, _ := GetFileEntry(readerWriter, path)
-	if existingFileEntry.StorageType != StorageDeleted {
-		return errors.New(("file already exists"))
+	fileEntry, oldBlockList, skip, err := getFileEntryForWrite(readerWriter, path, options)
+	if err != nil || skip {
+		return err
 	}
 
-	// get list of blocks to write file to
-	blockList, err := createBlockList(readerWriter, uint32(len(buffer)))
+	storageType, blockList, err := writeFileData(readerWriter, buffer, allocate)
 	if err != nil {
 		return err
 	}
 
-	// seedling file
-	if len(buffer) <= 0x200 {
-		writeSeedlingFile(readerWriter, buffer, blockList)
-	}
+	fileEntry.StorageType = storageType
+	fileEntry.KeyPointer = blockList[0]
+	fileEntry.BlocksUsed = uint16(len(blockList))
+	fileEntry.EndOfFile = uint32(len(buffer))
 
-	// sapling file needs index block
-	if len(buffer) > 0x200 && len(buffer) <= 0x20000 {
-		writeSaplingFile(readerWriter, buffer, blockList)
-	}
+	return commitFileEntry(readerWriter, fileEntry, fileType, auxType, createdTime, modifiedTime, oldBlockList, options)
+}
+
+// getFileEntryForWrite returns the entry a file should be written to,
+// either a free entry in the directory or the existing entry with its
+// blocks when replacing a file, or skip if the file should not be written
+func getFileEntryForWrite(readerWriter ReaderWriterAt, path string, options WriteFileOptions) (FileEntry, []uint16, bool, error) {
+	directory, fileName := GetDirectoryAndFileNameFromPath(path)
 
-	// tree file needs master index and index blocks
-	if len(buffer) > 0x20000 && len(buffer) <= 0x1000000 {
-		writeTreeFile(readerWriter, buffer, blockList)
+	if len(fileName) > 15 {
+		return FileEntry{}, nil, false, &PathError{Op: "write", Path: path, Err: ErrInvalidName}
 	}
 
-	if len(buffer) > 0x1000000 {
-		return errors.New("files > 16MB not supported by ProDOS")
+	existingFileEntry, _ := GetFileEntry(readerWriter, path)
+	if existingFileEntry.StorageType == StorageDeleted {
+		// find the entry to use before allocating blocks as the
+		// directory may need to be expanded
+		fileEntry, err := getFreeFileEntryInDirectory(readerWriter, directory)
+		if err != nil {
+			return FileEntry{}, nil, false, err
+		}
+		fileEntry.FileName = fileName
+		return fileEntry, nil, false, nil
 	}
 
-	updateVolumeBitmap(readerWriter, blockList)
+	if options.IgnoreDuplicates && !options.Overwrite {
+		return FileEntry{}, nil, true, nil
+	}
+	if !options.Overwrite {
+		return FileEntry{}, nil, false, &PathError{Op: "write", Path: path, Err: ErrExists}
+	}
+	if existingFileEntry.StorageType == StorageDirectory {
+		return FileEntry{}, nil, false, errors.New("cannot overwrite a directory")
+	}
+	if existingFileEntry.Access&0x80 == 0 || existingFileEntry.Access&0x02 == 0 {
+		return FileEntry{}, nil, false, &PathError{Op: "write", Path: path, Err: ErrLocked}
+	}
 
-	// add file entry to directory
-	fileEntry, err := getFreeFileEntryInDirectory(readerWriter, directory)
+	oldBlockList, err := getAllBlockList(readerWriter, existingFileEntry)
 	if err != nil {
-		return err
+		return FileEntry{}, nil, false, err
 	}
-	fileEntry.FileName = fileName
-	fileEntry.BlocksUsed = uint16(len(blockList))
-	fileEntry.CreationTime = createdTime
+
+	return existingFileEntry, oldBlockList, false, nil
+}
+
+// commitFileEntry writes the entry for a file whose data has been written,
+// then either frees the blocks of the file it replaced or increments the
+// file count of the directory
+func commitFileEntry(
+	readerWriter ReaderWriterAt,
+	fileEntry FileEntry,
+	fileType uint8,
+	auxType uint16,
+	createdTime time.Time,
+	modifiedTime time.Time,
+	oldBlockList []uint16,
+	options WriteFileOptions,
+) error {
+	replacing := oldBlockList != nil
+
 	fileEntry.ModifiedTime = modifiedTime
 	fileEntry.AuxType = auxType
-	fileEntry.EndOfFile = uint32(len(buffer))
 	fileEntry.FileType = fileType
-	fileEntry.KeyPointer = blockList[0]
 	fileEntry.Version = 0x24
 	fileEntry.MinVersion = 0x00
-	fileEntry.Access = 0b11100011
-	if len(blockList) == 1 {
-		fileEntry.StorageType = StorageSeedling
-	} else if len(blockList) <= 257 {
-		fileEntry.StorageType = StorageSapling
-	} else {
-		fileEntry.StorageType = StorageTree
+	if !replacing || !options.PreserveCreated {
+		fileEntry.CreationTime = createdTime
+	}
+	if !replacing || !options.PreserveAccess {
+		fileEntry.Access = 0b11100011
 	}
 
-	err = writeFileEntry(readerWriter, fileEntry)
+	err := writeFileEntry(readerWriter, fileEntry)
 	if err != nil {
 		return err
 	}
+
+	if replacing {
+		return freeBlocks(readerWriter, oldBlockList)
+	}
 	return incrementFileCount(readerWriter, fileEntry)
 }
 
+// writeFileData allocates blocks and writes the buffer as a seedling,
+// sapling or tree file, returning the storage type and blocks used with
+// the key block first. Only the blocks of data marked to allocate are
+// written, the rest are left as gaps in a sparse file along with any
+// index blocks that would only point to gaps.
+func writeFileData(readerWriter ReaderWriterAt, buffer []byte, allocate []bool) (uint8, []uint16, error) {
+	storageType := storageTypeForSize(uint32(len(buffer)))
+
+	indexNeeded := make([]bool, (len(allocate)+255)/256)
+	numberOfBlocks := 0
+	for i, needed := range allocate {
+		if needed {
+			numberOfBlocks++
+			indexNeeded[i/256] = true
+		}
+	}
+	if storageType != StorageSeedling {
+		// add master index or index block
+		numberOfBlocks++
+	}
+	if storageType == StorageTree {
+		for _, needed := range indexNeeded {
+			if needed {
+				numberOfBlocks++
+			}
+		}
+	}
+
+	// get list of blocks to write file to
+	blockList, err := findFreeBlockList(readerWriter, uint16(numberOfBlocks))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// the key block is followed by the index blocks then the data blocks
+	next := 1
+	indexBlocks := make([]uint16, len(indexNeeded))
+	if storageType == StorageTree {
+		for i, needed := range indexNeeded {
+			if needed {
+				indexBlocks[i] = blockList[next]
+				next++
+			}
+		}
+	}
+	dataBlocks := make([]uint16, len(allocate))
+	if storageType == StorageSeedling {
+		next = 0
+	}
+	for i, needed := range allocate {
+		if needed {
+			dataBlocks[i] = blockList[next]
+			next++
+		}
+	}
+
+	switch storageType {
+	case StorageSeedling:
+		err = writeSeedlingFile(readerWriter, buffer, blockList)
+	case StorageSapling:
+		err = writeSaplingFile(readerWriter, buffer, blockList[0], dataBlocks)
+	default:
+		err = writeTreeFile(readerWriter, buffer, blockList[0], indexBlocks, dataBlocks)
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+
+	err = updateVolumeBitmap(readerWriter, blockList)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	return storageType, blockList, nil
+}
+
+// dataBlocksToAllocate returns which blocks of data in the buffer need to
+// be allocated, leaving out blocks of zeroes other than the first when
+// sparse as ProDOS always allocates the first block
+func dataBlocksToAllocate(buffer []byte, sparse bool) []bool {
+	allocate := make([]bool, max(1, (len(buffer)+511)/512))
+	for i := range allocate {
+		allocate[i] = !sparse || i == 0 || !isEmptyBlock(buffer[i*512:min(len(buffer), i*512+512)])
+	}
+
+	return allocate
+}
+
 func zeroData() []byte {
 	return make([]byte, 512)
 }
@@ -129,26 +363,30 @@ func incrementFileCount(readerWriter ReaderWriterAt, fileEntry FileEntry) error
 	}
 	directoryHeader := parseDirectoryHeader(directoryHeaderBlock, fileEntry.HeaderPointer)
 	directoryHeader.ActiveFileCount++
-	writeDirectoryHeader(readerWriter, directoryHeader)
-
-	return nil
+	return writeDirectoryHeader(readerWriter, directoryHeader)
 }
 
 // DeleteFile deletes a file from a ProDOS volume
 func DeleteFile(readerWriter ReaderWriterAt, path string) error {
-	fileEntry, err := GetFileEntry(readerWriter, path)
-	// DumpFileEntry(fileEntry)
-	// oldDirectoryBlock, _ := ReadBlock(readerWriter, fileEntry.DirectoryBlock)
-	// DumpBlock(oldDirectoryBlock)
+	return withVolume(readerWriter, func(volume *Volume) error {
+		return deleteFile(volume, path)
+	})
+}
 
+func deleteFile(readerWriter ReaderWriterAt, path string) error {
+	fileEntry, err := GetFileEntry(readerWriter, path)
 	if err != nil {
-		return errors.New("file not found")
+		return err
 	}
 	if fileEntry.StorageType == StorageDeleted {
 		return errors.New("file already deleted")
 	}
 	if fileEntry.StorageType == StorageDirectory {
-		return errors.New("directory deletion not supported")
+		return errors.New("path is a directory, use DeleteDirectory")
+	}
+	err = checkDestroyAccess(readerWriter, path, fileEntry, false)
+	if err != nil {
+		return err
 	}
 
 	// free the blocks
@@ -157,17 +395,23 @@ func DeleteFile(readerWriter ReaderWriterAt, path string) error {
 		return err
 	}
 
-	volumeBitmap, err := ReadVolumeBitmap(readerWriter)
+	return removeFileEntry(readerWriter, fileEntry, blocks)
+}
+
+// removeFileEntry frees the blocks used by a file or directory,
+// decrements the file count of its directory and zeroes the entry
+func removeFileEntry(readerWriter ReaderWriterAt, fileEntry FileEntry, blocks []uint16) error {
+	err := freeBlocks(readerWriter, blocks)
 	if err != nil {
 		return err
 	}
-	for i := 0; i < len(blocks); i++ {
-		if blocks[i] != 0 {
-			freeBlockInVolumeBitmap(volumeBitmap, blocks[i])
-		}
-	}
-	writeVolumeBitmap(readerWriter, volumeBitmap)
 
+	return clearFileEntry(readerWriter, fileEntry)
+}
+
+// clearFileEntry decrements the file count of the directory
+// containing the entry and zeroes the entry
+func clearFileEntry(readerWriter ReaderWriterAt, fileEntry FileEntry) error {
 	// decrement the directory entry count
 	directoryBlock, err := ReadBlock(readerWriter, fileEntry.HeaderPointer)
 	if err != nil {
@@ -176,21 +420,218 @@ func DeleteFile(readerWriter ReaderWriterAt, path string) error {
 	directoryHeader := parseDirectoryHeader(directoryBlock, fileEntry.HeaderPointer)
 
 	directoryHeader.ActiveFileCount--
-	writeDirectoryHeader(readerWriter, directoryHeader)
+	err = writeDirectoryHeader(readerWriter, directoryHeader)
+	if err != nil {
+		return err
+	}
 
 	// zero out directory entry
 	fileEntry.StorageType = 0
 	fileEntry.FileName = ""
+	return writeFileEntry(readerWriter, fileEntry)
+}
+
+// Rename renames a file or directory on a ProDOS volume, the new path can
+// either be a new file name or a full path within the same directory
+func Rename(readerWriter ReaderWriterAt, oldPath string, newPath string) error {
+	return withVolume(readerWriter, func(volume *Volume) error {
+		return rename(volume, oldPath, newPath)
+	})
+}
+
+func rename(readerWriter ReaderWriterAt, oldPath string, newPath string) error {
+	oldPath, err := makeFullPath(oldPath, readerWriter)
+	if err != nil {
+		return err
+	}
+	oldDirectory, _ := GetDirectoryAndFileNameFromPath(oldPath)
+
+	if strings.Contains(newPath, "/") {
+		newPath, err = makeFullPath(newPath, readerWriter)
+		if err != nil {
+			return err
+		}
+	} else {
+		newPath = oldDirectory + "/" + newPath
+	}
+	newDirectory, newFileName := GetDirectoryAndFileNameFromPath(newPath)
+
+	if newDirectory != oldDirectory {
+		return errors.New("cannot rename to a different directory")
+	}
+
+	err = validateFileName(newFileName)
+	if err != nil {
+		return err
+	}
+
+	fileEntry, err := GetFileEntry(readerWriter, oldPath)
+	if err != nil {
+		return err
+	}
+	if fileEntry.Access&0x40 == 0 {
+		return &PathError{Op: "rename", Path: oldPath, Err: ErrLocked}
+	}
+
+	exists, err := FileExists(readerWriter, newPath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return &PathError{Op: "rename", Path: newPath, Err: ErrExists}
+	}
+
+	fileEntry.FileName = newFileName
 	err = writeFileEntry(readerWriter, fileEntry)
 	if err != nil {
 		return err
 	}
 
+	// subdirectories also have their name in the key block header
+	if fileEntry.StorageType == StorageDirectory {
+		buffer, err := ReadBlock(readerWriter, fileEntry.KeyPointer)
+		if err != nil {
+			return err
+		}
+		directoryHeader := parseDirectoryHeader(buffer, fileEntry.KeyPointer)
+		directoryHeader.Name = newFileName
+		return writeDirectoryHeader(readerWriter, directoryHeader)
+	}
+
+	return nil
+}
+
+// Move moves a file or directory to another directory on a ProDOS volume
+// without copying its data, the new path can be an existing directory to
+// move into or a full path including the new name
+func Move(readerWriter ReaderWriterAt, oldPath string, newPath string) error {
+	return withVolume(readerWriter, func(volume *Volume) error {
+		return move(volume, oldPath, newPath)
+	})
+}
+
+func move(readerWriter ReaderWriterAt, oldPath string, newPath string) error {
+	if !strings.Contains(newPath, "/") {
+		return rename(readerWriter, oldPath, newPath)
+	}
+
+	oldPath, err := makeFullPath(strings.ToUpper(oldPath), readerWriter)
+	if err != nil {
+		return err
+	}
+	newPath, err = makeFullPath(strings.ToUpper(newPath), readerWriter)
+	if err != nil {
+		return err
+	}
+	oldDirectory, oldFileName := GetDirectoryAndFileNameFromPath(oldPath)
+
+	fileEntry, err := GetFileEntry(readerWriter, oldPath)
+	if err != nil {
+		return err
+	}
+	if fileEntry.Access&0x40 == 0 {
+		return &PathError{Op: "move", Path: oldPath, Err: ErrLocked}
+	}
+
+	// moving into an existing directory keeps the name
+	newPath = strings.TrimSuffix(newPath, "/")
+	destinationEntry, err := GetFileEntry(readerWriter, newPath)
+	if err == nil && destinationEntry.StorageType == StorageDirectory {
+		newPath = newPath + "/" + oldFileName
+	}
+	newDirectory, newFileName := GetDirectoryAndFileNameFromPath(newPath)
+
+	if newDirectory == oldDirectory {
+		return rename(readerWriter, oldPath, newFileName)
+	}
+
+	if newDirectory == oldPath || strings.HasPrefix(newDirectory, oldPath+"/") {
+		return errors.New("cannot move a directory into itself")
+	}
+
+	err = validateFileName(newFileName)
+	if err != nil {
+		return err
+	}
+
+	exists, err := FileExists(readerWriter, newPath)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return &PathError{Op: "move", Path: newPath, Err: ErrExists}
+	}
+
+	newFileEntry, err := getFreeFileEntryInDirectory(readerWriter, newDirectory)
+	if err != nil {
+		return err
+	}
+
+	movedFileEntry := fileEntry
+	movedFileEntry.FileName = newFileName
+	movedFileEntry.DirectoryBlock = newFileEntry.DirectoryBlock
+	movedFileEntry.DirectoryOffset = newFileEntry.DirectoryOffset
+	movedFileEntry.HeaderPointer = newFileEntry.HeaderPointer
+
+	err = writeFileEntry(readerWriter, movedFileEntry)
+	if err != nil {
+		return err
+	}
+	err = incrementFileCount(readerWriter, movedFileEntry)
+	if err != nil {
+		return err
+	}
+
+	// subdirectories point back to their entry in the parent directory
+	if movedFileEntry.StorageType == StorageDirectory {
+		buffer, err := ReadBlock(readerWriter, movedFileEntry.KeyPointer)
+		if err != nil {
+			return err
+		}
+		directoryHeader := parseDirectoryHeader(buffer, movedFileEntry.KeyPointer)
+		directoryHeader.Name = newFileName
+		directoryHeader.ParentBlock = movedFileEntry.DirectoryBlock
+		directoryHeader.ParentEntry = directoryEntryNumber(movedFileEntry.DirectoryOffset)
+		err = writeDirectoryHeader(readerWriter, directoryHeader)
+		if err != nil {
+			return err
+		}
+	}
+
+	return clearFileEntry(readerWriter, fileEntry)
+}
+
+// validateFileName checks a file name follows ProDOS rules of 1 to 15
+// characters starting with a letter followed by letters, digits or periods
+func validateFileName(fileName string) error {
+	if len(fileName) == 0 || len(fileName) > 15 {
+		return fmt.Errorf("%w, must be 1 to 15 characters", ErrInvalidName)
+	}
+
+	for i := 0; i < len(fileName); i++ {
+		c := fileName[i]
+		isLetter := c >= 'A' && c <= 'Z'
+		isDigitOrPeriod := (c >= '0' && c <= '9') || c == '.'
+		if !isLetter && (i == 0 || !isDigitOrPeriod) {
+			return fmt.Errorf("%w %s, must start with a letter followed by letters, digits or periods", ErrInvalidName, fileName)
+		}
+	}
+
 	return nil
 }
 
 // FileExists return true if the file exists
 func FileExists(reader io.ReaderAt, path string) (bool, error) {
+	var exists bool
+	err := withVolumeReader(reader, func(volume *Volume) error {
+		var err error
+		exists, err = fileExists(volume, path)
+		return err
+	})
+	return exists, err
+}
+
+func fileExists(reader io.ReaderAt, path string) (bool, error) {
 	fileEntry, _ := GetFileEntry(reader, path)
 	return fileEntry.StorageType != StorageDeleted, nil
 }
@@ -200,14 +641,7 @@ func GetDirectoryAndFileNameFromPath(path string) (string, string) {
 	path = strings.ToUpper(path)
 	paths := strings.Split(path, "/")
 
-	var directoryBuilder strings.Builder
-
-	for i := 1; i < len(paths)-1; i++ {
-		directoryBuilder.WriteString("/")
-		directoryBuilder.WriteString(paths[i])
-	}
-
-	directory := directoryBuilder.String()
+	directory := strings.Join(paths[0:len(paths)-1], "/")
 	fileName := paths[len(paths)-1]
 
 	return directory, fileName
@@ -217,7 +651,6 @@ func updateVolumeBitmap(readerWriter ReaderWriterAt, blockList []uint16) error {
 
 	volumeBitmap, err := ReadVolumeBitmap(readerWriter)
 	if err != nil {
-		fmt.Printf("%s", err)
 		return err
 	}
 	for i := uint16(0); i < uint16(len(blockList)); i++ {
@@ -226,97 +659,90 @@ func updateVolumeBitmap(readerWriter ReaderWriterAt, blockList []uint16) error {
 	return writeVolumeBitmap(readerWriter, volumeBitmap)
 }
 
-func writeSeedlingFile(writer io.WriterAt, buffer []byte, blockList []uint16) {
-	WriteBlock(writer, blockList[0], buffer)
+func freeBlocks(readerWriter ReaderWriterAt, blockList []uint16) error {
+	volumeBitmap, err := ReadVolumeBitmap(readerWriter)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(blockList); i++ {
+		if blockList[i] != 0 {
+			freeBlockInVolumeBitmap(volumeBitmap, blockList[i])
+		}
+	}
+	return writeVolumeBitmap(readerWriter, volumeBitmap)
 }
 
-func writeSaplingFile(writer io.WriterAt, buffer []byte, blockList []uint16) {
+func writeSeedlingFile(writer io.WriterAt, buffer []byte, blockList []uint16) error {
+	blockBuffer := make([]byte, 512)
+	copy(blockBuffer, buffer)
+	return WriteBlock(writer, blockList[0], blockBuffer)
+}
+
+func writeSaplingFile(writer io.WriterAt, buffer []byte, keyBlock uint16, dataBlocks []uint16) error {
 	// write index block with pointers to data blocks
 	indexBuffer := make([]byte, 512)
-	for i := 0; i < 256; i++ {
-		if i < len(blockList)-1 {
-			indexBuffer[i] = byte(blockList[i+1] & 0x00FF)
-			indexBuffer[i+256] = byte(blockList[i+1] >> 8)
-		} else {
-			indexBuffer[i] = 0
-			indexBuffer[i+256] = 0
-		}
+	for i := 0; i < len(dataBlocks); i++ {
+		indexBuffer[i] = byte(dataBlocks[i] & 0x00FF)
+		indexBuffer[i+256] = byte(dataBlocks[i] >> 8)
+	}
+	err := WriteBlock(writer, keyBlock, indexBuffer)
+	if err != nil {
+		return err
 	}
-	WriteBlock(writer, blockList[0], indexBuffer)
 
 	// write all data blocks
-	blockBuffer := make([]byte, 512)
-	blockPointer := 0
-	blockIndexNumber := 1
-	for i := 0; i < len(buffer); i++ {
-		blockBuffer[blockPointer] = buffer[i]
-		if blockPointer == 511 {
-			WriteBlock(writer, blockList[blockIndexNumber], blockBuffer)
-			blockPointer = 0
-			blockIndexNumber++
-		} else if i == len(buffer)-1 {
-			for j := blockPointer; j < 512; j++ {
-				blockBuffer[j] = 0
-			}
-			WriteBlock(writer, blockList[blockIndexNumber], blockBuffer)
-		} else {
-			blockPointer++
-		}
-	}
+	return writeDataBlocks(writer, buffer, dataBlocks)
 }
 
-func writeTreeFile(writer io.WriterAt, buffer []byte, blockList []uint16) {
+func writeTreeFile(writer io.WriterAt, buffer []byte, keyBlock uint16, indexBlocks []uint16, dataBlocks []uint16) error {
 	// write master index block with pointers to index blocks
 	indexBuffer := make([]byte, 512)
-	numberOfIndexBlocks := len(blockList)/256 + 1
-	if len(blockList)%256 == 0 {
-		numberOfIndexBlocks--
-	}
-	for i := 0; i < 256; i++ {
-		if i < numberOfIndexBlocks {
-			indexBuffer[i] = byte(blockList[i+1] & 0x00FF)
-			indexBuffer[i+256] = byte(blockList[i+1] >> 8)
-		} else {
-			indexBuffer[i] = 0
-			indexBuffer[i+256] = 0
-		}
+	for i := 0; i < len(indexBlocks); i++ {
+		indexBuffer[i] = byte(indexBlocks[i] & 0x00FF)
+		indexBuffer[i+256] = byte(indexBlocks[i] >> 8)
+	}
+	err := WriteBlock(writer, keyBlock, indexBuffer)
+	if err != nil {
+		return err
 	}
-	WriteBlock(writer, blockList[0], indexBuffer)
-	numberOfIndexBlocks++
 
 	// write index blocks
-	for i := 0; i < len(blockList)/256+1; i++ {
-		for j := 0; j < 256; j++ {
-			if i*256+j < len(blockList)-numberOfIndexBlocks {
-				indexBuffer[j] = byte(blockList[i*256+numberOfIndexBlocks+j] & 0x00FF)
-				indexBuffer[j+256] = byte(blockList[i*256+j+2] >> 8)
-			} else {
-				indexBuffer[j] = 0
-				indexBuffer[j+256] = 0
-			}
+	for i := 0; i < len(indexBlocks); i++ {
+		if indexBlocks[i] == 0 {
+			continue
+		}
+		indexBuffer = make([]byte, 512)
+		for j := 0; j < 256 && i*256+j < len(dataBlocks); j++ {
+			indexBuffer[j] = byte(dataBlocks[i*256+j] & 0x00FF)
+			indexBuffer[j+256] = byte(dataBlocks[i*256+j] >> 8)
+		}
+		err = WriteBlock(writer, indexBlocks[i], indexBuffer)
+		if err != nil {
+			return err
 		}
-		WriteBlock(writer, blockList[i+1], indexBuffer)
 	}
 
 	// write all data blocks
-	blockBuffer := make([]byte, 512)
-	blockPointer := 0
-	blockIndexNumber := numberOfIndexBlocks
-	for i := 0; i < len(buffer); i++ {
-		blockBuffer[blockPointer] = buffer[i]
-		if blockPointer == 511 {
-			WriteBlock(writer, blockList[blockIndexNumber], blockBuffer)
-			blockPointer = 0
-			blockIndexNumber++
-		} else if i == len(buffer)-1 {
-			for j := blockPointer; j < 512; j++ {
-				blockBuffer[j] = 0
-			}
-			WriteBlock(writer, blockList[blockIndexNumber], blockBuffer)
-		} else {
-			blockPointer++
+	return writeDataBlocks(writer, buffer, dataBlocks)
+}
+
+// writeDataBlocks writes the buffer to the data blocks 512 bytes
+// at a time padding the last block with zeroes and skipping the
+// gaps in sparse files
+func writeDataBlocks(writer io.WriterAt, buffer []byte, dataBlocks []uint16) error {
+	for i := 0; i < len(dataBlocks); i++ {
+		if dataBlocks[i] == 0 {
+			continue
+		}
+		blockBuffer := make([]byte, 512)
+		copy(blockBuffer, buffer[i*512:])
+		err := WriteBlock(writer, dataBlocks[i], blockBuffer)
+		if err != nil {
+			return err
 		}
 	}
+
+	return nil
 }
 
 func getDataBlocklist(reader io.ReaderAt, fileEntry FileEntry) ([]uint16, error) {
@@ -335,69 +761,73 @@ func getBlocklist(reader io.ReaderAt, fileEntry FileEntry, dataOnly bool) ([]uin
 	case StorageSeedling:
 		blocks[0] = fileEntry.KeyPointer
 		return blocks, nil
-	case StorageSapling:
-		index, err := ReadBlock(reader, fileEntry.KeyPointer)
-		if err != nil {
-			return nil, err
-		}
-		blockOffset := uint16(1)
-		blocks[0] = fileEntry.KeyPointer
-		for i := uint16(0); i < fileEntry.BlocksUsed-1; i++ {
-			blocks[i+blockOffset] = uint16(index[i]) + uint16(index[i+256])*256
-		}
-		if dataOnly {
-			return blocks[1:], nil
-		}
-		return blocks, nil
-	case StorageTree:
-		// the number of dataBlocks in the list can be longer than the actual blocks used
-		// because of sparse files
-		dataBlocks := make([]uint16, fileEntry.EndOfFile/512+1)
-		// this can be more than needed
-		numberOfIndexBlocks := fileEntry.EndOfFile/512 + 2
-		indexBlocks := make([]uint16, numberOfIndexBlocks)
-		masterIndex, err := ReadBlock(reader, fileEntry.KeyPointer)
-		if err != nil {
-			return nil, err
+	case StorageSapling, StorageTree:
+		// data blocks are listed by position up to the end of file with
+		// zero for the blocks missing from sparse files, which can also be
+		// missing whole index blocks
+		dataBlocks := make([]uint16, (fileEntry.EndOfFile+511)/512)
+		blocks = []uint16{fileEntry.KeyPointer}
+
+		indexBlocks := []uint16{fileEntry.KeyPointer}
+		if fileEntry.StorageType == StorageTree {
+			masterIndex, err := ReadBlock(reader, fileEntry.KeyPointer)
+			if err != nil {
+				return nil, err
+			}
+			indexBlocks = make([]uint16, 128)
+			for i := 0; i < 128; i++ {
+				indexBlocks[i] = uint16(masterIndex[i]) + uint16(masterIndex[i+256])*256
+			}
 		}
-		numberOfDataBlocks := 0
-
-		indexBlocks[0] = fileEntry.KeyPointer
-		indexBlockCount := 1
-		bytesRemaining := fileEntry.EndOfFile
 
-		for i := uint16(0); i < 128; i++ {
-			indexBlock := uint16(masterIndex[i]) + uint16(masterIndex[i+256])*256
-			// even with sparse files, the index blocks should not be 0, only data blocks can be
+		for i, indexBlock := range indexBlocks {
 			if indexBlock == 0 {
-				break
+				continue
+			}
+			if fileEntry.StorageType == StorageTree {
+				blocks = append(blocks, indexBlock)
 			}
-			indexBlocks[indexBlockCount] = indexBlock
-			indexBlockCount++
 			index, err := ReadBlock(reader, indexBlock)
 			if err != nil {
 				return nil, err
 			}
-			for j := uint16(0); j < 256 && bytesRemaining > 0; j++ {
-				dataBlocks[numberOfDataBlocks] = uint16(index[j]) + uint16(index[j+256])*256
-				numberOfDataBlocks++
-				if bytesRemaining < 512 {
-					bytesRemaining = 0
-				} else {
-					bytesRemaining -= 512
+			for j := 0; j < 256; j++ {
+				dataBlock := uint16(index[j]) + uint16(index[j+256])*256
+				if dataBlock == 0 {
+					continue
+				}
+				if position := i*256 + j; position < len(dataBlocks) {
+					dataBlocks[position] = dataBlock
 				}
+				blocks = append(blocks, dataBlock)
 			}
 		}
 
 		if dataOnly {
-			return dataBlocks[0:numberOfDataBlocks], nil
+			return dataBlocks, nil
 		}
-
-		blocks = append(indexBlocks[0:numberOfIndexBlocks], dataBlocks[0:numberOfDataBlocks]...)
 		return blocks, nil
+	case StorageExtended:
+		dataForkEntry, resourceForkEntry, err := readExtendedKeyBlock(reader, fileEntry)
+		if err != nil {
+			return nil, err
+		}
+		dataForkBlocks, err := getBlocklist(reader, dataForkEntry, dataOnly)
+		if err != nil {
+			return nil, err
+		}
+		if dataOnly {
+			return dataForkBlocks, nil
+		}
+		resourceForkBlocks, err := getBlocklist(reader, resourceForkEntry, false)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append([]uint16{fileEntry.KeyPointer}, dataForkBlocks...)
+		return append(blocks, resourceForkBlocks...), nil
 	}
 
-	return nil, errors.New("unsupported file storage type")
+	return nil, &PathError{Op: "read", Path: fileEntry.FileName, Block: fileEntry.KeyPointer, Err: ErrUnsupportedStorage}
 }
 
 func createBlockList(reader io.ReaderAt, fileSize uint32) ([]uint16, error) {
@@ -413,11 +843,12 @@ func createBlockList(reader io.ReaderAt, fileSize uint32) ([]uint16, error) {
 
 	if fileSize > 0x20000 && fileSize <= 0x1000000 {
 		// add index blocks for each 256 blocks
-		numberOfBlocks += numberOfBlocks / 256
+		numberOfIndexBlocks := numberOfBlocks / 256
 		// add index block for any remaining blocks
 		if numberOfBlocks%256 > 0 {
-			numberOfBlocks++
+			numberOfIndexBlocks++
 		}
+		numberOfBlocks += numberOfIndexBlocks
 		// add master index block
 		numberOfBlocks++
 	}
@@ -425,18 +856,42 @@ func createBlockList(reader io.ReaderAt, fileSize uint32) ([]uint16, error) {
 		return nil, errors.New("file size too large")
 	}
 
+	// empty files still have a key block
+	if numberOfBlocks == 0 {
+		numberOfBlocks = 1
+	}
+
+	return findFreeBlockList(reader, numberOfBlocks)
+}
+
+// findFreeBlockList returns free blocks from the volume bitmap
+// without marking them as used
+func findFreeBlockList(reader io.ReaderAt, numberOfBlocks uint16) ([]uint16, error) {
 	volumeBitmap, err := ReadVolumeBitmap(reader)
 	if err != nil {
 		return nil, err
 	}
 
 	blockList := findFreeBlocks(volumeBitmap, numberOfBlocks)
+	if blockList == nil {
+		return nil, ErrDiskFull
+	}
 
 	return blockList[0:numberOfBlocks], nil
 }
 
 // GetFileEntry returns a file entry for the given path
 func GetFileEntry(reader io.ReaderAt, path string) (FileEntry, error) {
+	var fileEntry FileEntry
+	err := withVolumeReader(reader, func(volume *Volume) error {
+		var err error
+		fileEntry, err = getFileEntry(volume, path)
+		return err
+	})
+	return fileEntry, err
+}
+
+func getFileEntry(reader io.ReaderAt, path string) (FileEntry, error) {
 	directory, fileName := GetDirectoryAndFileNameFromPath(path)
 	_, _, fileEntries, err := ReadDirectory(reader, directory)
 	if err != nil {
@@ -444,7 +899,7 @@ func GetFileEntry(reader io.ReaderAt, path string) (FileEntry, error) {
 	}
 
 	if len(fileEntries) == 0 {
-		return FileEntry{}, errors.New("file entry not found")
+		return FileEntry{}, &PathError{Op: "find", Path: path, Err: ErrNotFound}
 	}
 
 	var fileEntry FileEntry
@@ -456,7 +911,7 @@ func GetFileEntry(reader io.ReaderAt, path string) (FileEntry, error) {
 	}
 
 	if fileEntry.StorageType == StorageDeleted {
-		return FileEntry{}, errors.New("file not found")
+		return FileEntry{}, &PathError{Op: "find", Path: path, Err: ErrNotFound}
 	}
 
 	return fileEntry, nil
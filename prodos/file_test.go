@@ -5,8 +5,10 @@
 package prodos
 
 import (
+	"bytes"
 	"fmt"
 	"testing"
+	"time"
 )
 
 func TestCreateBlocklist(t *testing.T) {
@@ -40,3 +42,301 @@ func TestCreateBlocklist(t *testing.T) {
 		})
 	}
 }
+
+func TestRename(t *testing.T) {
+	var tests = []struct {
+		testName string
+		oldPath  string
+		newPath  string
+		wantPath string
+		wantErr  bool
+	}{
+		{"renameFile", "/test/file", "renamed", "/test/renamed", false},
+		{"renameFullPath", "/test/renamed", "/test/again", "/test/again", false},
+		{"renameDirectory", "/test/dir", "folder", "/test/folder", false},
+		{"renameInSubdirectory", "/test/folder/inner", "other", "/test/folder/other", false},
+		{"invalidName", "/test/again", "1bad", "", true},
+		{"tooLong", "/test/again", "abcdefghijklmnop", "", true},
+		{"existing", "/test/again", "folder", "", true},
+		{"missing", "/test/missing", "found", "", true},
+		{"differentDirectory", "/test/again", "/test/folder/again", "", true},
+	}
+
+	file := NewMemoryFile(0x2000000)
+	CreateVolume(file, "test", 1024)
+	WriteFile(file, "/test/file", 6, 0x2000, time.Now(), time.Now(), make([]byte, 100))
+	CreateDirectory(file, "/test/dir")
+	WriteFile(file, "/test/dir/inner", 6, 0x2000, time.Now(), time.Now(), make([]byte, 100))
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			err := Rename(file, tt.oldPath, tt.newPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			exists, _ := FileExists(file, tt.wantPath)
+			if !exists {
+				t.Errorf("got missing %s, want it to exist", tt.wantPath)
+			}
+			exists, _ = FileExists(file, tt.oldPath)
+			if exists {
+				t.Errorf("got existing %s, want it renamed", tt.oldPath)
+			}
+		})
+	}
+
+	_, directoryHeader, _, err := ReadDirectory(file, "/test/folder")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if directoryHeader.Name != "FOLDER" {
+		t.Errorf("got directory header name %s, want FOLDER", directoryHeader.Name)
+	}
+}
+
+func TestMove(t *testing.T) {
+	var tests = []struct {
+		testName string
+		oldPath  string
+		newPath  string
+		wantPath string
+		wantErr  bool
+	}{
+		{"moveIntoDirectory", "/test/file", "/test/one/", "/test/one/file", false},
+		{"moveWithNewName", "/test/one/file", "/test/two/moved", "/test/two/moved", false},
+		{"moveToRoot", "/test/two/moved", "/test/file", "/test/file", false},
+		{"moveDirectory", "/test/two", "/test/one", "/test/one/two", false},
+		{"moveIntoItself", "/test/one", "/test/one/two", "", true},
+		{"moveExisting", "/test/file", "/test/one/two/inner", "", true},
+		{"moveMissing", "/test/missing", "/test/one", "", true},
+	}
+
+	file := NewMemoryFile(0x2000000)
+	CreateVolume(file, "test", 1024)
+	WriteFile(file, "/test/file", 6, 0x2000, time.Now(), time.Now(), make([]byte, 1000))
+	CreateDirectory(file, "/test/one")
+	CreateDirectory(file, "/test/two")
+	WriteFile(file, "/test/two/inner", 6, 0x2000, time.Now(), time.Now(), make([]byte, 100))
+	volumeBitmap, _ := ReadVolumeBitmap(file)
+	wantFreeBlocks := GetFreeBlockCount(volumeBitmap, 1024)
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			err := Move(file, tt.oldPath, tt.newPath)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			exists, _ := FileExists(file, tt.wantPath)
+			if !exists {
+				t.Errorf("got missing %s, want it to exist", tt.wantPath)
+			}
+			exists, _ = FileExists(file, tt.oldPath)
+			if exists {
+				t.Errorf("got existing %s, want it moved", tt.oldPath)
+			}
+		})
+	}
+
+	_, directoryHeader, fileEntries, err := ReadDirectory(file, "/test/one/two")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(fileEntries) != 1 || fileEntries[0].HeaderPointer != directoryHeader.StartingBlock {
+		t.Errorf("got %d files in moved directory, want 1", len(fileEntries))
+	}
+	_, _, fileEntries, _ = ReadDirectory(file, "/test/one")
+	if directoryHeader.ParentBlock != fileEntries[0].DirectoryBlock {
+		t.Errorf("got parent block %04X, want %04X", directoryHeader.ParentBlock, fileEntries[0].DirectoryBlock)
+	}
+	volumeBitmap, _ = ReadVolumeBitmap(file)
+	gotFreeBlocks := GetFreeBlockCount(volumeBitmap, 1024)
+	if gotFreeBlocks != wantFreeBlocks {
+		t.Errorf("got %d free blocks, want %d", gotFreeBlocks, wantFreeBlocks)
+	}
+}
+
+func TestMoveDirectoryThenExpand(t *testing.T) {
+	var tests = []struct {
+		testName  string
+		zeroBased bool
+	}{
+		{"entryFromOne", false},
+		{"entryFromZero", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			file := NewMemoryFile(0x2000000)
+			CreateVolume(file, "test", 1024)
+			CreateDirectory(file, "/test/one")
+			WriteFile(file, "/test/one/first", 6, 0x2000, time.Now(), time.Now(), make([]byte, 100))
+			CreateDirectory(file, "/test/moved")
+
+			err := Move(file, "/test/moved", "/test/one/")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			// the moved directory is the third entry of the key block after
+			// the header and FIRST
+			_, directoryHeader, _, _ := ReadDirectory(file, "/test/one/moved")
+			if directoryHeader.ParentEntry != 3 {
+				t.Errorf("got parent entry %d, want 3", directoryHeader.ParentEntry)
+			}
+			if tt.zeroBased {
+				directoryHeader.ParentEntry--
+				writeDirectoryHeader(file, directoryHeader)
+			}
+
+			for i := 0; i < 20; i++ {
+				err = WriteFile(file, fmt.Sprintf("/test/one/moved/file%d", i), 6, 0x2000, time.Now(), time.Now(), make([]byte, 100))
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+			}
+
+			fileEntry, _ := GetFileEntry(file, "/test/one/moved")
+			if fileEntry.BlocksUsed != 2 || fileEntry.EndOfFile != 0x400 {
+				t.Errorf("got %d blocks and end of file %04X, want 2 and 0400", fileEntry.BlocksUsed, fileEntry.EndOfFile)
+			}
+			fileEntry, _ = GetFileEntry(file, "/test/one/first")
+			if fileEntry.BlocksUsed != 1 || fileEntry.EndOfFile != 100 {
+				t.Errorf("got FIRST changed to %d blocks and end of file %d", fileEntry.BlocksUsed, fileEntry.EndOfFile)
+			}
+			report, _ := Verify(file)
+			if report.HasProblems() {
+				t.Errorf("got problems %v", report.Problems)
+			}
+		})
+	}
+}
+
+func TestWriteAndLoadFile(t *testing.T) {
+	var tests = []struct {
+		testName string
+		fileSize int
+	}{
+		{"empty", 0},
+		{"seedling", 100},
+		{"sapling", 2049},
+		{"tree", 300000},
+		{"largeTree", 0x200000},
+	}
+
+	file := NewMemoryFile(0x2000000)
+	CreateVolume(file, "test", 0xFFFE)
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			buffer := make([]byte, tt.fileSize)
+			for i := 0; i < len(buffer); i++ {
+				buffer[i] = byte(i*7 + i/512)
+			}
+			err := WriteFile(file, tt.testName, 6, 0x2000, time.Now(), time.Now(), buffer)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			got, err := LoadFile(file, tt.testName)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !bytes.Equal(got, buffer) {
+				t.Errorf("got different file contents after reading back %d bytes", len(got))
+			}
+		})
+	}
+}
+
+func TestWriteFileWithOptions(t *testing.T) {
+	file := NewMemoryFile(0x2000000)
+	CreateVolume(file, "test", 1024)
+	createdTime := time.Date(2001, 2, 3, 4, 5, 0, 0, time.Local)
+	WriteFile(file, "/test/file", 6, 0x2000, createdTime, createdTime, make([]byte, 5000))
+	fileEntry, _ := GetFileEntry(file, "/test/file")
+	fileEntry.Access = 0b11100001
+	writeFileEntry(file, fileEntry)
+	volumeBitmap, _ := ReadVolumeBitmap(file)
+	freeBlocks := GetFreeBlockCount(volumeBitmap, 1024)
+
+	err := WriteFile(file, "/test/file", 6, 0x2000, time.Now(), time.Now(), []byte{1, 2, 3})
+	if err == nil {
+		t.Error("got nil, want error writing existing file without overwrite")
+	}
+
+	err = WriteFileWithOptions(file, "/test/file", 6, 0x2000, time.Now(), time.Now(), []byte{1, 2, 3}, WriteFileOptions{IgnoreDuplicates: true})
+	if err != nil {
+		t.Errorf("got error %s, want nil ignoring duplicates", err)
+	}
+
+	err = WriteFileWithOptions(file, "/test/file", 4, 0, time.Now(), time.Now(), []byte{1, 2, 3}, WriteFileOptions{Overwrite: true})
+	if err == nil {
+		t.Error("got nil, want error overwriting locked file")
+	}
+
+	fileEntry.Access = 0b11100011
+	writeFileEntry(file, fileEntry)
+	options := WriteFileOptions{Overwrite: true, PreserveCreated: true, PreserveAccess: true}
+	err = WriteFileWithOptions(file, "/test/file", 4, 0, time.Now(), time.Now(), []byte{1, 2, 3}, options)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	fileEntry, _ = GetFileEntry(file, "/test/file")
+	if fileEntry.FileType != 4 || fileEntry.EndOfFile != 3 {
+		t.Errorf("got type %02X length %d, want 04 and 3", fileEntry.FileType, fileEntry.EndOfFile)
+	}
+	if fileEntry.CreationTime != createdTime {
+		t.Errorf("got created %s, want %s", fileEntry.CreationTime, createdTime)
+	}
+	_, _, fileEntries, _ := ReadDirectory(file, "/test")
+	if len(fileEntries) != 1 {
+		t.Errorf("got %d files, want 1", len(fileEntries))
+	}
+	volumeBitmap, _ = ReadVolumeBitmap(file)
+	gotFreeBlocks := GetFreeBlockCount(volumeBitmap, 1024)
+	// 5000 bytes used 10 data blocks and an index block, now just a seedling
+	if gotFreeBlocks != freeBlocks+10 {
+		t.Errorf("got %d free blocks, want %d", gotFreeBlocks, freeBlocks+10)
+	}
+}
+
+func TestGetDirectoryAndFileNameFromPath(t *testing.T) {
+	var tests = []struct {
+		path          string
+		wantDirectory string
+		wantFileName  string
+	}{
+		{"/test/file", "/TEST", "FILE"},
+		{"/test/docs/file", "/TEST/DOCS", "FILE"},
+		{"/test", "", "TEST"},
+		{"file", "", "FILE"},
+		// relative paths keep their first directory, which used to be dropped
+		// so docs/file was looked up in the volume directory
+		{"docs/file", "DOCS", "FILE"},
+		{"docs/inner/file", "DOCS/INNER", "FILE"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			directory, fileName := GetDirectoryAndFileNameFromPath(tt.path)
+			if directory != tt.wantDirectory || fileName != tt.wantFileName {
+				t.Errorf("got %s and %s, want %s and %s", directory, fileName, tt.wantDirectory, tt.wantFileName)
+			}
+		})
+	}
+
+	volume := createVerifyVolume()
+	fileEntry, err := GetFileEntry(volume, "docs/medium")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if fileEntry.EndOfFile != 5000 {
+		t.Errorf("got end of file %d, want 5000", fileEntry.EndOfFile)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides changing the type, access and dates
+// of files on a ProDOS drive image
+
+package prodos
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	// AccessRead allows the file to be read
+	AccessRead = 0x01
+	// AccessWrite allows the file to be written
+	AccessWrite = 0x02
+	// AccessInvisible hides the file in GS/OS
+	AccessInvisible = 0x04
+	// AccessBackup signifies the file has changed since it was backed up
+	AccessBackup = 0x20
+	// AccessRename allows the file to be renamed
+	AccessRename = 0x40
+	// AccessDestroy allows the file to be deleted
+	AccessDestroy = 0x80
+)
+
+// FileInfoUpdate has the attributes to change with SetFileInfo,
+// attributes left as nil are not changed
+type FileInfoUpdate struct {
+	FileType     *uint8
+	AuxType      *uint16
+	Access       *uint8
+	CreationTime *time.Time
+	ModifiedTime *time.Time
+}
+
+// SetFileInfo changes the file type, aux type, access and dates of a
+// file or directory, the file type of a directory cannot be changed and
+// a file cannot be given the directory file type
+func SetFileInfo(readerWriter ReaderWriterAt, path string, update FileInfoUpdate) error {
+	fileEntry, err := GetFileEntry(readerWriter, path)
+	if err != nil {
+		return err
+	}
+
+	if update.FileType != nil {
+		if fileEntry.StorageType == StorageDirectory && *update.FileType != 0x0F {
+			return errors.New("cannot change the file type of a directory")
+		}
+		if fileEntry.StorageType != StorageDirectory && *update.FileType == 0x0F {
+			return errors.New("cannot change the file type of a file to directory")
+		}
+		fileEntry.FileType = *update.FileType
+	}
+	if update.AuxType != nil {
+		fileEntry.AuxType = *update.AuxType
+	}
+	if update.Access != nil {
+		fileEntry.Access = *update.Access
+	}
+	if update.CreationTime != nil {
+		fileEntry.CreationTime = *update.CreationTime
+	}
+	if update.ModifiedTime != nil {
+		fileEntry.ModifiedTime = *update.ModifiedTime
+	}
+
+	return writeFileEntry(readerWriter, fileEntry)
+}
@@ -0,0 +1,73 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for changing file attributes
+
+package prodos
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetFileInfo(t *testing.T) {
+	fileType := uint8(0x06)
+	directoryType := uint8(0x0F)
+	auxType := uint16(0x2000)
+	access := uint8(AccessRead | AccessBackup | AccessInvisible)
+	creationTime := time.Date(1986, time.September, 15, 12, 30, 0, 0, time.Local)
+	modifiedTime := time.Date(1993, time.May, 1, 8, 15, 0, 0, time.Local)
+
+	var tests = []struct {
+		testName string
+		path     string
+		update   FileInfoUpdate
+		want     FileEntry
+		wantErr  bool
+	}{
+		{"type", "/verify/small", FileInfoUpdate{FileType: &fileType, AuxType: &auxType},
+			FileEntry{FileType: 0x06, AuxType: 0x2000, Access: 0xE3}, false},
+		{"access", "/verify/small", FileInfoUpdate{Access: &access},
+			FileEntry{FileType: 0x04, AuxType: 0x0000, Access: 0x25}, false},
+		{"dates", "/verify/small", FileInfoUpdate{CreationTime: &creationTime, ModifiedTime: &modifiedTime},
+			FileEntry{FileType: 0x04, AuxType: 0x0000, Access: 0xE3, CreationTime: creationTime, ModifiedTime: modifiedTime}, false},
+		{"directoryType", "/verify/docs", FileInfoUpdate{FileType: &fileType}, FileEntry{}, true},
+		{"fileToDirectoryType", "/verify/small", FileInfoUpdate{FileType: &directoryType}, FileEntry{}, true},
+		{"missing", "/verify/none", FileInfoUpdate{FileType: &fileType}, FileEntry{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			volume := createVerifyVolume()
+			before, _ := GetFileEntry(volume, tt.path)
+
+			err := SetFileInfo(volume, tt.path, tt.update)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("got no error, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			got, _ := GetFileEntry(volume, tt.path)
+			if got.FileType != tt.want.FileType || got.AuxType != tt.want.AuxType || got.Access != tt.want.Access {
+				t.Errorf("got %02X %04X %02X, want %02X %04X %02X",
+					got.FileType, got.AuxType, got.Access, tt.want.FileType, tt.want.AuxType, tt.want.Access)
+			}
+			wantCreationTime, wantModifiedTime := before.CreationTime, before.ModifiedTime
+			if tt.update.CreationTime != nil {
+				wantCreationTime, wantModifiedTime = tt.want.CreationTime, tt.want.ModifiedTime
+			}
+			if !got.CreationTime.Equal(wantCreationTime) || !got.ModifiedTime.Equal(wantModifiedTime) {
+				t.Errorf("got %s %s, want %s %s", got.CreationTime, got.ModifiedTime, wantCreationTime, wantModifiedTime)
+			}
+			if got.KeyPointer != before.KeyPointer || got.EndOfFile != before.EndOfFile {
+				t.Errorf("got key pointer %04X end of file %d, want unchanged", got.KeyPointer, got.EndOfFile)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@
 package prodos
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 	"time"
@@ -14,20 +15,24 @@ import (
 
 // CreateVolume formats a new ProDOS volume including boot block,
 // volume bitmap and empty directory
-func CreateVolume(readerWriter ReaderWriterAt, volumeName string, numberOfBlocks uint16) {
-	if numberOfBlocks > 65535 || numberOfBlocks < 64 {
-		return
+func CreateVolume(readerWriter ReaderWriterAt, volumeName string, numberOfBlocks uint16) error {
+	if numberOfBlocks < 64 {
+		errString := fmt.Sprintf("volume must be at least 64 blocks, not %d", numberOfBlocks)
+		return errors.New(errString)
 	}
 	volumeName = strings.ToUpper(volumeName)
-	volumeNameLen := len(volumeName)
-	if volumeNameLen == 0 || volumeNameLen > 15 {
-		fmt.Println("bad name length")
-		return
+	err := validateFileName(volumeName)
+	if err != nil {
+		return &PathError{Op: "create volume", Path: volumeName, Err: err}
 	}
+	volumeNameLen := len(volumeName)
 
 	blankBlock := make([]byte, 512)
 	for i := uint16(0); i < numberOfBlocks; i++ {
-		WriteBlock(readerWriter, i, blankBlock)
+		err = WriteBlock(readerWriter, i, blankBlock)
+		if err != nil {
+			return err
+		}
 	}
 
 	volumeHeader := [43]byte{}
@@ -62,10 +67,16 @@ func CreateVolume(readerWriter ReaderWriterAt, volumeName string, numberOfBlocks
 	volumeHeader[0x29] = byte(numberOfBlocks & 0xFF)
 	volumeHeader[0x2A] = byte(numberOfBlocks >> 8)
 
-	readerWriter.WriteAt(volumeHeader[:], 1024)
+	_, err = readerWriter.WriteAt(volumeHeader[:], 1024)
+	if err != nil {
+		return err
+	}
 
 	// boot block 0
-	WriteBlock(readerWriter, 0, getBootBlock())
+	err = WriteBlock(readerWriter, 0, getBootBlock())
+	if err != nil {
+		return err
+	}
 
 	// pointers to volume directory blocks
 	for i := 2; i < 6; i++ {
@@ -82,12 +93,15 @@ func CreateVolume(readerWriter ReaderWriterAt, volumeName string, numberOfBlocks
 			pointers[2] = byte(i + 1)
 		}
 		pointers[3] = 0x00
-		readerWriter.WriteAt(pointers, int64(i*512))
+		_, err = readerWriter.WriteAt(pointers, int64(i*512))
+		if err != nil {
+			return err
+		}
 	}
 
 	// volume bit map starting at block 6
 	volumeBitmap := createVolumeBitmap(numberOfBlocks)
-	writeVolumeBitmap(readerWriter, volumeBitmap)
+	return writeVolumeBitmap(readerWriter, volumeBitmap)
 }
 
 func getBootBlock() []byte {
@@ -27,7 +27,10 @@ func TestCreateVolume(t *testing.T) {
 		t.Run(testname, func(t *testing.T) {
 			file := NewMemoryFile(0x2000000)
 
-			CreateVolume(file, tt.wantVolumeName, tt.blocks)
+			err := CreateVolume(file, tt.wantVolumeName, tt.blocks)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
 
 			volumeHeader, _, fileEntries, _ := ReadDirectory(file, "")
 			if volumeHeader.VolumeName != tt.wantVolumeName {
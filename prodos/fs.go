@@ -0,0 +1,245 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides read-only access to a ProDOS drive image
+// through the io/fs interfaces
+
+package prodos
+
+import (
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS is a read-only file system over a ProDOS volume for use with
+// fs.WalkDir, fs.Glob, http.FS and template.ParseFS. Paths are relative
+// to the volume directory and are matched without regard to case. The
+// Sys method of a fs.FileInfo returns the FileEntry of a file or
+// directory and the VolumeHeader for the volume directory. Extended
+// files are read as their data fork.
+type FS struct {
+	reader io.ReaderAt
+}
+
+// NewFS returns a file system reading the volume on a drive image
+func NewFS(reader io.ReaderAt) *FS {
+	return &FS{reader: reader}
+}
+
+// Open opens a file or directory
+func (fsys *FS) Open(name string) (fs.File, error) {
+	info, err := fsys.stat("open", name)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		entries, err := fsys.readDir("open", name)
+		if err != nil {
+			return nil, err
+		}
+		return &fsDirectory{info: info, entries: entries}, nil
+	}
+
+	path, _, err := fsys.fullPath("open", name)
+	if err != nil {
+		return nil, err
+	}
+	file, err := Open(fsys.reader, path)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &fsFile{File: file, info: info}, nil
+}
+
+// ReadDir reads a directory returning its entries sorted by name
+func (fsys *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	info, err := fsys.stat("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return fsys.readDir("readdir", name)
+}
+
+// Stat returns the information about a file or directory
+func (fsys *FS) Stat(name string) (fs.FileInfo, error) {
+	return fsys.stat("stat", name)
+}
+
+// ReadFile reads the data fork of a file
+func (fsys *FS) ReadFile(name string) ([]byte, error) {
+	info, err := fsys.stat("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+
+	return fsys.readFile("readfile", name)
+}
+
+// fullPath turns a file system name into a ProDOS path
+func (fsys *FS) fullPath(op string, name string) (string, VolumeHeader, error) {
+	if !fs.ValidPath(name) {
+		return "", VolumeHeader{}, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+
+	buffer, err := ReadBlock(fsys.reader, 2)
+	if err != nil {
+		return "", VolumeHeader{}, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	volumeHeader := parseVolumeHeader(buffer)
+
+	path := "/" + volumeHeader.VolumeName
+	if name != "." {
+		path += "/" + strings.ToUpper(name)
+	}
+	return path, volumeHeader, nil
+}
+
+func (fsys *FS) stat(op string, name string) (fs.FileInfo, error) {
+	path, volumeHeader, err := fsys.fullPath(op, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if name == "." {
+		return &fsFileInfo{
+			name:    volumeHeader.VolumeName,
+			mode:    fs.ModeDir | 0755,
+			modTime: volumeHeader.CreationTime,
+			sys:     volumeHeader,
+		}, nil
+	}
+
+	fileEntry, err := GetFileEntry(fsys.reader, path)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	return fsys.newFileInfo(fileEntry), nil
+}
+
+func (fsys *FS) readDir(op string, name string) ([]fs.DirEntry, error) {
+	path, _, err := fsys.fullPath(op, name)
+	if err != nil {
+		return nil, err
+	}
+	_, _, fileEntries, err := ReadDirectory(fsys.reader, path)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	entries := make([]fs.DirEntry, len(fileEntries))
+	for i, fileEntry := range fileEntries {
+		entries[i] = fs.FileInfoToDirEntry(fsys.newFileInfo(fileEntry))
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	return entries, nil
+}
+
+func (fsys *FS) readFile(op string, name string) ([]byte, error) {
+	path, _, err := fsys.fullPath(op, name)
+	if err != nil {
+		return nil, err
+	}
+	data, err := LoadFile(fsys.reader, path)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+
+	return data, nil
+}
+
+// newFileInfo returns the information about a file entry with the
+// size of the data fork for extended files
+func (fsys *FS) newFileInfo(fileEntry FileEntry) *fsFileInfo {
+	info := &fsFileInfo{
+		name:    fileEntry.FileName,
+		size:    int64(fileEntry.EndOfFile),
+		mode:    0444,
+		modTime: fileEntry.ModifiedTime,
+		sys:     fileEntry,
+	}
+	if fileEntry.Access&AccessWrite != 0 {
+		info.mode |= 0200
+	}
+
+	switch fileEntry.StorageType {
+	case StorageDirectory:
+		info.mode |= fs.ModeDir | 0111
+	case StorageExtended:
+		dataForkEntry, _, err := readExtendedKeyBlock(fsys.reader, fileEntry)
+		if err == nil {
+			info.size = int64(dataForkEntry.EndOfFile)
+		}
+	}
+
+	return info
+}
+
+type fsFileInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+	sys     interface{}
+}
+
+func (info *fsFileInfo) Name() string       { return info.name }
+func (info *fsFileInfo) Size() int64        { return info.size }
+func (info *fsFileInfo) Mode() fs.FileMode  { return info.mode }
+func (info *fsFileInfo) ModTime() time.Time { return info.modTime }
+func (info *fsFileInfo) IsDir() bool        { return info.mode.IsDir() }
+func (info *fsFileInfo) Sys() interface{}   { return info.sys }
+
+// fsFile is an open file that can also seek for http.FileServer
+type fsFile struct {
+	*File
+	info fs.FileInfo
+}
+
+func (file *fsFile) Stat() (fs.FileInfo, error) { return file.info, nil }
+func (file *fsFile) Close() error               { return nil }
+
+// fsDirectory is an open directory
+type fsDirectory struct {
+	info    fs.FileInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (directory *fsDirectory) Stat() (fs.FileInfo, error) { return directory.info, nil }
+func (directory *fsDirectory) Close() error               { return nil }
+
+func (directory *fsDirectory) Read(data []byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: directory.info.Name(), Err: fs.ErrInvalid}
+}
+
+// ReadDir returns the next n entries or all remaining entries if n <= 0
+func (directory *fsDirectory) ReadDir(n int) ([]fs.DirEntry, error) {
+	remaining := directory.entries[directory.offset:]
+	if n <= 0 {
+		directory.offset = len(directory.entries)
+		return remaining, nil
+	}
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(remaining) {
+		n = len(remaining)
+	}
+	directory.offset += n
+	return remaining[:n], nil
+}
@@ -0,0 +1,104 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for the io/fs file system
+
+package prodos
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFS(t *testing.T) {
+	volume := createVerifyVolume()
+	fsys := NewFS(volume)
+
+	err := fstest.TestFS(fsys, "SMALL", "LARGE", "FORKED", "DOCS/MEDIUM")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tests = []struct {
+		name         string
+		wantSize     int64
+		wantFileType uint8
+		wantDir      bool
+		wantErr      error
+	}{
+		{"small", 5, 0x04, false, nil},
+		{"docs/Medium", 5000, 0x06, false, nil},
+		{"forked", 1, 0xB3, false, nil},
+		{"DOCS", 512, 0x0F, true, nil},
+		{"docs/missing", 0, 0, false, fs.ErrNotExist},
+		{"small/missing", 0, 0, false, fs.ErrNotExist},
+		{"/small", 0, 0, false, fs.ErrInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := fs.Stat(fsys, tt.name)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got error %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			fileEntry, ok := info.Sys().(FileEntry)
+			if !ok {
+				t.Fatalf("got Sys %T, want FileEntry", info.Sys())
+			}
+			if info.Size() != tt.wantSize || fileEntry.FileType != tt.wantFileType || info.IsDir() != tt.wantDir {
+				t.Errorf("got size %d type %02X dir %t, want size %d type %02X dir %t",
+					info.Size(), fileEntry.FileType, info.IsDir(), tt.wantSize, tt.wantFileType, tt.wantDir)
+			}
+		})
+	}
+
+	t.Run("walk", func(t *testing.T) {
+		var paths []string
+		err := fs.WalkDir(fsys, ".", func(path string, d fs.DirEntry, err error) error {
+			paths = append(paths, path)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		want := []string{".", "DOCS", "DOCS/MEDIUM", "FORKED", "LARGE", "SMALL"}
+		if len(paths) != len(want) {
+			t.Fatalf("got %v, want %v", paths, want)
+		}
+		for i := range want {
+			if paths[i] != want[i] {
+				t.Errorf("got %v, want %v", paths, want)
+			}
+		}
+	})
+
+	t.Run("readFile", func(t *testing.T) {
+		got, err := fs.ReadFile(fsys, "large")
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if !bytes.Equal(got, bytes.Repeat([]byte{2}, 200000)) {
+			t.Errorf("got data that does not match")
+		}
+	})
+
+	t.Run("modTime", func(t *testing.T) {
+		modifiedTime := time.Date(2020, time.July, 4, 3, 2, 0, 0, time.Local)
+		SetFileInfo(volume, "/verify/small", FileInfoUpdate{ModifiedTime: &modifiedTime})
+		info, _ := fs.Stat(fsys, "SMALL")
+		if !info.ModTime().Equal(modifiedTime) {
+			t.Errorf("got %s, want %s", info.ModTime(), modifiedTime)
+		}
+	})
+}
@@ -3,13 +3,15 @@
 // license that can be found in the LICENSE file.
 
 // This file provides access to generate a ProDOS drive image from a host directory
+// and to extract the files of a ProDOS drive image to a host directory
 
 package prodos
 
 import (
-	"encoding/binary"
-	"errors"
+	"bytes"
 	"fmt"
+	"image/png"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -27,7 +29,30 @@ func AddFilesFromHostDirectory(
 	path string,
 	recursive bool,
 ) error {
+	return AddFilesFromHostDirectoryWithOptions(readerWriter, directory, path, recursive, WriteFileOptions{IgnoreDuplicates: true})
+}
+
+// AddFilesFromHostDirectoryWithOptions fills the root volume with files
+// from the specified host directory optionally replacing existing files
+func AddFilesFromHostDirectoryWithOptions(
+	readerWriter ReaderWriterAt,
+	directory string,
+	path string,
+	recursive bool,
+	options WriteFileOptions,
+) error {
+	return withVolume(readerWriter, func(volume *Volume) error {
+		return addFilesFromHostDirectory(volume, directory, path, recursive, options)
+	})
+}
 
+func addFilesFromHostDirectory(
+	readerWriter ReaderWriterAt,
+	directory string,
+	path string,
+	recursive bool,
+	options WriteFileOptions,
+) error {
 	path, err := makeFullPath(path, readerWriter)
 	if err != nil {
 		return err
@@ -50,8 +75,10 @@ func AddFilesFromHostDirectory(
 			return err
 		}
 
-		if file.Name()[0] != '.' && !file.IsDir() && info.Size() > 0 && info.Size() <= 0x1000000 {
-			err = WriteFileFromFile(readerWriter, path, 0, 0, info.ModTime(), filepath.Join(directory, file.Name()), cacheDir, true)
+		// empty files are only added when named with their attributes
+		_, _, _, _, hasAttributes := ParseCiderPressName(file.Name())
+		if file.Name()[0] != '.' && !file.IsDir() && (info.Size() > 0 || hasAttributes) && info.Size() <= 0x1000000 {
+			err = WriteFileFromFileWithOptions(readerWriter, path, 0, 0, info.ModTime(), filepath.Join(directory, file.Name()), cacheDir, options)
 			if err != nil {
 				return err
 			}
@@ -65,11 +92,14 @@ func AddFilesFromHostDirectory(
 			newFullPath := strings.ToUpper(path + newPath)
 
 			newHostDirectory := filepath.Join(directory, file.Name())
-			err = CreateDirectory(readerWriter, newFullPath)
-			if err != nil {
-				return err
+			existingFileEntry, _ := GetFileEntry(readerWriter, newFullPath)
+			if existingFileEntry.StorageType != StorageDirectory {
+				err = CreateDirectory(readerWriter, newFullPath)
+				if err != nil {
+					return err
+				}
 			}
-			err = AddFilesFromHostDirectory(readerWriter, newHostDirectory, newFullPath+"/", recursive)
+			err = addFilesFromHostDirectory(readerWriter, newHostDirectory, newFullPath+"/", recursive, options)
 			if err != nil {
 				return err
 			}
@@ -90,18 +120,65 @@ func WriteFileFromFile(
 	cacheDir fs.DirEntry,
 	ignoreDuplicates bool,
 ) error {
+	return WriteFileFromFileWithOptions(readerWriter, pathName, fileType, auxType, modifiedTime, inFileName, cacheDir,
+		WriteFileOptions{IgnoreDuplicates: ignoreDuplicates})
+}
+
+// WriteFileFromFileWithOptions writes a file to a ProDOS volume from a host
+// file optionally replacing an existing file
+func WriteFileFromFileWithOptions(
+	readerWriter ReaderWriterAt,
+	pathName string,
+	fileType uint8,
+	auxType uint16,
+	modifiedTime time.Time,
+	inFileName string,
+	cacheDir fs.DirEntry,
+	options WriteFileOptions,
+) error {
+
+	if auxType == 0 && fileType == 0 {
+		_, hostFileName := filepath.Split(inFileName)
+		_, _, _, _, hasAttributes := ParseCiderPressName(hostFileName)
+		if hasAttributes {
+			return writeFileFromCiderPressFile(readerWriter, pathName, modifiedTime, inFileName, options)
+		}
+	}
 
 	inFile, err := os.ReadFile(inFileName)
 	if err != nil {
-		errString := fmt.Sprintf("write from file failed: %s", err)
-		return errors.New(errString)
+		return fmt.Errorf("write from file failed: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(inFileName)) {
+	case ".bny", ".bqy":
+		if isBinaryIIHeader(inFile) {
+			return writeFilesFromBinaryII(readerWriter, pathName, inFile, options)
+		}
 	}
 
+	var appleSingleFile AppleSingleFile
+	isAppleSingle := false
 	if auxType == 0 && fileType == 0 {
-		auxType, fileType, inFile, err = convertFileByType(inFileName, inFile)
+		appleSingleFile, isAppleSingle, err = readAppleSingleFromFile(inFileName, inFile)
 		if err != nil {
-			errString := fmt.Sprintf("failed to convert file: %s", err)
-			return errors.New(errString)
+			return fmt.Errorf("failed to read AppleSingle file: %w", err)
+		}
+		if isAppleSingle {
+			inFile = appleSingleFile.DataFork
+			if len(appleSingleFile.RealName) > 0 {
+				inFileName = filepath.Join(filepath.Dir(inFileName), appleSingleFile.RealName)
+			}
+		}
+
+		if appleSingleFile.HasFileInfo {
+			fileType = appleSingleFile.FileType
+			auxType = appleSingleFile.AuxType
+		} else {
+			auxType, fileType, inFile, err = convertFileByType(inFileName, inFile)
+			if err != nil {
+				return fmt.Errorf("failed to convert file: %w", err)
+			}
 		}
 	}
 
@@ -140,18 +217,378 @@ func WriteFileFromFile(
 		pathName = strings.Join(paths, "")
 	}
 
-	// skip if file already exists and ignoring duplicates
-	if ignoreDuplicates {
-		exists, err := FileExists(readerWriter, pathName)
+	if isAppleSingle {
+		return writeFileFromAppleSingle(readerWriter, pathName, fileType, auxType, modifiedTime, inFile, appleSingleFile, options)
+	}
+
+	return WriteFileWithOptions(readerWriter, pathName, fileType, auxType, time.Now(), modifiedTime, inFile, options)
+}
+
+// writeFileFromCiderPressFile writes a host file named with its attributes
+// such as HELLO#fc0801 along with the resource fork file (HELLO#fc0801r)
+// if there is one. The access and creation time come from the attributes
+// file in the host directory, without one a read-only host file is written
+// as locked
+func writeFileFromCiderPressFile(
+	readerWriter ReaderWriterAt,
+	pathName string,
+	modifiedTime time.Time,
+	inFileName string,
+	options WriteFileOptions,
+) error {
+	directory, hostFileName := filepath.Split(inFileName)
+	fileName, fileType, auxType, isResourceFork, _ := ParseCiderPressName(hostFileName)
+
+	info, err := os.Stat(inFileName)
+	if err != nil {
+		return fmt.Errorf("write from file failed: %w", err)
+	}
+
+	dataFileName := inFileName
+	resourceFileName := inFileName + "r"
+	if isResourceFork {
+		dataFileName = filepath.Join(directory, hostFileName[:len(hostFileName)-1])
+		resourceFileName = inFileName
+		// the resource fork is written along with the data fork
+		_, err = os.Stat(dataFileName)
+		if err == nil {
+			return nil
+		}
+	}
+
+	dataFork, err := os.ReadFile(dataFileName)
+	if err != nil && !isResourceFork {
+		return fmt.Errorf("write from file failed: %w", err)
+	}
+	resourceFork, resourceErr := os.ReadFile(resourceFileName)
+
+	if len(pathName) == 0 || strings.HasSuffix(pathName, "/") {
+		if len(fileName) > 15 {
+			fileName = fileName[0:15]
+		}
+		pathName = strings.ToUpper(pathName + fileName)
+	}
+
+	attributes, err := readCiderPressAttributes(directory)
+	if err != nil {
+		return err
+	}
+	_, dataHostFileName := filepath.Split(dataFileName)
+	fileAttributes, hasAttributes := attributes[strings.ToUpper(dataHostFileName)]
+	creationTime := time.Now()
+	if hasAttributes {
+		creationTime = fileAttributes.CreationTime
+	}
+
+	exists, err := fileExists(readerWriter, pathName)
+	if err != nil {
+		return err
+	}
+	if exists && options.IgnoreDuplicates && !options.Overwrite {
+		return nil
+	}
+
+	if resourceErr == nil {
+		err = WriteForkedFile(readerWriter, pathName, fileType, auxType, creationTime, modifiedTime, dataFork, resourceFork, nil, options)
+	} else {
+		err = WriteFileWithOptions(readerWriter, pathName, fileType, auxType, creationTime, modifiedTime, dataFork, options)
+	}
+	if err != nil || (exists && options.PreserveAccess) {
+		return err
+	}
+
+	if hasAttributes {
+		return setFileAccess(readerWriter, pathName, fileAttributes.Access)
+	}
+	if info.Mode().Perm()&0200 == 0 {
+		return setFileAccess(readerWriter, pathName, 0x21)
+	}
+
+	return nil
+}
+
+// ExtractNaming selects how ExtractFilesToHostDirectory names host files
+type ExtractNaming int
+
+const (
+	// ExtractNamingCiderPress appends the file type and aux type such as
+	// HELLO#fc0801 with a separate resource fork file ending in r
+	ExtractNamingCiderPress ExtractNaming = iota
+	// ExtractNamingPlain uses the ProDOS file name and only the data fork
+	ExtractNamingPlain
+	// ExtractNamingAppleSingle writes AppleSingle files named NAME.as
+	ExtractNamingAppleSingle
+	// ExtractNamingAppleDouble writes the data fork to NAME and the
+	// resource fork and attributes to ._NAME
+	ExtractNamingAppleDouble
+)
+
+// ExtractOptions controls how files are written to the host
+type ExtractOptions struct {
+	// Recursive extracts subdirectories as host directories
+	Recursive bool
+	// Naming selects how host files are named
+	Naming ExtractNaming
+	// Convert writes Applesoft BASIC as NAME.bas, text as NAME.txt
+	// and hi-res images as NAME.png instead of using the naming
+	Convert bool
+}
+
+// ExtractFilesToHostDirectory writes the files in the path of a ProDOS volume
+// to a host directory. Host modification times are set from the files and
+// locked files are made read-only. With the default CiderPress naming the
+// access and creation times are written to a .prodosattributes file in each
+// host directory so files can be added back without losing attributes.
+func ExtractFilesToHostDirectory(reader io.ReaderAt, path string, directory string, options ExtractOptions) error {
+	return withVolumeReader(reader, func(volume *Volume) error {
+		return extractFilesToHostDirectory(volume, path, directory, options)
+	})
+}
+
+func extractFilesToHostDirectory(reader io.ReaderAt, path string, directory string, options ExtractOptions) error {
+	path, err := makeFullPath(strings.ToUpper(path), reader)
+	if err != nil {
+		return err
+	}
+	path = strings.TrimSuffix(path, "/")
+
+	_, _, fileEntries, err := ReadDirectory(reader, path)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(directory, 0755)
+	if err != nil {
+		return err
+	}
+
+	for _, fileEntry := range fileEntries {
+		filePath := path + "/" + fileEntry.FileName
+
+		if fileEntry.StorageType == StorageDirectory {
+			if !options.Recursive {
+				continue
+			}
+			hostDirectory := filepath.Join(directory, fileEntry.FileName)
+			err = extractFilesToHostDirectory(reader, filePath, hostDirectory, options)
+			if err != nil {
+				return err
+			}
+			os.Chtimes(hostDirectory, fileEntry.ModifiedTime, fileEntry.ModifiedTime)
+			continue
+		}
+
+		err = extractFileToHost(reader, filePath, fileEntry, directory, options)
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.Naming == ExtractNamingCiderPress {
+		return writeCiderPressAttributes(directory, fileEntries)
+	}
+
+	return nil
+}
+
+// extractFileToHost writes one file to a host directory
+func extractFileToHost(reader io.ReaderAt, path string, fileEntry FileEntry, directory string, options ExtractOptions) error {
+	dataFork, resourceFork, finderInfo, err := LoadFileForks(reader, path)
+	if err != nil {
+		return err
+	}
+
+	locked := fileEntry.Access&0x02 == 0
+	hostFileName := filepath.Join(directory, fileEntry.FileName)
+	isExtended := fileEntry.StorageType == StorageExtended
+
+	if options.Convert {
+		converted, ext, err := convertFileToHost(fileEntry, dataFork)
 		if err != nil {
 			return err
 		}
-		if exists {
-			return nil
+		if len(ext) > 0 {
+			return writeHostFile(hostFileName+ext, converted, fileEntry.ModifiedTime, locked)
+		}
+	}
+
+	appleSingleFile := AppleSingleFile{
+		RealName:        fileEntry.FileName,
+		HasFileInfo:     true,
+		Access:          fileEntry.Access,
+		FileType:        fileEntry.FileType,
+		AuxType:         fileEntry.AuxType,
+		CreationTime:    fileEntry.CreationTime,
+		ModifiedTime:    fileEntry.ModifiedTime,
+		DataFork:        dataFork,
+		ResourceFork:    resourceFork,
+		HasResourceFork: isExtended,
+		FinderInfo:      finderInfo,
+	}
+
+	switch options.Naming {
+	case ExtractNamingPlain:
+		return writeHostFile(hostFileName, dataFork, fileEntry.ModifiedTime, locked)
+	case ExtractNamingAppleSingle:
+		var buffer bytes.Buffer
+		err = WriteAppleSingle(&buffer, appleSingleFile)
+		if err != nil {
+			return err
+		}
+		return writeHostFile(hostFileName+".as", buffer.Bytes(), fileEntry.ModifiedTime, locked)
+	case ExtractNamingAppleDouble:
+		var buffer bytes.Buffer
+		err = WriteAppleDouble(&buffer, appleSingleFile)
+		if err != nil {
+			return err
+		}
+		err = writeHostFile(filepath.Join(directory, "._"+fileEntry.FileName), buffer.Bytes(), fileEntry.ModifiedTime, locked)
+		if err != nil {
+			return err
+		}
+		return writeHostFile(hostFileName, dataFork, fileEntry.ModifiedTime, locked)
+	}
+
+	hostFileName = filepath.Join(directory, GetCiderPressName(fileEntry.FileName, fileEntry.FileType, fileEntry.AuxType, false))
+	err = writeHostFile(hostFileName, dataFork, fileEntry.ModifiedTime, locked)
+	if err != nil || !isExtended {
+		return err
+	}
+
+	hostFileName = filepath.Join(directory, GetCiderPressName(fileEntry.FileName, fileEntry.FileType, fileEntry.AuxType, true))
+	return writeHostFile(hostFileName, resourceFork, fileEntry.ModifiedTime, locked)
+}
+
+// convertFileToHost converts Applesoft BASIC, text and hi-res images to
+// host formats returning the extension to use or an empty extension if
+// the file is not converted
+func convertFileToHost(fileEntry FileEntry, data []byte) ([]byte, string, error) {
+	switch {
+	case fileEntry.FileType == 0xFC:
+		return []byte(ConvertBasicToText(data)), ".bas", nil
+	case fileEntry.FileType == 0x04:
+		return []byte(strings.ReplaceAll(string(data), "\r", "\n")), ".txt", nil
+	// binary files loaded at either hi-res page or unpacked FOT files
+	case ((fileEntry.FileType == 0x06 && (fileEntry.AuxType == 0x2000 || fileEntry.AuxType == 0x4000)) ||
+		(fileEntry.FileType == 0x08 && fileEntry.AuxType < 0x4000)) &&
+		len(data) >= 0x1FF8 && len(data) <= 0x2000:
+		img, err := ConvertHiResToCRTImage(data)
+		if err != nil {
+			return nil, "", err
+		}
+		var buffer bytes.Buffer
+		err = png.Encode(&buffer, img)
+		if err != nil {
+			return nil, "", err
+		}
+		return buffer.Bytes(), ".png", nil
+	}
+
+	return nil, "", nil
+}
+
+// writeHostFile writes a file to the host setting its modification time
+// and making it read-only if it is locked
+func writeHostFile(hostFileName string, data []byte, modifiedTime time.Time, locked bool) error {
+	// a locked file from an earlier extract is read-only
+	os.Chmod(hostFileName, 0644)
+
+	err := os.WriteFile(hostFileName, data, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write host file: %w", err)
+	}
+
+	if !modifiedTime.IsZero() {
+		err = os.Chtimes(hostFileName, modifiedTime, modifiedTime)
+		if err != nil {
+			return err
 		}
 	}
 
-	return WriteFile(readerWriter, pathName, fileType, auxType, time.Now(), modifiedTime, inFile)
+	if locked {
+		return os.Chmod(hostFileName, 0444)
+	}
+
+	return nil
+}
+
+// readAppleSingleFromFile returns the contents of a host file in AppleSingle
+// format or of a host file with an AppleDouble header file (._NAME) beside it
+func readAppleSingleFromFile(inFileName string, inFile []byte) (AppleSingleFile, bool, error) {
+	if IsAppleSingle(inFile) {
+		appleSingleFile, err := ReadAppleSingle(inFile)
+		return appleSingleFile, err == nil, err
+	}
+
+	directory, fileName := filepath.Split(inFileName)
+	header, err := os.ReadFile(filepath.Join(directory, "._"+fileName))
+	if err != nil || !IsAppleDouble(header) {
+		return AppleSingleFile{}, false, nil
+	}
+
+	appleSingleFile, err := ReadAppleSingle(header)
+	if err != nil {
+		return AppleSingleFile{}, false, err
+	}
+	appleSingleFile.DataFork = inFile
+
+	return appleSingleFile, true, nil
+}
+
+// writeFileFromAppleSingle writes the forks of an AppleSingle file keeping
+// its dates and access when they are present
+func writeFileFromAppleSingle(
+	readerWriter ReaderWriterAt,
+	pathName string,
+	fileType uint8,
+	auxType uint16,
+	modifiedTime time.Time,
+	dataFork []byte,
+	appleSingleFile AppleSingleFile,
+	options WriteFileOptions,
+) error {
+	createdTime := time.Now()
+	if !appleSingleFile.CreationTime.IsZero() {
+		createdTime = appleSingleFile.CreationTime
+	}
+	if !appleSingleFile.ModifiedTime.IsZero() {
+		modifiedTime = appleSingleFile.ModifiedTime
+	}
+
+	exists, err := fileExists(readerWriter, pathName)
+	if err != nil {
+		return err
+	}
+	if exists && options.IgnoreDuplicates && !options.Overwrite {
+		return nil
+	}
+
+	if appleSingleFile.HasResourceFork {
+		err = WriteForkedFile(readerWriter, pathName, fileType, auxType, createdTime, modifiedTime,
+			dataFork, appleSingleFile.ResourceFork, appleSingleFile.FinderInfo, options)
+	} else {
+		err = WriteFileWithOptions(readerWriter, pathName, fileType, auxType, createdTime, modifiedTime, dataFork, options)
+	}
+	if err != nil || !appleSingleFile.HasFileInfo || (exists && options.PreserveAccess) {
+		return err
+	}
+
+	return setFileAccess(readerWriter, pathName, appleSingleFile.Access)
+}
+
+// writeFilesFromBinaryII writes the files of a Binary II archive to the
+// directory in the path, or to the path itself for an archive of one file
+func writeFilesFromBinaryII(readerWriter ReaderWriterAt, pathName string, inFile []byte, options WriteFileOptions) error {
+	files, err := ReadBinaryII(bytes.NewReader(inFile), int64(len(inFile)))
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 1 && len(pathName) > 0 && !strings.HasSuffix(pathName, "/") {
+		pathName, files[0].FileName = GetDirectoryAndFileNameFromPath(pathName)
+	}
+
+	return AddFilesFromBinaryII(readerWriter, files, pathName, options)
 }
 
 func convertFileByType(inFileName string, inFile []byte) (uint16, uint8, []byte, error) {
@@ -163,51 +600,43 @@ func convertFileByType(inFileName string, inFile []byte) (uint16, uint8, []byte,
 
 	var err error
 
-	// Check for an AppleSingle file as produced by cc65
-	if isAppleSingleMagicNumber(inFile) {
+	// use extension to determine file type
+	ext := strings.ToUpper(filepath.Ext(inFileName))
 
-		fileType = uint8(binary.BigEndian.Uint16(inFile[0x34:]))
-		auxType = uint16(binary.BigEndian.Uint32(inFile[0x36:]))
-		inFile = inFile[0x3A:]
-	} else {
-		// use extension to determine file type
-		ext := strings.ToUpper(filepath.Ext(inFileName))
+	match, err := regexp.MatchString("^\\.(BIN|SYS|TXT|BAS|bin|sys|txt|bas|\\$[0-9,A-F,a-f]{2})\\$[0-9,A-F,a-f]{4}", ext)
 
-		match, err := regexp.MatchString("^\\.(BIN|SYS|TXT|BAS|bin|sys|txt|bas|\\$[0-9,A-F,a-f]{2})\\$[0-9,A-F,a-f]{4}", ext)
+	if err == nil && match {
+		auxType, fileType, err = parseRawFile(ext)
+		if err != nil {
+			return 0, 0, nil, err
+		}
+	} else {
+		switch strings.ToUpper(ext) {
+		case ".BAS":
+			inFile, err = ConvertTextToBasic(string(inFile))
+			fileType = 0xFC
+			auxType = 0x0801
 
-		if err == nil && match {
-			auxType, fileType, err = parseRawFile(ext)
 			if err != nil {
 				return 0, 0, nil, err
 			}
-		} else {
-			switch strings.ToUpper(ext) {
-			case ".BAS":
-				inFile, err = ConvertTextToBasic(string(inFile))
-				fileType = 0xFC
-				auxType = 0x0801
-
-				if err != nil {
-					return 0, 0, nil, err
-				}
-			case ".SYS":
-				fileType = 0xFF
-				auxType = 0x2000
-			case ".BIN":
-				fileType = 0x06
-				auxType = 0x2000
-			case ".TXT":
-				inFile = []byte(strings.ReplaceAll(strings.ReplaceAll(string(inFile), "\r\n", "r"), "\n", "\r"))
-				fileType = 0x04
-				auxType = 0x0000
-			case ".JPG", ".PNG":
-				inFile = ConvertImageToHiResMonochrome(inFile)
-				fileType = 0x06
-				auxType = 0x2000
-			default:
-				fileType = 0x06
-				auxType = 0x0000
-			}
+		case ".SYS":
+			fileType = 0xFF
+			auxType = 0x2000
+		case ".BIN":
+			fileType = 0x06
+			auxType = 0x2000
+		case ".TXT":
+			inFile = []byte(strings.ReplaceAll(strings.ReplaceAll(string(inFile), "\r\n", "r"), "\n", "\r"))
+			fileType = 0x04
+			auxType = 0x0000
+		case ".JPG", ".PNG":
+			inFile = ConvertImageToHiResMonochrome(inFile)
+			fileType = 0x06
+			auxType = 0x2000
+		default:
+			fileType = 0x06
+			auxType = 0x0000
 		}
 	}
 
@@ -250,29 +679,6 @@ func parseRawFile(ext string) (uint16, uint8, error) {
 	return auxType, fileType, nil
 }
 
-func isAppleSingleMagicNumber(inFile []byte) bool {
-	if binary.BigEndian.Uint32(inFile[0x00:]) == 0x00051600 &&
-		// Version number
-		binary.BigEndian.Uint32(inFile[0x04:]) == 0x00020000 &&
-		// Number of entries
-		binary.BigEndian.Uint16(inFile[0x18:]) == 0x0002 &&
-		// Data Fork ID
-		binary.BigEndian.Uint32(inFile[0x1A:]) == 0x00000001 &&
-		// Offset
-		binary.BigEndian.Uint32(inFile[0x1E:]) == 0x0000003A &&
-		// Length
-		binary.BigEndian.Uint32(inFile[0x22:]) == uint32(len(inFile))-0x3A &&
-		// ProDOS File Info ID
-		binary.BigEndian.Uint32(inFile[0x26:]) == 0x0000000B &&
-		// Offset
-		binary.BigEndian.Uint32(inFile[0x2A:]) == 0x00000032 &&
-		// Length
-		binary.BigEndian.Uint32(inFile[0x2E:]) == 0x00000008 {
-		return true
-	}
-	return false
-}
-
 func getCacheDir(files []fs.DirEntry) fs.DirEntry {
 	for _, file := range files {
 		if file.Name() == ".prodoscache" {
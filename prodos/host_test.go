@@ -0,0 +1,105 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for extracting files to a host directory
+
+package prodos
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExtractFilesToHostDirectory(t *testing.T) {
+	modifiedTime := time.Date(2021, time.March, 4, 5, 6, 0, 0, time.Local)
+	volume := NewMemoryFile(0x2000000)
+	CreateVolume(volume, "extract", 2048)
+	CreateDirectory(volume, "/extract/pics")
+	basic, _ := ConvertTextToBasic("10 PRINT \"HELLO\"\n")
+	WriteFile(volume, "/extract/startup", 0xFC, 0x0801, time.Now(), modifiedTime, basic)
+	WriteFile(volume, "/extract/notes", 0x04, 0x0000, time.Now(), modifiedTime, []byte("LINE ONE\rLINE TWO\r"))
+	WriteFile(volume, "/extract/pics/title", 0x06, 0x2000, time.Now(), modifiedTime, make([]byte, 8192))
+	WriteFile(volume, "/extract/game", 0x06, 0x0803, time.Now(), modifiedTime, []byte{0x60})
+
+	var tests = []struct {
+		testName      string
+		options       ExtractOptions
+		wantFiles     []string
+		wantMissing   []string
+		wantNotesText string
+	}{
+		{"type", ExtractOptions{}, []string{"STARTUP#fc0801", "NOTES#040000", "GAME#060803"}, []string{"PICS"}, ""},
+		{"plain", ExtractOptions{Recursive: true, Naming: ExtractNamingPlain}, []string{"STARTUP", "NOTES", "GAME", "PICS/TITLE"}, nil, ""},
+		{"applesingle", ExtractOptions{Naming: ExtractNamingAppleSingle}, []string{"STARTUP.as", "NOTES.as", "GAME.as"}, nil, ""},
+		{"appledouble", ExtractOptions{Naming: ExtractNamingAppleDouble}, []string{"STARTUP", "._STARTUP", "GAME", "._GAME"}, nil, ""},
+		{"convert", ExtractOptions{Recursive: true, Convert: true}, []string{"STARTUP.bas", "NOTES.txt", "PICS/TITLE.png", "GAME#060803"}, nil, "LINE ONE\nLINE TWO\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			directory := t.TempDir()
+			err := ExtractFilesToHostDirectory(volume, "/extract", directory, tt.options)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			for _, wantFile := range tt.wantFiles {
+				info, err := os.Stat(filepath.Join(directory, wantFile))
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+				if !info.ModTime().Equal(modifiedTime) {
+					t.Errorf("got %s modified %s, want %s", wantFile, info.ModTime(), modifiedTime)
+				}
+			}
+			for _, missingFile := range tt.wantMissing {
+				_, err := os.Stat(filepath.Join(directory, missingFile))
+				if err == nil {
+					t.Errorf("got %s, want not extracted", missingFile)
+				}
+			}
+			if len(tt.wantNotesText) > 0 {
+				got, _ := os.ReadFile(filepath.Join(directory, "NOTES.txt"))
+				if string(got) != tt.wantNotesText {
+					t.Errorf("got %q, want %q", got, tt.wantNotesText)
+				}
+			}
+		})
+	}
+}
+
+func TestAddFilesFromHostDirectoryWithOptions(t *testing.T) {
+	var tests = []struct {
+		testName string
+		add      func(volume *MemoryFile, directory string) error
+		want     string
+	}{
+		{"skipDuplicates", func(volume *MemoryFile, directory string) error {
+			return AddFilesFromHostDirectory(volume, directory, "", false)
+		}, "OLD"},
+		{"overwrite", func(volume *MemoryFile, directory string) error {
+			return AddFilesFromHostDirectoryWithOptions(volume, directory, "", false, WriteFileOptions{Overwrite: true})
+		}, "NEW"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			directory := t.TempDir()
+			os.WriteFile(filepath.Join(directory, "README"), []byte("NEW"), 0644)
+			volume := NewMemoryFile(0x2000000)
+			CreateVolume(volume, "target", 2048)
+			WriteFile(volume, "/target/readme", 0x04, 0, time.Now(), time.Now(), []byte("OLD"))
+
+			err := tt.add(volume, directory)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			got, _ := LoadFile(volume, "/target/readme")
+			if string(got) != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,577 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides access to read NuFX (ShrinkIt) archives
+// and add their files to a ProDOS drive image
+
+package prodos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	nufxMasterHeaderSize = 48
+	nufxThreadHeaderSize = 16
+	nufxChunkSize        = 4096
+)
+
+const (
+	nufxThreadClassMessage  = 0
+	nufxThreadClassControl  = 1
+	nufxThreadClassData     = 2
+	nufxThreadClassFileName = 3
+)
+
+const (
+	nufxThreadKindDataFork     = 0
+	nufxThreadKindDiskImage    = 1
+	nufxThreadKindResourceFork = 2
+)
+
+const (
+	nufxFormatUncompressed = 0
+	nufxFormatLZW1         = 2
+	nufxFormatLZW2         = 3
+)
+
+const (
+	nufxLZWClearCode = 0x100
+	nufxLZWFirstCode = 0x101
+	nufxLZWMaxCodes  = 0x1000
+)
+
+// "NuFile" and "NuFX" with alternating high bits set
+var nufxMasterID = []byte{0x4E, 0xF5, 0x46, 0xE9, 0x6C, 0xE5}
+var nufxRecordID = []byte{0x4E, 0xF5, 0x46, 0xD8}
+
+// NuFXRecord is a file, directory or disk image stored in a NuFX archive
+type NuFXRecord struct {
+	FileName        string
+	FileSysID       uint16
+	Access          uint8
+	FileType        uint8
+	AuxType         uint16
+	StorageType     uint16
+	CreationTime    time.Time
+	ModifiedTime    time.Time
+	IsDisk          bool
+	DataFork        []byte
+	ResourceFork    []byte
+	HasResourceFork bool
+}
+
+// IsNuFXArchive returns true if the data starts with a NuFX master header
+// or a Binary II header wrapping one (.bxy)
+func IsNuFXArchive(reader io.ReaderAt) bool {
+	header := make([]byte, 128+len(nufxMasterID))
+	n, _ := reader.ReadAt(header, 0)
+	header = header[:n]
+
+	return bytes.HasPrefix(header, nufxMasterID) ||
+		(isBinaryIIHeader(header) && bytes.HasPrefix(header[128:], nufxMasterID))
+}
+
+// ReadNuFXArchive reads all records of a NuFX archive of the specified
+// size in bytes, expanding compressed threads. A Binary II wrapper
+// around the archive (.bxy) is skipped.
+func ReadNuFXArchive(reader io.ReaderAt, size int64) ([]NuFXRecord, error) {
+	data := make([]byte, size)
+	_, err := reader.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read NuFX archive: %w", err)
+	}
+
+	offset := 0
+	if !bytes.HasPrefix(data, nufxMasterID) && isBinaryIIHeader(data) {
+		offset = 128
+	}
+	if len(data) < offset+nufxMasterHeaderSize || !bytes.HasPrefix(data[offset:], nufxMasterID) {
+		return nil, errors.New("missing NuFX archive header")
+	}
+
+	master := data[offset : offset+nufxMasterHeaderSize]
+	if crc16(0, master[8:]) != binary.LittleEndian.Uint16(master[6:]) {
+		return nil, errors.New("NuFX master header CRC mismatch")
+	}
+	totalRecords := int(binary.LittleEndian.Uint32(master[8:]))
+
+	offset += nufxMasterHeaderSize
+	var records []NuFXRecord
+	for i := 0; i < totalRecords; i++ {
+		var record NuFXRecord
+		record, offset, err = readNuFXRecord(data, offset)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// AddFilesFromNuFXArchive writes the file and directory records of a NuFX
+// archive to the specified path keeping their file type, aux type, access
+// and dates, creating subdirectories as needed
+func AddFilesFromNuFXArchive(readerWriter ReaderWriterAt, records []NuFXRecord, path string, options WriteFileOptions) error {
+	return withVolume(readerWriter, func(volume *Volume) error {
+		return addFilesFromNuFXArchive(volume, records, path, options)
+	})
+}
+
+func addFilesFromNuFXArchive(readerWriter ReaderWriterAt, records []NuFXRecord, path string, options WriteFileOptions) error {
+	path, err := makeFullPath(strings.ToUpper(path), readerWriter)
+	if err != nil {
+		return err
+	}
+	path = strings.TrimSuffix(path, "/")
+
+	for _, record := range records {
+		if record.IsDisk {
+			continue
+		}
+
+		filePath := path + "/" + strings.ToUpper(strings.Trim(record.FileName, "/"))
+		err = createParentDirectories(readerWriter, filePath, path)
+		if err != nil {
+			return err
+		}
+
+		if record.StorageType == StorageDirectory || record.FileType == 0x0F {
+			existingFileEntry, _ := GetFileEntry(readerWriter, filePath)
+			if existingFileEntry.StorageType != StorageDirectory {
+				err = CreateDirectory(readerWriter, filePath)
+				if err != nil {
+					return err
+				}
+				err = SetFileInfo(readerWriter, filePath, FileInfoUpdate{
+					Access:       &record.Access,
+					CreationTime: &record.CreationTime,
+					ModifiedTime: &record.ModifiedTime,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		exists, err := fileExists(readerWriter, filePath)
+		if err != nil {
+			return err
+		}
+		if exists && options.IgnoreDuplicates && !options.Overwrite {
+			continue
+		}
+
+		if record.HasResourceFork {
+			err = WriteForkedFile(readerWriter, filePath, record.FileType, record.AuxType,
+				record.CreationTime, record.ModifiedTime, record.DataFork, record.ResourceFork, nil, options)
+		} else {
+			err = WriteFileWithOptions(readerWriter, filePath, record.FileType, record.AuxType,
+				record.CreationTime, record.ModifiedTime, record.DataFork, options)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", record.FileName, err)
+		}
+		if exists && options.PreserveAccess {
+			continue
+		}
+
+		err = setFileAccess(readerWriter, filePath, record.Access)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readNuFXRecord reads a record and its threads at the specified offset
+// returning the offset of the next record
+func readNuFXRecord(data []byte, offset int) (NuFXRecord, int, error) {
+	if offset+58 > len(data) || !bytes.HasPrefix(data[offset:], nufxRecordID) {
+		return NuFXRecord{}, 0, errors.New("missing NuFX record header")
+	}
+
+	header := data[offset:]
+	attributeCount := int(binary.LittleEndian.Uint16(header[6:]))
+	totalThreads := int(binary.LittleEndian.Uint32(header[10:]))
+	if attributeCount < 58 || offset+attributeCount > len(data) || totalThreads > 0xFFFF {
+		return NuFXRecord{}, 0, errors.New("invalid NuFX record header")
+	}
+
+	fileNameLength := int(binary.LittleEndian.Uint16(header[attributeCount-2:]))
+	threadStart := offset + attributeCount + fileNameLength
+	dataStart := threadStart + totalThreads*nufxThreadHeaderSize
+	if dataStart > len(data) {
+		return NuFXRecord{}, 0, errors.New("truncated NuFX record header")
+	}
+	if crc16(0, data[offset+6:dataStart]) != binary.LittleEndian.Uint16(header[4:]) {
+		return NuFXRecord{}, 0, errors.New("NuFX record header CRC mismatch")
+	}
+
+	extraType := binary.LittleEndian.Uint32(header[26:])
+	record := NuFXRecord{
+		FileSysID:    binary.LittleEndian.Uint16(header[14:]),
+		Access:       header[18],
+		FileType:     header[22],
+		AuxType:      uint16(extraType),
+		StorageType:  binary.LittleEndian.Uint16(header[30:]),
+		CreationTime: nufxDateTime(header[32:40]),
+		ModifiedTime: nufxDateTime(header[40:48]),
+	}
+	separator := header[16]
+	fileName := string(data[offset+attributeCount : threadStart])
+
+	for i := 0; i < totalThreads; i++ {
+		thread := data[threadStart+i*nufxThreadHeaderSize:]
+		threadClass := binary.LittleEndian.Uint16(thread[0:])
+		threadFormat := binary.LittleEndian.Uint16(thread[2:])
+		threadKind := binary.LittleEndian.Uint16(thread[4:])
+		threadEOF := int(binary.LittleEndian.Uint32(thread[8:]))
+		compressedEOF := int(binary.LittleEndian.Uint32(thread[12:]))
+		if compressedEOF < 0 || dataStart+compressedEOF > len(data) {
+			return NuFXRecord{}, 0, errors.New("truncated NuFX thread")
+		}
+		threadData := data[dataStart : dataStart+compressedEOF]
+		dataStart += compressedEOF
+
+		switch threadClass {
+		case nufxThreadClassFileName:
+			if threadEOF > len(threadData) {
+				threadEOF = len(threadData)
+			}
+			fileName = string(threadData[:threadEOF])
+		case nufxThreadClassData:
+			// the thread EOF of disk images is not reliable so use
+			// the number of blocks and block size instead
+			if threadKind == nufxThreadKindDiskImage && extraType > 0 && record.StorageType > 0 {
+				threadEOF = int(extraType) * int(record.StorageType)
+			}
+			expanded, err := expandNuFXThread(threadData, threadFormat, threadEOF)
+			if err != nil {
+				return NuFXRecord{}, 0, fmt.Errorf("failed to expand %s: %w", fileName, err)
+			}
+			switch threadKind {
+			case nufxThreadKindDataFork:
+				record.DataFork = expanded
+			case nufxThreadKindDiskImage:
+				record.IsDisk = true
+				record.DataFork = expanded
+			case nufxThreadKindResourceFork:
+				record.HasResourceFork = true
+				record.ResourceFork = expanded
+			}
+		}
+	}
+
+	if separator != 0 && separator != '/' {
+		fileName = strings.ReplaceAll(fileName, string(separator), "/")
+	}
+	record.FileName = fileName
+
+	return record, dataStart, nil
+}
+
+// expandNuFXThread returns the uncompressed data of a thread
+func expandNuFXThread(data []byte, format uint16, length int) ([]byte, error) {
+	switch format {
+	case nufxFormatUncompressed:
+		if length > len(data) {
+			return nil, errors.New("truncated thread")
+		}
+		return data[:length], nil
+	case nufxFormatLZW1:
+		return expandNuFXLZW(data, length, false)
+	case nufxFormatLZW2:
+		return expandNuFXLZW(data, length, true)
+	}
+
+	errString := fmt.Sprintf("unsupported thread format %d", format)
+	return nil, errors.New(errString)
+}
+
+// expandNuFXLZW expands LZW/1 or LZW/2 data which is made up of 4096 byte
+// chunks that are each run length encoded then optionally LZW compressed
+func expandNuFXLZW(data []byte, length int, lzw2 bool) ([]byte, error) {
+	headerSize := 4
+	if lzw2 {
+		headerSize = 2
+	}
+	if len(data) < headerSize {
+		return nil, errors.New("truncated LZW header")
+	}
+
+	fileCRC := binary.LittleEndian.Uint16(data[0:])
+	delimiter := data[headerSize-1]
+	position := headerSize
+
+	lzw := &nufxLZW{}
+	lzw.reset()
+	crc := uint16(0)
+	output := make([]byte, 0, length+nufxChunkSize)
+
+	for len(output) < length {
+		if position+4 > len(data) {
+			return nil, errors.New("truncated LZW chunk")
+		}
+
+		var rleLength int
+		var useLZW bool
+		var compressed []byte
+		if lzw2 {
+			chunkHeader := binary.LittleEndian.Uint16(data[position:])
+			rleLength = int(chunkHeader & 0x1FFF)
+			useLZW = chunkHeader&0x8000 != 0
+			position += 2
+			if useLZW {
+				// the LZW length includes the four byte chunk header
+				lzwLength := int(binary.LittleEndian.Uint16(data[position:])) - 4
+				position += 2
+				if lzwLength < 0 || position+lzwLength > len(data) {
+					return nil, errors.New("truncated LZW chunk")
+				}
+				compressed = data[position : position+lzwLength]
+				position += lzwLength
+			}
+		} else {
+			rleLength = int(binary.LittleEndian.Uint16(data[position:]))
+			useLZW = data[position+2] != 0
+			position += 3
+			compressed = data[position:]
+			lzw.reset()
+		}
+
+		var chunk []byte
+		if useLZW {
+			expanded, consumed, err := lzw.expand(compressed, rleLength)
+			if err != nil {
+				return nil, err
+			}
+			if !lzw2 {
+				position += consumed
+			}
+			chunk = expanded
+		} else {
+			// LZW/2 starts a new table after a chunk without LZW
+			lzw.reset()
+			if rleLength > nufxChunkSize || position+rleLength > len(data) {
+				return nil, errors.New("truncated LZW chunk")
+			}
+			chunk = data[position : position+rleLength]
+			position += rleLength
+		}
+
+		if rleLength != nufxChunkSize {
+			var err error
+			chunk, err = expandNuFXRLE(chunk, delimiter)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(chunk) != nufxChunkSize {
+			return nil, errors.New("invalid LZW chunk length")
+		}
+
+		crc = crc16(crc, chunk)
+		output = append(output, chunk...)
+	}
+
+	// LZW/1 has a CRC of all chunks including the padding of the last one
+	if !lzw2 && crc != fileCRC {
+		return nil, errors.New("LZW/1 CRC mismatch")
+	}
+
+	return output[:length], nil
+}
+
+// expandNuFXRLE expands runs which are stored as the delimiter
+// followed by the byte and the count minus one
+func expandNuFXRLE(data []byte, delimiter byte) ([]byte, error) {
+	output := make([]byte, 0, nufxChunkSize)
+
+	for i := 0; i < len(data); i++ {
+		if data[i] != delimiter {
+			output = append(output, data[i])
+			continue
+		}
+		if i+2 >= len(data) {
+			return nil, errors.New("truncated RLE run")
+		}
+		for count := 0; count <= int(data[i+2]); count++ {
+			output = append(output, data[i+1])
+		}
+		i += 2
+	}
+
+	return output, nil
+}
+
+// nufxLZW holds the string table, last code and final character of the
+// ShrinkIt LZW decoder which persist across chunks for LZW/2
+type nufxLZW struct {
+	prefix    [nufxLZWMaxCodes]uint16
+	suffix    [nufxLZWMaxCodes]byte
+	entry     int
+	oldCode   int
+	finalChar byte
+}
+
+func (lzw *nufxLZW) reset() {
+	lzw.entry = nufxLZWFirstCode
+}
+
+// expand decodes codes until length bytes have been output returning
+// the output and the number of bytes of input consumed
+func (lzw *nufxLZW) expand(data []byte, length int) ([]byte, int, error) {
+	output := make([]byte, 0, length)
+	stack := make([]byte, 0, nufxLZWMaxCodes)
+	bitPosition := 0
+	// the first code after a clear does not add an entry, LZW/2 keeps the
+	// table across chunks so the first code of a later chunk adds an entry
+	// with the last code of the previous chunk
+	first := lzw.entry == nufxLZWFirstCode
+
+	for len(output) < length {
+		width := getNuFXCodeWidth(lzw.entry)
+		if (bitPosition+width+7)/8 > len(data) {
+			return nil, 0, errors.New("truncated LZW data")
+		}
+		code := 0
+		for i := 0; i < width; i++ {
+			bit := int(data[(bitPosition+i)/8]>>((bitPosition+i)%8)) & 1
+			code |= bit << i
+		}
+		bitPosition += width
+
+		if code == nufxLZWClearCode {
+			lzw.reset()
+			first = true
+			continue
+		}
+
+		inCode := code
+		stack = stack[:0]
+		switch {
+		case code > lzw.entry || (first && code >= lzw.entry):
+			return nil, 0, errors.New("invalid LZW code")
+		case code == lzw.entry:
+			stack = append(stack, lzw.finalChar)
+			code = lzw.oldCode
+		}
+		for code > 0xFF {
+			stack = append(stack, lzw.suffix[code])
+			code = int(lzw.prefix[code])
+		}
+		lzw.finalChar = byte(code)
+		stack = append(stack, lzw.finalChar)
+
+		for i := len(stack) - 1; i >= 0; i-- {
+			output = append(output, stack[i])
+		}
+		if len(output) > length {
+			return nil, 0, errors.New("LZW data longer than chunk")
+		}
+
+		if !first && lzw.entry < nufxLZWMaxCodes {
+			lzw.prefix[lzw.entry] = uint16(lzw.oldCode)
+			lzw.suffix[lzw.entry] = lzw.finalChar
+			lzw.entry++
+		}
+		lzw.oldCode = inCode
+		first = false
+	}
+
+	return output, (bitPosition + 7) / 8, nil
+}
+
+// getNuFXCodeWidth returns the number of bits in a code based on the next
+// table entry, the decoder is one entry behind the compressor
+func getNuFXCodeWidth(entry int) int {
+	switch {
+	case entry+1 < 0x200:
+		return 9
+	case entry+1 < 0x400:
+		return 10
+	case entry+1 < 0x800:
+		return 11
+	}
+	return 12
+}
+
+// nufxDateTime converts the eight byte NuFX date time which stores
+// the year since 1900 and zero based day and month
+func nufxDateTime(buffer []byte) time.Time {
+	if bytes.Equal(buffer[0:6], []byte{0, 0, 0, 0, 0, 0}) {
+		return time.Time{}
+	}
+
+	year := 1900 + int(buffer[3])
+	if buffer[3] < 40 {
+		year += 100
+	}
+
+	return time.Date(year, time.Month(buffer[5]+1), int(buffer[4])+1,
+		int(buffer[2]), int(buffer[1]), int(buffer[0]), 0, time.Local)
+}
+
+// isBinaryIIHeader returns true if the data starts with a Binary II header
+func isBinaryIIHeader(data []byte) bool {
+	return len(data) >= 128 && data[0] == 0x0A && data[1] == 0x47 && data[2] == 0x4C && data[18] == 0x02
+}
+
+// crc16 calculates the CRC-16/XMODEM used by NuFX headers and threads
+func crc16(crc uint16, data []byte) uint16 {
+	for _, value := range data {
+		crc ^= uint16(value) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+
+	return crc
+}
+
+// setFileAccess sets the access bits of a file after it has been written
+func setFileAccess(readerWriter ReaderWriterAt, path string, access uint8) error {
+	fileEntry, err := GetFileEntry(readerWriter, path)
+	if err != nil {
+		return err
+	}
+
+	fileEntry.Access = access
+	return writeFileEntry(readerWriter, fileEntry)
+}
+
+// createParentDirectories creates any missing directories between
+// the base path and the file in the path
+func createParentDirectories(readerWriter ReaderWriterAt, path string, basePath string) error {
+	directory, _ := GetDirectoryAndFileNameFromPath(path)
+	if len(directory) <= len(basePath) {
+		return nil
+	}
+
+	existingFileEntry, _ := GetFileEntry(readerWriter, directory)
+	if existingFileEntry.StorageType == StorageDirectory {
+		return nil
+	}
+
+	err := createParentDirectories(readerWriter, directory, basePath)
+	if err != nil {
+		return err
+	}
+
+	return CreateDirectory(readerWriter, directory)
+}
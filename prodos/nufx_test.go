@@ -0,0 +1,716 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for reading and writing NuFX (ShrinkIt) archives
+
+package prodos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestExpandNuFXLZW(t *testing.T) {
+	random := make([]byte, 70000)
+	seed := uint32(12345)
+	for i := 0; i < len(random); i++ {
+		seed = seed*1103515245 + 12345
+		random[i] = byte(seed >> 16)
+	}
+	text := bytes.Repeat([]byte("10 PRINT \"HELLO WORLD\"\r20 GOTO 10\r"), 2000)
+	runs := append(bytes.Repeat([]byte{0xDB}, 5000), bytes.Repeat([]byte{0x00}, 9000)...)
+
+	var tests = []struct {
+		testName string
+		data     []byte
+	}{
+		{"empty", []byte{}},
+		{"short", []byte("hello")},
+		{"text", text},
+		{"runs", runs},
+		{"random", random},
+	}
+
+	for _, tt := range tests {
+		for _, lzw2 := range []bool{false, true} {
+			testName := tt.testName + "LZW1"
+			if lzw2 {
+				testName = tt.testName + "LZW2"
+			}
+			t.Run(testName, func(t *testing.T) {
+				compressed := compressTestLZW(tt.data, lzw2)
+				got, err := expandNuFXLZW(compressed, len(tt.data), lzw2)
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+				if !bytes.Equal(got, tt.data) {
+					t.Errorf("expanded data does not match")
+				}
+			})
+		}
+	}
+}
+
+func TestExpandNuFXLZWChunks(t *testing.T) {
+	// two run length encoded chunks given as 9 bit codes, the first chunk
+	// is AB then 4094 Cs and the second Z, FD, Z then 4093 Qs
+	runs := func(value byte, count int) []int {
+		codes := []int{}
+		for ; count > 256; count -= 256 {
+			codes = append(codes, nufxRLEDelimiter, int(value), 0xFF)
+		}
+		return append(codes, nufxRLEDelimiter, int(value), count-1)
+	}
+	firstChunk := append([]int{'A', 'B'}, runs('C', 4094)...)
+	want := append([]byte("AB"), bytes.Repeat([]byte("C"), 4094)...)
+
+	var tests = []struct {
+		testName    string
+		lzw2        bool
+		secondChunk []int
+		wantSecond  string
+	}{
+		// LZW/1 starts each chunk with a new table so 0101 repeats Z
+		{"LZW1", false, []int{'Z', 0x101}, "ZZZ"},
+		// LZW/2 adds 0132 for the last code of the first chunk, FD, and Z
+		{"LZW2", true, []int{'Z', 0x132}, "Z\xFDZ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			secondChunk := append(tt.secondChunk, runs('Q', 4096-len(tt.wantSecond))...)
+			wantData := append(append(append([]byte{}, want...), tt.wantSecond...), bytes.Repeat([]byte("Q"), 4096-len(tt.wantSecond))...)
+
+			data := []byte{0, 0, 0, nufxRLEDelimiter}
+			if tt.lzw2 {
+				data = []byte{0, nufxRLEDelimiter}
+			}
+			// the second code of the second chunk expands to two bytes
+			rleLengths := []int{len(firstChunk), len(secondChunk) + 1}
+			for i, codes := range [][]int{firstChunk, secondChunk} {
+				packed := packTestLZWCodes(codes)
+				header := make([]byte, 4)
+				if tt.lzw2 {
+					binary.LittleEndian.PutUint16(header[0:], uint16(rleLengths[i])|0x8000)
+					binary.LittleEndian.PutUint16(header[2:], uint16(len(packed)+4))
+				} else {
+					binary.LittleEndian.PutUint16(header[0:], uint16(rleLengths[i]))
+					header = header[:3]
+					header[2] = 1
+				}
+				data = append(append(data, header...), packed...)
+			}
+			if !tt.lzw2 {
+				binary.LittleEndian.PutUint16(data[0:], crc16(0, wantData))
+			}
+
+			got, err := expandNuFXLZW(data, len(wantData), tt.lzw2)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !bytes.Equal(got[4096:4099], wantData[4096:4099]) || !bytes.Equal(got, wantData) {
+				t.Errorf("got second chunk starting % X, want % X", got[4096:4099], wantData[4096:4099])
+			}
+		})
+	}
+}
+
+func TestReadNuFXArchive(t *testing.T) {
+	modifiedTime := time.Date(2025, time.March, 4, 5, 6, 0, 0, time.Local)
+	createdTime := time.Date(1989, time.December, 31, 23, 59, 0, 0, time.Local)
+	bigFile := bytes.Repeat([]byte("SHRINKIT "), 3000)
+	resourceFork := bytes.Repeat([]byte{1, 2, 3, 4}, 700)
+
+	records := []NuFXRecord{
+		{FileName: "HELLO", Access: 0x21, FileType: 0x04, AuxType: 0, DataFork: []byte("HELLO WORLD\r")},
+		{FileName: "GAMES/ARCADE/BIG", Access: 0xE3, FileType: 0x06, AuxType: 0x2000, DataFork: bigFile},
+		{FileName: "FORKED", Access: 0xC3, FileType: 0xB3, AuxType: 0xDB07, DataFork: []byte{}, ResourceFork: resourceFork, HasResourceFork: true},
+	}
+	for i := range records {
+		records[i].CreationTime = createdTime
+		records[i].ModifiedTime = modifiedTime
+	}
+
+	for _, format := range []uint16{nufxFormatUncompressed, nufxFormatLZW1, nufxFormatLZW2} {
+		for _, binaryII := range []bool{false, true} {
+			testName := []string{"uncompressed", "", "lzw1", "lzw2"}[format]
+			if binaryII {
+				testName += "BinaryII"
+			}
+			t.Run(testName, func(t *testing.T) {
+				archive := buildTestNuFXArchive(records, format)
+				if binaryII {
+					header := make([]byte, 128)
+					copy(header, []byte{0x0A, 0x47, 0x4C})
+					header[18] = 0x02
+					archive = append(header, archive...)
+				}
+
+				if !IsNuFXArchive(bytes.NewReader(archive)) {
+					t.Fatalf("got IsNuFXArchive false, want true")
+				}
+				gotRecords, err := ReadNuFXArchive(bytes.NewReader(archive), int64(len(archive)))
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+				if len(gotRecords) != len(records) {
+					t.Fatalf("got %d records, want %d", len(gotRecords), len(records))
+				}
+				for i, record := range records {
+					got := gotRecords[i]
+					if got.FileName != record.FileName || got.FileType != record.FileType ||
+						got.AuxType != record.AuxType || got.Access != record.Access {
+						t.Errorf("got %s %02X %04X %02X, want %s %02X %04X %02X",
+							got.FileName, got.FileType, got.AuxType, got.Access,
+							record.FileName, record.FileType, record.AuxType, record.Access)
+					}
+					if !got.ModifiedTime.Equal(modifiedTime) || !got.CreationTime.Equal(createdTime) {
+						t.Errorf("got dates %s %s", got.CreationTime, got.ModifiedTime)
+					}
+					if !bytes.Equal(got.DataFork, record.DataFork) || !bytes.Equal(got.ResourceFork, record.ResourceFork) {
+						t.Errorf("forks of %s do not match", record.FileName)
+					}
+				}
+
+				file := NewMemoryFile(0x2000000)
+				CreateVolume(file, "shk", 2048)
+				err = AddFilesFromNuFXArchive(file, gotRecords, "/shk", WriteFileOptions{})
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+
+				fileEntry, err := GetFileEntry(file, "/shk/games/arcade/big")
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+				if fileEntry.FileType != 0x06 || fileEntry.AuxType != 0x2000 || !fileEntry.ModifiedTime.Equal(modifiedTime) {
+					t.Errorf("got %02X %04X %s", fileEntry.FileType, fileEntry.AuxType, fileEntry.ModifiedTime)
+				}
+				gotFile, _ := LoadFile(file, "/shk/games/arcade/big")
+				if !bytes.Equal(gotFile, bigFile) {
+					t.Errorf("file written from archive does not match")
+				}
+
+				fileEntry, _ = GetFileEntry(file, "/shk/hello")
+				if fileEntry.Access != 0x21 {
+					t.Errorf("got access %02X, want 21", fileEntry.Access)
+				}
+
+				_, gotResourceFork, _, err := LoadFileForks(file, "/shk/forked")
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+				if !bytes.Equal(gotResourceFork, resourceFork) {
+					t.Errorf("resource fork written from archive does not match")
+				}
+			})
+		}
+	}
+}
+
+func TestReadNuFXDiskArchive(t *testing.T) {
+	image := NewMemoryFile(280 * 512)
+	CreateVolume(image, "disk", 280)
+	WriteFile(image, "/disk/hello", 0x04, 0, time.Now(), time.Now(), []byte("HELLO"))
+
+	records := []NuFXRecord{{FileName: "DISK", IsDisk: true, StorageType: 512, AuxType: 280, DataFork: image.data}}
+	archive := buildTestNuFXArchive(records, nufxFormatLZW2)
+
+	gotRecords, err := ReadNuFXArchive(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if len(gotRecords) != 1 || !gotRecords[0].IsDisk {
+		t.Fatalf("got no disk record")
+	}
+	if !bytes.Equal(gotRecords[0].DataFork, image.data) {
+		t.Errorf("disk image does not match")
+	}
+
+	corruptHeader := append([]byte{}, archive...)
+	corruptHeader[nufxMasterHeaderSize+20] ^= 0xFF
+	_, err = ReadNuFXArchive(bytes.NewReader(corruptHeader), int64(len(corruptHeader)))
+	if err == nil {
+		t.Errorf("got no error for corrupt record header")
+	}
+}
+
+func TestCreateNuFXArchiveFromVolume(t *testing.T) {
+	file := NewMemoryFile(0x2000000)
+	CreateVolume(file, "source", 2048)
+	CreateDirectory(file, "/source/docs")
+	text := bytes.Repeat([]byte("THE QUICK BROWN FOX\r"), 500)
+	WriteFile(file, "/source/readme", 0x04, 0, time.Now(), time.Now(), text)
+	WriteFile(file, "/source/docs/manual", 0x04, 0x0100, time.Now(), time.Now(), text[0:300])
+	WriteForkedFile(file, "/source/docs/icon", 0xCA, 0x0000, time.Now(), time.Now(), []byte{1, 2, 3}, text, nil, WriteFileOptions{})
+	CreateDirectory(file, "/source/docs/empty")
+
+	var tests = []struct {
+		testName  string
+		path      string
+		wantNames []string
+	}{
+		{"volume", "", []string{"DOCS", "DOCS/MANUAL", "DOCS/ICON", "DOCS/EMPTY", "README"}},
+		{"directory", "/source/docs", []string{"DOCS", "DOCS/MANUAL", "DOCS/ICON", "DOCS/EMPTY"}},
+		{"file", "/source/readme", []string{"README"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			records, err := GetNuFXRecords(file, tt.path)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			var buffer bytes.Buffer
+			err = CreateNuFXArchive(&buffer, records)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if buffer.Len() > len(text)/2 {
+				t.Errorf("got archive of %d bytes, want compressed", buffer.Len())
+			}
+
+			gotRecords, err := ReadNuFXArchive(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if len(gotRecords) != len(tt.wantNames) {
+				t.Fatalf("got %d records, want %d", len(gotRecords), len(tt.wantNames))
+			}
+			for i, wantName := range tt.wantNames {
+				if gotRecords[i].FileName != wantName {
+					t.Errorf("got %s, want %s", gotRecords[i].FileName, wantName)
+				}
+			}
+
+			target := NewMemoryFile(0x2000000)
+			CreateVolume(target, "target", 2048)
+			err = AddFilesFromNuFXArchive(target, gotRecords, "", WriteFileOptions{})
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			for i, wantName := range tt.wantNames {
+				wantEntry, _ := GetFileEntry(file, "/source/"+wantName)
+				if wantEntry.StorageType == StorageDirectory {
+					gotEntry, _ := GetFileEntry(target, "/target/"+wantName)
+					if gotEntry.StorageType != StorageDirectory || gotRecords[i].FileType != 0x0F {
+						t.Errorf("got %s storage type %d, want directory", wantName, gotEntry.StorageType)
+					}
+					continue
+				}
+				wantData, wantResource, _, _ := LoadFileForks(file, "/source/"+wantName)
+				gotData, gotResource, _, err := LoadFileForks(target, "/target/"+wantName)
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+				if !bytes.Equal(gotData, wantData) || !bytes.Equal(gotResource, wantResource) {
+					t.Errorf("%s does not match", wantName)
+				}
+			}
+		})
+	}
+
+	t.Run("disk", func(t *testing.T) {
+		record, err := GetNuFXDiskRecord(file)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		var buffer bytes.Buffer
+		err = CreateNuFXArchive(&buffer, []NuFXRecord{record})
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		gotRecords, err := ReadNuFXArchive(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if !gotRecords[0].IsDisk || !bytes.Equal(gotRecords[0].DataFork, file.data[0:2048*512]) {
+			t.Errorf("disk image does not match")
+		}
+	})
+}
+
+func TestCompressNuFXLZW2(t *testing.T) {
+	random := make([]byte, 20000)
+	seed := uint32(54321)
+	for i := 0; i < len(random); i++ {
+		seed = seed*1103515245 + 12345
+		random[i] = byte(seed >> 16)
+	}
+	text := bytes.Repeat([]byte("10 PRINT \"HELLO WORLD\"\r20 GOTO 10\r"), 2000)
+	words := []byte{}
+	for i := 0; len(words) < 100000; i++ {
+		words = append(words, fmt.Sprintf("%d %X LINE %d\r", i, i*7919, i%97)...)
+	}
+
+	var tests = []struct {
+		testName string
+		data     []byte
+	}{
+		{"short", []byte("hello")},
+		{"text", text},
+		{"words", words},
+		{"mixed", append(append(append([]byte{}, text[:9000]...), random...), words[:30000]...)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			compressed := compressNuFXLZW(tt.data, true)
+			got, err := expandTestLZW2(compressed, len(tt.data))
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("expanded data does not match")
+			}
+		})
+	}
+}
+
+func TestAddFilesFromNuFXArchiveKeepsSkippedAccess(t *testing.T) {
+	records := []NuFXRecord{{FileName: "README", FileType: 0x04, Access: 0xE3, DataFork: []byte("NEW")}}
+	volume := NewMemoryFile(0x2000000)
+	CreateVolume(volume, "target", 2048)
+	WriteFile(volume, "/target/readme", 0x04, 0, time.Now(), time.Now(), []byte("OLD"))
+	access := uint8(AccessRead)
+	SetFileInfo(volume, "/target/readme", FileInfoUpdate{Access: &access})
+
+	err := AddFilesFromNuFXArchive(volume, records, "", WriteFileOptions{IgnoreDuplicates: true})
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	fileEntry, _ := GetFileEntry(volume, "/target/readme")
+	if fileEntry.Access != AccessRead {
+		t.Errorf("got access %02X, want %02X", fileEntry.Access, AccessRead)
+	}
+	data, _ := LoadFile(volume, "/target/readme")
+	if string(data) != "OLD" {
+		t.Errorf("got %s, want OLD", data)
+	}
+}
+
+// packTestLZWCodes packs 9 bit LZW codes least significant bit first
+func packTestLZWCodes(codes []int) []byte {
+	packed := make([]byte, (len(codes)*9+7)/8)
+	for i, code := range codes {
+		for bit := 0; bit < 9; bit++ {
+			position := i*9 + bit
+			packed[position/8] |= byte((code>>bit)&1) << (position % 8)
+		}
+	}
+	return packed
+}
+
+// buildTestNuFXArchive creates an archive with all threads in one format
+func buildTestNuFXArchive(records []NuFXRecord, format uint16) []byte {
+	master := make([]byte, nufxMasterHeaderSize)
+	copy(master, nufxMasterID)
+	binary.LittleEndian.PutUint32(master[8:], uint32(len(records)))
+	binary.LittleEndian.PutUint16(master[28:], 2)
+
+	var body []byte
+	for _, record := range records {
+		type thread struct {
+			class, kind uint16
+			format      uint16
+			eof         int
+			data        []byte
+		}
+		threads := []thread{{nufxThreadClassFileName, 0, nufxFormatUncompressed, len(record.FileName), []byte(record.FileName)}}
+		addThread := func(kind uint16, data []byte) {
+			compressed := data
+			switch format {
+			case nufxFormatLZW1:
+				compressed = compressTestLZW(data, false)
+			case nufxFormatLZW2:
+				compressed = compressTestLZW(data, true)
+			}
+			threads = append(threads, thread{nufxThreadClassData, kind, format, len(data), compressed})
+		}
+		switch {
+		case record.IsDisk:
+			addThread(nufxThreadKindDiskImage, record.DataFork)
+		default:
+			addThread(nufxThreadKindDataFork, record.DataFork)
+			if record.HasResourceFork {
+				addThread(nufxThreadKindResourceFork, record.ResourceFork)
+			}
+		}
+
+		header := make([]byte, 60)
+		copy(header, nufxRecordID)
+		binary.LittleEndian.PutUint16(header[6:], 60)
+		binary.LittleEndian.PutUint16(header[8:], 3)
+		binary.LittleEndian.PutUint32(header[10:], uint32(len(threads)))
+		binary.LittleEndian.PutUint16(header[14:], 1)
+		header[16] = '/'
+		header[18] = record.Access
+		header[22] = record.FileType
+		binary.LittleEndian.PutUint32(header[26:], uint32(record.AuxType))
+		binary.LittleEndian.PutUint16(header[30:], record.StorageType)
+		copy(header[32:40], testNuFXDateTime(record.CreationTime))
+		copy(header[40:48], testNuFXDateTime(record.ModifiedTime))
+
+		var threadData []byte
+		for _, thread := range threads {
+			threadHeader := make([]byte, nufxThreadHeaderSize)
+			binary.LittleEndian.PutUint16(threadHeader[0:], thread.class)
+			binary.LittleEndian.PutUint16(threadHeader[2:], thread.format)
+			binary.LittleEndian.PutUint16(threadHeader[4:], thread.kind)
+			binary.LittleEndian.PutUint32(threadHeader[8:], uint32(thread.eof))
+			binary.LittleEndian.PutUint32(threadHeader[12:], uint32(len(thread.data)))
+			header = append(header, threadHeader...)
+			threadData = append(threadData, thread.data...)
+		}
+		binary.LittleEndian.PutUint16(header[4:], crc16(0, header[6:]))
+
+		body = append(body, header...)
+		body = append(body, threadData...)
+	}
+
+	binary.LittleEndian.PutUint32(master[38:], uint32(nufxMasterHeaderSize+len(body)))
+	binary.LittleEndian.PutUint16(master[6:], crc16(0, master[8:]))
+
+	return append(master, body...)
+}
+
+func testNuFXDateTime(dateTime time.Time) []byte {
+	if dateTime.IsZero() {
+		return make([]byte, 8)
+	}
+	return []byte{byte(dateTime.Second()), byte(dateTime.Minute()), byte(dateTime.Hour()),
+		byte(dateTime.Year() - 1900), byte(dateTime.Day() - 1), byte(dateTime.Month() - 1), 0, byte(dateTime.Weekday() + 1)}
+}
+
+// compressTestLZW compresses data the way ShrinkIt does with each 4096 byte
+// chunk run length encoded then LZW compressed. LZW/2 keeps the table and
+// the last code across chunks, adding an entry for the last code and the
+// first byte of the next chunk unless the table was just cleared.
+func compressTestLZW(data []byte, lzw2 bool) []byte {
+	const delimiter = 0xDB
+	output := []byte{0, 0, 0, delimiter}
+	if lzw2 {
+		output = []byte{0, delimiter}
+	}
+
+	table := make(map[int]int)
+	entry := nufxLZWFirstCode
+	prefix := 0
+	crc := uint16(0)
+
+	for start := 0; start < len(data); start += nufxChunkSize {
+		chunk := make([]byte, nufxChunkSize)
+		copy(chunk, data[start:])
+		crc = crc16(crc, chunk)
+
+		rle := compressTestRLE(chunk, delimiter)
+		if len(rle) >= nufxChunkSize {
+			rle = chunk
+		}
+		if !lzw2 {
+			table = make(map[int]int)
+			entry = nufxLZWFirstCode
+		}
+
+		var bits []byte
+		bitCount := 0
+		// the decoder is one entry behind the compressor
+		emit := func(code int) {
+			width := getNuFXCodeWidth(entry - 1)
+			for i := 0; i < width; i++ {
+				if bitCount%8 == 0 {
+					bits = append(bits, 0)
+				}
+				bits[bitCount/8] |= byte((code>>i)&1) << (bitCount % 8)
+				bitCount++
+			}
+		}
+		addEntry := func(key int) {
+			if _, found := table[key]; !found {
+				table[key] = entry
+			}
+			entry++
+			if entry == nufxLZWMaxCodes {
+				emit(nufxLZWClearCode)
+				table = make(map[int]int)
+				entry = nufxLZWFirstCode
+			}
+		}
+
+		if entry != nufxLZWFirstCode {
+			addEntry(prefix<<8 | int(rle[0]))
+		}
+		prefix = int(rle[0])
+		for _, value := range rle[1:] {
+			key := prefix<<8 | int(value)
+			if code, found := table[key]; found {
+				prefix = code
+				continue
+			}
+			emit(prefix)
+			addEntry(key)
+			prefix = int(value)
+		}
+		emit(prefix)
+
+		if lzw2 {
+			header := make([]byte, 4)
+			binary.LittleEndian.PutUint16(header[0:], uint16(len(rle))|0x8000)
+			binary.LittleEndian.PutUint16(header[2:], uint16(len(bits)+4))
+			output = append(output, header...)
+		} else {
+			header := []byte{0, 0, 1}
+			binary.LittleEndian.PutUint16(header[0:], uint16(len(rle)))
+			output = append(output, header...)
+		}
+		output = append(output, bits...)
+	}
+
+	if !lzw2 {
+		binary.LittleEndian.PutUint16(output[0:], crc)
+	}
+
+	return output
+}
+
+func compressTestRLE(data []byte, delimiter byte) []byte {
+	var output []byte
+	for i := 0; i < len(data); {
+		count := 1
+		for i+count < len(data) && data[i+count] == data[i] && count < 256 {
+			count++
+		}
+		if count > 3 || data[i] == delimiter {
+			output = append(output, delimiter, data[i], byte(count-1))
+		} else {
+			count = 1
+			output = append(output, data[i])
+		}
+		i += count
+	}
+	return output
+}
+
+// expandTestLZW2 follows the NufxLib LZW/2 expander where the table, entry,
+// old code and final character carry across chunks and only the first code
+// of a new table, at the start or after a clear, adds no entry
+func expandTestLZW2(data []byte, length int) ([]byte, error) {
+	// code widths indexed by the next entry plus one divided by 256
+	widths := []int{0, 9, 10, 10, 11, 11, 11, 11, 12, 12, 12, 12, 12, 12, 12, 12, 12}
+	var prefix [0x1000]int
+	var suffix [0x1000]byte
+	entry := nufxLZWFirstCode
+	oldCode := 0
+	finalChar := byte(0)
+	delimiter := data[1]
+	position := 2
+	var output []byte
+
+	for len(output) < length {
+		chunkStart := position
+		chunkHeader := int(binary.LittleEndian.Uint16(data[position:]))
+		rleLength := chunkHeader & 0x1FFF
+		position += 2
+
+		var rle []byte
+		if chunkHeader&0x8000 == 0 {
+			entry = nufxLZWFirstCode
+			rle = data[position : position+rleLength]
+			position += rleLength
+		} else {
+			chunkEnd := chunkStart + int(binary.LittleEndian.Uint16(data[position:]))
+			position += 2
+			atBit := 0
+			getCode := func() (int, error) {
+				width := widths[(entry+1)>>8]
+				if (atBit+width+7)/8 > chunkEnd-position {
+					return 0, fmt.Errorf("code past end of chunk at %d", chunkStart)
+				}
+				code := 0
+				for i := 0; i < width; i++ {
+					bit := atBit + i
+					code |= int(data[position+bit/8]>>(bit%8)&1) << i
+				}
+				atBit += width
+				return code, nil
+			}
+
+			if entry == nufxLZWFirstCode {
+				code, err := getCode()
+				if err != nil {
+					return nil, err
+				}
+				oldCode, finalChar = code, byte(code)
+				rle = append(rle, finalChar)
+			}
+			for len(rle) < rleLength {
+				inCode, err := getCode()
+				if err != nil {
+					return nil, err
+				}
+				if inCode == nufxLZWClearCode {
+					entry = nufxLZWFirstCode
+					code, err := getCode()
+					if err != nil {
+						return nil, err
+					}
+					oldCode, finalChar = code, byte(code)
+					rle = append(rle, finalChar)
+					continue
+				}
+
+				code := inCode
+				stack := []byte{}
+				if code > entry {
+					return nil, fmt.Errorf("code %03X past entry %03X", code, entry)
+				}
+				if code == entry {
+					stack = append(stack, finalChar)
+					code = oldCode
+				}
+				for code > 0xFF {
+					if len(stack) > len(suffix) {
+						return nil, fmt.Errorf("code %03X loops", inCode)
+					}
+					stack = append(stack, suffix[code])
+					code = prefix[code]
+				}
+				finalChar = byte(code)
+				stack = append(stack, finalChar)
+				for i := len(stack) - 1; i >= 0; i-- {
+					rle = append(rle, stack[i])
+				}
+
+				prefix[entry] = oldCode
+				suffix[entry] = finalChar
+				entry++
+				oldCode = inCode
+			}
+			position = chunkEnd
+		}
+
+		chunk := rle
+		if rleLength != nufxChunkSize {
+			chunk = nil
+			for i := 0; i < len(rle); i++ {
+				if rle[i] == delimiter {
+					chunk = append(chunk, bytes.Repeat(rle[i+1:i+2], int(rle[i+2])+1)...)
+					i += 2
+				} else {
+					chunk = append(chunk, rle[i])
+				}
+			}
+		}
+		if len(chunk) != nufxChunkSize {
+			return nil, fmt.Errorf("chunk at %d expanded to %d bytes", chunkStart, len(chunk))
+		}
+		output = append(output, chunk...)
+	}
+
+	return output[:length], nil
+}
@@ -0,0 +1,414 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides creation of NuFX (ShrinkIt) archives from
+// files and volumes on a ProDOS drive image
+
+package prodos
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	nufxRecordAttributeCount = 60
+	nufxRecordVersion        = 3
+	nufxFileSysProDOS        = 1
+	nufxRLEDelimiter         = 0xDB
+	// ShrinkIt leaves room to rename files in the archive
+	nufxFileNameThreadSize = 32
+)
+
+// GetNuFXRecords returns a record for the file at the specified path or
+// records for every file and directory below it if the path is a
+// directory. Files in a subdirectory are named relative to the parent of
+// that subdirectory and each directory has a record so empty directories
+// are kept.
+func GetNuFXRecords(reader io.ReaderAt, path string) ([]NuFXRecord, error) {
+	fileEntry, err := GetFileEntry(reader, path)
+	if err == nil && fileEntry.StorageType != StorageDirectory {
+		record, err := getNuFXRecord(reader, path, fileEntry, fileEntry.FileName)
+		if err != nil {
+			return nil, err
+		}
+		return []NuFXRecord{record}, nil
+	}
+
+	var records []NuFXRecord
+	prefix := ""
+	if err == nil {
+		records = append(records, getNuFXDirectoryRecord(fileEntry, fileEntry.FileName))
+		prefix = fileEntry.FileName + "/"
+	}
+
+	directoryRecords, err := getNuFXRecordsInDirectory(reader, strings.TrimSuffix(path, "/"), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(records, directoryRecords...), nil
+}
+
+// GetNuFXDiskRecord returns a disk image record with every block of a volume
+func GetNuFXDiskRecord(reader io.ReaderAt) (NuFXRecord, error) {
+	volumeHeader, _, _, err := ReadDirectory(reader, "")
+	if err != nil {
+		return NuFXRecord{}, err
+	}
+
+	diskImage := make([]byte, int(volumeHeader.TotalBlocks)*512)
+	_, err = reader.ReadAt(diskImage, 0)
+	if err != nil {
+		return NuFXRecord{}, fmt.Errorf("failed to read volume: %w", err)
+	}
+
+	return NuFXRecord{
+		FileName:     volumeHeader.VolumeName,
+		FileSysID:    nufxFileSysProDOS,
+		Access:       0xE3,
+		AuxType:      volumeHeader.TotalBlocks,
+		StorageType:  512,
+		CreationTime: volumeHeader.CreationTime,
+		ModifiedTime: volumeHeader.CreationTime,
+		IsDisk:       true,
+		DataFork:     diskImage,
+	}, nil
+}
+
+// CreateNuFXArchive writes a NuFX archive of the records compressing
+// each thread with LZW/2 unless it does not get smaller
+func CreateNuFXArchive(writer io.Writer, records []NuFXRecord) error {
+	return writeNuFXArchive(writer, records, nufxFormatLZW2)
+}
+
+func getNuFXRecordsInDirectory(reader io.ReaderAt, path string, prefix string) ([]NuFXRecord, error) {
+	_, _, fileEntries, err := ReadDirectory(reader, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(path) == 0 {
+		volumeHeader, _, _, err := ReadDirectory(reader, "")
+		if err != nil {
+			return nil, err
+		}
+		path = "/" + volumeHeader.VolumeName
+	}
+
+	var records []NuFXRecord
+	for _, fileEntry := range fileEntries {
+		filePath := path + "/" + fileEntry.FileName
+		if fileEntry.StorageType == StorageDirectory {
+			records = append(records, getNuFXDirectoryRecord(fileEntry, prefix+fileEntry.FileName))
+			directoryRecords, err := getNuFXRecordsInDirectory(reader, filePath, prefix+fileEntry.FileName+"/")
+			if err != nil {
+				return nil, err
+			}
+			records = append(records, directoryRecords...)
+			continue
+		}
+
+		record, err := getNuFXRecord(reader, filePath, fileEntry, prefix+fileEntry.FileName)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+func getNuFXRecord(reader io.ReaderAt, path string, fileEntry FileEntry, name string) (NuFXRecord, error) {
+	dataFork, resourceFork, _, err := LoadFileForks(reader, path)
+	if err != nil {
+		return NuFXRecord{}, err
+	}
+
+	return NuFXRecord{
+		FileName:        name,
+		FileSysID:       nufxFileSysProDOS,
+		Access:          fileEntry.Access,
+		FileType:        fileEntry.FileType,
+		AuxType:         fileEntry.AuxType,
+		StorageType:     uint16(fileEntry.StorageType),
+		CreationTime:    fileEntry.CreationTime,
+		ModifiedTime:    fileEntry.ModifiedTime,
+		DataFork:        dataFork,
+		ResourceFork:    resourceFork,
+		HasResourceFork: fileEntry.StorageType == StorageExtended,
+	}, nil
+}
+
+// getNuFXDirectoryRecord returns a record for a directory, which has
+// no data threads
+func getNuFXDirectoryRecord(fileEntry FileEntry, name string) NuFXRecord {
+	return NuFXRecord{
+		FileName:     name,
+		FileSysID:    nufxFileSysProDOS,
+		Access:       fileEntry.Access,
+		FileType:     0x0F,
+		StorageType:  StorageDirectory,
+		CreationTime: fileEntry.CreationTime,
+		ModifiedTime: fileEntry.ModifiedTime,
+	}
+}
+
+// writeNuFXArchive writes an archive with data threads in the specified
+// format falling back to uncompressed when compression does not help
+func writeNuFXArchive(writer io.Writer, records []NuFXRecord, format uint16) error {
+	now := time.Now()
+	var body []byte
+
+	for _, record := range records {
+		var threadHeaders []byte
+		var threadData []byte
+		addThread := func(class uint16, kind uint16, data []byte) {
+			threadFormat := uint16(nufxFormatUncompressed)
+			compressed := data
+			if class == nufxThreadClassFileName {
+				compressed = make([]byte, len(data))
+				copy(compressed, data)
+				for len(compressed) < nufxFileNameThreadSize {
+					compressed = append(compressed, 0)
+				}
+			} else if format != nufxFormatUncompressed && len(data) > 0 {
+				lzw := compressNuFXLZW(data, format == nufxFormatLZW2)
+				if len(lzw) < len(data) {
+					threadFormat = format
+					compressed = lzw
+				}
+			}
+
+			threadHeader := make([]byte, nufxThreadHeaderSize)
+			binary.LittleEndian.PutUint16(threadHeader[0:], class)
+			binary.LittleEndian.PutUint16(threadHeader[2:], threadFormat)
+			binary.LittleEndian.PutUint16(threadHeader[4:], kind)
+			binary.LittleEndian.PutUint16(threadHeader[6:], crc16(0xFFFF, data))
+			binary.LittleEndian.PutUint32(threadHeader[8:], uint32(len(data)))
+			binary.LittleEndian.PutUint32(threadHeader[12:], uint32(len(compressed)))
+			threadHeaders = append(threadHeaders, threadHeader...)
+			threadData = append(threadData, compressed...)
+		}
+
+		fileName := strings.ReplaceAll(record.FileName, "/", ":")
+		addThread(nufxThreadClassFileName, 0, []byte(fileName))
+		extraType := uint32(record.AuxType)
+		if record.IsDisk {
+			addThread(nufxThreadClassData, nufxThreadKindDiskImage, record.DataFork)
+			extraType = uint32(len(record.DataFork) / 512)
+		} else if record.StorageType != StorageDirectory {
+			addThread(nufxThreadClassData, nufxThreadKindDataFork, record.DataFork)
+			if record.HasResourceFork {
+				addThread(nufxThreadClassData, nufxThreadKindResourceFork, record.ResourceFork)
+			}
+		}
+
+		header := make([]byte, nufxRecordAttributeCount)
+		copy(header, nufxRecordID)
+		binary.LittleEndian.PutUint16(header[6:], nufxRecordAttributeCount)
+		binary.LittleEndian.PutUint16(header[8:], nufxRecordVersion)
+		binary.LittleEndian.PutUint32(header[10:], uint32(len(threadHeaders)/nufxThreadHeaderSize))
+		binary.LittleEndian.PutUint16(header[14:], nufxFileSysProDOS)
+		header[16] = ':'
+		header[18] = record.Access
+		header[22] = record.FileType
+		binary.LittleEndian.PutUint32(header[26:], extraType)
+		binary.LittleEndian.PutUint16(header[30:], record.StorageType)
+		copy(header[32:40], nufxDateTimeToBytes(record.CreationTime))
+		copy(header[40:48], nufxDateTimeToBytes(record.ModifiedTime))
+		copy(header[48:56], nufxDateTimeToBytes(now))
+		header = append(header, threadHeaders...)
+		binary.LittleEndian.PutUint16(header[4:], crc16(0, header[6:]))
+
+		body = append(body, header...)
+		body = append(body, threadData...)
+	}
+
+	master := make([]byte, nufxMasterHeaderSize)
+	copy(master, nufxMasterID)
+	binary.LittleEndian.PutUint32(master[8:], uint32(len(records)))
+	copy(master[12:20], nufxDateTimeToBytes(now))
+	copy(master[20:28], nufxDateTimeToBytes(now))
+	binary.LittleEndian.PutUint16(master[28:], 2)
+	binary.LittleEndian.PutUint32(master[38:], uint32(nufxMasterHeaderSize+len(body)))
+	binary.LittleEndian.PutUint16(master[6:], crc16(0, master[8:]))
+
+	_, err := writer.Write(append(master, body...))
+	return err
+}
+
+// compressNuFXLZW compresses data the way ShrinkIt does with each 4096 byte
+// chunk run length encoded then LZW compressed, for LZW/2 the string table
+// carries over between chunks
+func compressNuFXLZW(data []byte, lzw2 bool) []byte {
+	output := []byte{0, 0, 0, nufxRLEDelimiter}
+	if lzw2 {
+		output = []byte{0, nufxRLEDelimiter}
+	}
+
+	lzw := newNuFXLZWCompressor()
+	crc := uint16(0)
+
+	for start := 0; start < len(data); start += nufxChunkSize {
+		chunk := make([]byte, nufxChunkSize)
+		copy(chunk, data[start:])
+		crc = crc16(crc, chunk)
+
+		rle := compressNuFXRLE(chunk, nufxRLEDelimiter)
+		if len(rle) >= nufxChunkSize {
+			rle = chunk
+		}
+		if !lzw2 {
+			lzw.reset()
+		}
+		compressed := lzw.compress(rle)
+
+		if lzw2 {
+			header := make([]byte, 4)
+			if len(compressed)+4 >= len(rle)+2 {
+				// the decoder starts a new table after an uncompressed chunk
+				lzw.reset()
+				binary.LittleEndian.PutUint16(header[0:], uint16(len(rle)))
+				output = append(output, header[0:2]...)
+				output = append(output, rle...)
+				continue
+			}
+			binary.LittleEndian.PutUint16(header[0:], uint16(len(rle))|0x8000)
+			binary.LittleEndian.PutUint16(header[2:], uint16(len(compressed)+4))
+			output = append(output, header...)
+			output = append(output, compressed...)
+			continue
+		}
+
+		header := make([]byte, 3)
+		binary.LittleEndian.PutUint16(header[0:], uint16(len(rle)))
+		if len(compressed) >= len(rle) {
+			output = append(output, header...)
+			output = append(output, rle...)
+			continue
+		}
+		header[2] = 1
+		output = append(output, header...)
+		output = append(output, compressed...)
+	}
+
+	if !lzw2 {
+		binary.LittleEndian.PutUint16(output[0:], crc)
+	}
+
+	return output
+}
+
+// compressNuFXRLE replaces runs of four or more bytes, and any delimiter
+// bytes, with the delimiter followed by the byte and the count minus one
+func compressNuFXRLE(data []byte, delimiter byte) []byte {
+	var output []byte
+
+	for i := 0; i < len(data); {
+		count := 1
+		for i+count < len(data) && data[i+count] == data[i] && count < 256 {
+			count++
+		}
+		if count > 3 || data[i] == delimiter {
+			output = append(output, delimiter, data[i], byte(count-1))
+		} else {
+			count = 1
+			output = append(output, data[i])
+		}
+		i += count
+	}
+
+	return output
+}
+
+// nufxLZWCompressor holds the string table and last code of the ShrinkIt
+// LZW compressor which persist across chunks for LZW/2
+type nufxLZWCompressor struct {
+	table  map[int]int
+	entry  int
+	prefix int
+}
+
+func newNuFXLZWCompressor() *nufxLZWCompressor {
+	lzw := &nufxLZWCompressor{}
+	lzw.reset()
+	return lzw
+}
+
+func (lzw *nufxLZWCompressor) reset() {
+	lzw.table = make(map[int]int)
+	lzw.entry = nufxLZWFirstCode
+}
+
+// compress returns the codes for a chunk packed least significant bit first
+func (lzw *nufxLZWCompressor) compress(data []byte) []byte {
+	var output []byte
+	bitCount := 0
+	// the decoder adds no entry for the first code after a clear so it is
+	// one entry behind the compressor
+	emit := func(code int) {
+		width := getNuFXCodeWidth(lzw.entry - 1)
+		for i := 0; i < width; i++ {
+			if bitCount%8 == 0 {
+				output = append(output, 0)
+			}
+			output[bitCount/8] |= byte((code>>i)&1) << (bitCount % 8)
+			bitCount++
+		}
+	}
+	addEntry := func(key int) {
+		if _, found := lzw.table[key]; !found {
+			lzw.table[key] = lzw.entry
+		}
+		lzw.entry++
+		if lzw.entry == nufxLZWMaxCodes {
+			emit(nufxLZWClearCode)
+			lzw.reset()
+		}
+	}
+
+	// the decoder adds an entry for the last code of the previous chunk
+	// and the first byte of this one unless the table is new
+	if lzw.entry != nufxLZWFirstCode {
+		addEntry(lzw.prefix<<8 | int(data[0]))
+	}
+
+	lzw.prefix = int(data[0])
+	for _, value := range data[1:] {
+		key := lzw.prefix<<8 | int(value)
+		if code, found := lzw.table[key]; found {
+			lzw.prefix = code
+			continue
+		}
+
+		emit(lzw.prefix)
+		addEntry(key)
+		lzw.prefix = int(value)
+	}
+	emit(lzw.prefix)
+
+	return output
+}
+
+// nufxDateTimeToBytes converts to the eight byte NuFX date time
+func nufxDateTimeToBytes(dateTime time.Time) []byte {
+	if dateTime.IsZero() {
+		return make([]byte, 8)
+	}
+
+	return []byte{
+		byte(dateTime.Second()),
+		byte(dateTime.Minute()),
+		byte(dateTime.Hour()),
+		byte(dateTime.Year() - 1900),
+		byte(dateTime.Day() - 1),
+		byte(dateTime.Month() - 1),
+		0,
+		byte(dateTime.Weekday() + 1),
+	}
+}
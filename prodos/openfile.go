@@ -0,0 +1,685 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides open files that read and write blocks
+// as needed on a ProDOS drive image
+
+package prodos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// maxEndOfFile is the largest end of file that fits in a directory entry
+const maxEndOfFile = 0xFFFFFF
+
+// File is an open file on a ProDOS volume that walks its index blocks
+// as data is read and allocates blocks as data is written, changing
+// between seedling, sapling and tree storage as the file grows or shrinks.
+// Extended files are read and written as their data fork. The directory
+// entry and volume bitmap are updated by Sync or Close, so the volume
+// must not be changed other than through the File while it is open for
+// writing.
+type File struct {
+	readerWriter  ReaderWriterAt
+	path          string
+	flag          int
+	fileEntry     FileEntry
+	fork          FileEntry
+	offset        int64
+	indexBlocks   map[uint16][]byte
+	volumeBitmap  []byte
+	totalBlocks   uint16
+	nextFree      uint16
+	changed       bool
+	bitmapChanged bool
+	closed        bool
+}
+
+// Open opens a file on a ProDOS volume for reading
+func Open(reader io.ReaderAt, path string) (*File, error) {
+	return openFile(readOnlyReaderWriter{reader}, path, os.O_RDONLY)
+}
+
+// OpenFile opens a file on a ProDOS volume using os.O_RDONLY, os.O_WRONLY
+// or os.O_RDWR combined with os.O_APPEND, os.O_CREATE, os.O_EXCL and
+// os.O_TRUNC. Files that are created have a file type of $00.
+func OpenFile(readerWriter ReaderWriterAt, path string, flag int) (*File, error) {
+	return openFile(readerWriter, path, flag)
+}
+
+func openFile(readerWriter ReaderWriterAt, path string, flag int) (*File, error) {
+	writing := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	fileEntry, err := GetFileEntry(readerWriter, path)
+	if err != nil {
+		if flag&os.O_CREATE == 0 || !writing {
+			return nil, err
+		}
+		_, fileName := GetDirectoryAndFileNameFromPath(path)
+		err = validateFileName(fileName)
+		if err != nil {
+			return nil, err
+		}
+		err = WriteFile(readerWriter, path, 0x00, 0x0000, time.Now(), time.Now(), []byte{})
+		if err != nil {
+			return nil, err
+		}
+		fileEntry, err = GetFileEntry(readerWriter, path)
+		if err != nil {
+			return nil, err
+		}
+	} else if flag&os.O_CREATE != 0 && flag&os.O_EXCL != 0 {
+		return nil, &PathError{Op: "open", Path: path, Err: ErrExists}
+	}
+
+	if fileEntry.StorageType == StorageDirectory {
+		return nil, errors.New("path is a directory")
+	}
+	if writing && fileEntry.Access&AccessWrite == 0 {
+		return nil, &PathError{Op: "open", Path: path, Err: ErrLocked}
+	}
+
+	forkEntry := fileEntry
+	if fileEntry.StorageType == StorageExtended {
+		forkEntry, _, err = readExtendedKeyBlock(readerWriter, fileEntry)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if forkEntry.StorageType < StorageSeedling || forkEntry.StorageType > StorageTree {
+		return nil, &PathError{Op: "open", Path: path, Block: fileEntry.KeyPointer, Err: ErrUnsupportedStorage}
+	}
+
+	file := &File{
+		readerWriter: readerWriter,
+		path:         path,
+		flag:         flag,
+		fileEntry:    fileEntry,
+		fork:         forkEntry,
+		indexBlocks:  make(map[uint16][]byte),
+	}
+
+	if writing && flag&os.O_TRUNC != 0 {
+		err = file.Truncate(0)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return file, nil
+}
+
+// Entry returns the directory entry of the file, the storage type, key
+// pointer, blocks used and end of file are only updated by Sync
+func (file *File) Entry() FileEntry {
+	return file.fileEntry
+}
+
+// Size returns the end of file of the data
+func (file *File) Size() int64 {
+	return int64(file.fork.EndOfFile)
+}
+
+// Read reads from the current position
+func (file *File) Read(data []byte) (int, error) {
+	count, err := file.ReadAt(data, file.offset)
+	file.offset += int64(count)
+	return count, err
+}
+
+// ReadAt reads from an offset in the file, blocks missing from sparse
+// files are read as zeroes
+func (file *File) ReadAt(data []byte, offset int64) (int, error) {
+	err := file.check("read", false)
+	if err != nil {
+		return 0, err
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+
+	count := 0
+	for count < len(data) {
+		position := offset + int64(count)
+		if position >= int64(file.fork.EndOfFile) {
+			return count, io.EOF
+		}
+		blockOffset := int(position % 512)
+		length := min(512-blockOffset, len(data)-count, int(int64(file.fork.EndOfFile)-position))
+
+		block, _, err := file.dataBlock(uint32(position/512), false)
+		if err != nil {
+			return count, err
+		}
+		if block == 0 {
+			clear(data[count : count+length])
+		} else {
+			buffer, err := ReadBlock(file.readerWriter, block)
+			if err != nil {
+				return count, err
+			}
+			copy(data[count:count+length], buffer[blockOffset:])
+		}
+		count += length
+	}
+
+	return count, nil
+}
+
+// Seek sets the position for the next Read or Write
+func (file *File) Seek(offset int64, whence int) (int64, error) {
+	if file.closed {
+		return 0, fs.ErrClosed
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += file.offset
+	case io.SeekEnd:
+		offset += int64(file.fork.EndOfFile)
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	file.offset = offset
+	return offset, nil
+}
+
+// Write writes at the current position or at the end of file
+// if opened with os.O_APPEND
+func (file *File) Write(data []byte) (int, error) {
+	err := file.check("write", true)
+	if err != nil {
+		return 0, err
+	}
+	if file.flag&os.O_APPEND != 0 {
+		file.offset = int64(file.fork.EndOfFile)
+	}
+
+	count, err := file.writeAt(data, file.offset)
+	file.offset += int64(count)
+	return count, err
+}
+
+// WriteAt writes at an offset in the file allocating blocks as needed,
+// writing past the end of file leaves a sparse gap that reads as zeroes
+func (file *File) WriteAt(data []byte, offset int64) (int, error) {
+	err := file.check("write", true)
+	if err != nil {
+		return 0, err
+	}
+	if file.flag&os.O_APPEND != 0 {
+		return 0, errors.New("cannot write at an offset when opened with append")
+	}
+
+	return file.writeAt(data, offset)
+}
+
+func (file *File) writeAt(data []byte, offset int64) (int, error) {
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	end := offset + int64(len(data))
+	if end > maxEndOfFile {
+		return 0, errors.New("files > 16MB not supported by ProDOS")
+	}
+
+	if end > int64(file.fork.EndOfFile) {
+		if offset > int64(file.fork.EndOfFile) {
+			err := file.zeroAfterEndOfFile()
+			if err != nil {
+				return 0, err
+			}
+		}
+		err := file.growStorage(uint32(end))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	count := 0
+	for count < len(data) {
+		position := offset + int64(count)
+		blockOffset := int(position % 512)
+		length := min(512-blockOffset, len(data)-count)
+
+		block, allocated, err := file.dataBlock(uint32(position/512), true)
+		if err != nil {
+			return count, err
+		}
+		var buffer []byte
+		if allocated || length == 512 {
+			buffer = make([]byte, 512)
+		} else {
+			buffer, err = ReadBlock(file.readerWriter, block)
+			if err != nil {
+				return count, err
+			}
+		}
+		copy(buffer[blockOffset:], data[count:count+length])
+		err = WriteBlock(file.readerWriter, block, buffer)
+		if err != nil {
+			return count, err
+		}
+
+		count += length
+		file.changed = true
+		if uint32(position)+uint32(length) > file.fork.EndOfFile {
+			file.fork.EndOfFile = uint32(position) + uint32(length)
+		}
+	}
+
+	return count, nil
+}
+
+// Truncate changes the end of file freeing the blocks past a smaller end
+// of file, a larger end of file leaves a sparse gap that reads as zeroes
+func (file *File) Truncate(size int64) error {
+	err := file.check("truncate", true)
+	if err != nil {
+		return err
+	}
+	if size < 0 || size > maxEndOfFile {
+		errString := fmt.Sprintf("invalid file size %d", size)
+		return errors.New(errString)
+	}
+
+	file.changed = true
+	if uint32(size) >= file.fork.EndOfFile {
+		err = file.zeroAfterEndOfFile()
+		if err != nil {
+			return err
+		}
+		err = file.growStorage(uint32(size))
+		if err != nil {
+			return err
+		}
+		file.fork.EndOfFile = uint32(size)
+		return nil
+	}
+
+	err = file.freeBlocksAfter((uint32(size) + 511) / 512)
+	if err != nil {
+		return err
+	}
+	for file.fork.StorageType > storageTypeForSize(uint32(size)) {
+		err = file.shrinkStorage()
+		if err != nil {
+			return err
+		}
+	}
+	file.fork.EndOfFile = uint32(size)
+
+	return nil
+}
+
+// Sync writes the directory entry and volume bitmap
+func (file *File) Sync() error {
+	if file.closed {
+		return fs.ErrClosed
+	}
+
+	if file.bitmapChanged {
+		err := writeVolumeBitmap(file.readerWriter, file.volumeBitmap)
+		if err != nil {
+			return err
+		}
+		file.bitmapChanged = false
+	}
+
+	if !file.changed {
+		return nil
+	}
+
+	if file.fileEntry.StorageType == StorageExtended {
+		keyBlock, err := ReadBlock(file.readerWriter, file.fileEntry.KeyPointer)
+		if err != nil {
+			return err
+		}
+		oldForkEntry := parseForkEntry(keyBlock)
+		writeForkEntry(keyBlock, file.fork)
+		err = WriteBlock(file.readerWriter, file.fileEntry.KeyPointer, keyBlock)
+		if err != nil {
+			return err
+		}
+		file.fileEntry.BlocksUsed = file.fileEntry.BlocksUsed - oldForkEntry.BlocksUsed + file.fork.BlocksUsed
+	} else {
+		file.fileEntry.StorageType = file.fork.StorageType
+		file.fileEntry.KeyPointer = file.fork.KeyPointer
+		file.fileEntry.BlocksUsed = file.fork.BlocksUsed
+		file.fileEntry.EndOfFile = file.fork.EndOfFile
+	}
+	file.fileEntry.ModifiedTime = time.Now()
+
+	err := writeFileEntry(file.readerWriter, file.fileEntry)
+	if err != nil {
+		return err
+	}
+	file.changed = false
+
+	return nil
+}
+
+// Close syncs the file, the drive image itself is left open
+func (file *File) Close() error {
+	if file.closed {
+		return fs.ErrClosed
+	}
+
+	err := file.Sync()
+	file.closed = true
+	return err
+}
+
+// check returns an error if the file is closed or was not
+// opened for reading or writing
+func (file *File) check(op string, writing bool) error {
+	if file.closed {
+		return fs.ErrClosed
+	}
+
+	access := file.flag & (os.O_RDONLY | os.O_WRONLY | os.O_RDWR)
+	if writing && access == os.O_RDONLY || !writing && access == os.O_WRONLY {
+		errString := fmt.Sprintf("cannot %s %s, file not opened for %sing", op, file.path, op)
+		return errors.New(errString)
+	}
+
+	return nil
+}
+
+// storageTypeForSize returns the storage type needed for an end of file
+func storageTypeForSize(size uint32) uint8 {
+	switch {
+	case size <= 0x200:
+		return StorageSeedling
+	case size <= 0x20000:
+		return StorageSapling
+	}
+	return StorageTree
+}
+
+// dataBlock returns the block holding a block of data, a zero block
+// is a gap in a sparse file unless allocate is set
+func (file *File) dataBlock(index uint32, allocate bool) (uint16, bool, error) {
+	switch file.fork.StorageType {
+	case StorageSeedling:
+		if index > 0 {
+			return 0, false, nil
+		}
+		return file.fork.KeyPointer, false, nil
+	case StorageSapling:
+		if index >= 256 {
+			return 0, false, nil
+		}
+		return file.indexEntry(file.fork.KeyPointer, index, allocate, false)
+	case StorageTree:
+		if index >= 128*256 {
+			return 0, false, nil
+		}
+		indexBlock, _, err := file.indexEntry(file.fork.KeyPointer, index/256, allocate, true)
+		if err != nil || indexBlock == 0 {
+			return 0, false, err
+		}
+		return file.indexEntry(indexBlock, index%256, allocate, false)
+	}
+
+	return 0, false, &PathError{Op: "read", Path: file.path, Block: file.fork.KeyPointer, Err: ErrUnsupportedStorage}
+}
+
+// indexEntry returns the block an index block points to, allocating
+// it if needed and zeroing new index blocks
+func (file *File) indexEntry(indexBlock uint16, entry uint32, allocate bool, newIndex bool) (uint16, bool, error) {
+	buffer, err := file.readIndexBlock(indexBlock)
+	if err != nil {
+		return 0, false, err
+	}
+	block := uint16(buffer[entry]) + uint16(buffer[entry+256])*256
+	if block != 0 || !allocate {
+		return block, false, nil
+	}
+
+	block, err = file.allocateBlock()
+	if err != nil {
+		return 0, false, err
+	}
+	if newIndex {
+		err = file.writeIndexBlock(block, make([]byte, 512))
+		if err != nil {
+			return 0, false, err
+		}
+	}
+
+	buffer[entry] = byte(block & 0x00FF)
+	buffer[entry+256] = byte(block >> 8)
+	return block, true, file.writeIndexBlock(indexBlock, buffer)
+}
+
+func (file *File) readIndexBlock(indexBlock uint16) ([]byte, error) {
+	buffer, found := file.indexBlocks[indexBlock]
+	if found {
+		return buffer, nil
+	}
+
+	buffer, err := ReadBlock(file.readerWriter, indexBlock)
+	if err != nil {
+		return nil, err
+	}
+	file.indexBlocks[indexBlock] = buffer
+	return buffer, nil
+}
+
+func (file *File) writeIndexBlock(indexBlock uint16, buffer []byte) error {
+	file.indexBlocks[indexBlock] = buffer
+	return WriteBlock(file.readerWriter, indexBlock, buffer)
+}
+
+// growStorage adds index blocks until the storage type fits the size,
+// the old key block becomes the first entry of the new index block
+func (file *File) growStorage(size uint32) error {
+	for file.fork.StorageType < storageTypeForSize(size) {
+		indexBlock, err := file.allocateBlock()
+		if err != nil {
+			return err
+		}
+		buffer := make([]byte, 512)
+		buffer[0] = byte(file.fork.KeyPointer & 0x00FF)
+		buffer[256] = byte(file.fork.KeyPointer >> 8)
+		err = file.writeIndexBlock(indexBlock, buffer)
+		if err != nil {
+			return err
+		}
+
+		file.fork.KeyPointer = indexBlock
+		file.fork.StorageType++
+		file.changed = true
+	}
+
+	return nil
+}
+
+// shrinkStorage removes the key index block making its first entry the
+// key block, which needs to be allocated if it is a gap in a sparse file
+func (file *File) shrinkStorage() error {
+	buffer, err := file.readIndexBlock(file.fork.KeyPointer)
+	if err != nil {
+		return err
+	}
+	keyBlock := uint16(buffer[0]) + uint16(buffer[256])*256
+	if keyBlock == 0 {
+		keyBlock, err = file.allocateBlock()
+		if err != nil {
+			return err
+		}
+		err = WriteBlock(file.readerWriter, keyBlock, make([]byte, 512))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = file.freeBlock(file.fork.KeyPointer)
+	if err != nil {
+		return err
+	}
+	file.fork.KeyPointer = keyBlock
+	file.fork.StorageType--
+
+	return nil
+}
+
+// freeBlocksAfter frees the data blocks from a block of data onwards
+// along with the index blocks no longer needed
+func (file *File) freeBlocksAfter(firstBlock uint32) error {
+	switch file.fork.StorageType {
+	case StorageSapling:
+		return file.freeIndexEntries(file.fork.KeyPointer, firstBlock)
+	case StorageTree:
+		masterIndex, err := file.readIndexBlock(file.fork.KeyPointer)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for i := uint32(0); i < 128; i++ {
+			indexBlock := uint16(masterIndex[i]) + uint16(masterIndex[i+256])*256
+			if indexBlock == 0 || (i+1)*256 <= firstBlock {
+				continue
+			}
+			first := uint32(0)
+			if i*256 < firstBlock {
+				first = firstBlock - i*256
+			}
+			err = file.freeIndexEntries(indexBlock, first)
+			if err != nil {
+				return err
+			}
+			if first == 0 {
+				err = file.freeBlock(indexBlock)
+				if err != nil {
+					return err
+				}
+				masterIndex[i] = 0
+				masterIndex[i+256] = 0
+				changed = true
+			}
+		}
+		if changed {
+			return file.writeIndexBlock(file.fork.KeyPointer, masterIndex)
+		}
+	}
+
+	return nil
+}
+
+// freeIndexEntries frees the blocks an index block points to from an entry onwards
+func (file *File) freeIndexEntries(indexBlock uint16, first uint32) error {
+	buffer, err := file.readIndexBlock(indexBlock)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for i := first; i < 256; i++ {
+		block := uint16(buffer[i]) + uint16(buffer[i+256])*256
+		if block != 0 {
+			err = file.freeBlock(block)
+			if err != nil {
+				return err
+			}
+			buffer[i] = 0
+			buffer[i+256] = 0
+			changed = true
+		}
+	}
+	if changed {
+		return file.writeIndexBlock(indexBlock, buffer)
+	}
+
+	return nil
+}
+
+// zeroAfterEndOfFile zeroes the rest of the last block of data so it
+// reads as zeroes when the end of file is moved past it
+func (file *File) zeroAfterEndOfFile() error {
+	block, _, err := file.dataBlock(file.fork.EndOfFile/512, false)
+	if err != nil || block == 0 {
+		return err
+	}
+
+	buffer := make([]byte, 512)
+	if file.fork.EndOfFile%512 > 0 {
+		buffer, err = ReadBlock(file.readerWriter, block)
+		if err != nil {
+			return err
+		}
+		clear(buffer[file.fork.EndOfFile%512:])
+	}
+	return WriteBlock(file.readerWriter, block, buffer)
+}
+
+// allocateBlock marks the next free block as used in the volume bitmap
+func (file *File) allocateBlock() (uint16, error) {
+	err := file.loadVolumeBitmap()
+	if err != nil {
+		return 0, err
+	}
+
+	for block := int(file.nextFree); block < int(file.totalBlocks); block++ {
+		if checkFreeBlockInVolumeBitmap(file.volumeBitmap, uint16(block)) {
+			markBlockInVolumeBitmap(file.volumeBitmap, uint16(block))
+			file.nextFree = uint16(block + 1)
+			file.bitmapChanged = true
+			file.fork.BlocksUsed++
+			file.changed = true
+			return uint16(block), nil
+		}
+	}
+
+	return 0, &PathError{Op: "write", Path: file.path, Err: ErrDiskFull}
+}
+
+// freeBlock marks a block as free in the volume bitmap
+func (file *File) freeBlock(block uint16) error {
+	err := file.loadVolumeBitmap()
+	if err != nil {
+		return err
+	}
+
+	freeBlockInVolumeBitmap(file.volumeBitmap, block)
+	if block < file.nextFree {
+		file.nextFree = block
+	}
+	delete(file.indexBlocks, block)
+	file.bitmapChanged = true
+	file.fork.BlocksUsed--
+	file.changed = true
+	return nil
+}
+
+func (file *File) loadVolumeBitmap() error {
+	if file.volumeBitmap != nil {
+		return nil
+	}
+
+	buffer, err := ReadBlock(file.readerWriter, 2)
+	if err != nil {
+		return err
+	}
+	volumeBitmap, err := ReadVolumeBitmap(file.readerWriter)
+	if err != nil {
+		return err
+	}
+
+	file.totalBlocks = parseVolumeHeader(buffer).TotalBlocks
+	file.volumeBitmap = volumeBitmap
+	return nil
+}
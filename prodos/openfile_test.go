@@ -0,0 +1,206 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for open files
+
+package prodos
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+)
+
+func TestOpenRead(t *testing.T) {
+	volume := createVerifyVolume()
+
+	file, err := Open(volume, "/verify/large")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	defer file.Close()
+
+	got, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if !bytes.Equal(got, bytes.Repeat([]byte{2}, 200000)) {
+		t.Errorf("got %d bytes that do not match, want 200000", len(got))
+	}
+
+	position, _ := file.Seek(-10, io.SeekEnd)
+	if position != 199990 {
+		t.Errorf("got position %d, want 199990", position)
+	}
+	buffer := make([]byte, 20)
+	count, err := file.Read(buffer)
+	if count != 10 || err != io.EOF {
+		t.Errorf("got %d bytes with error %v, want 10 with EOF", count, err)
+	}
+
+	_, err = file.Write([]byte{1})
+	if err == nil {
+		t.Errorf("got no error, want error writing a file opened for reading")
+	}
+}
+
+func TestOpenFileWrite(t *testing.T) {
+	var tests = []struct {
+		testName        string
+		sizes           []int
+		wantStorageType uint8
+	}{
+		{"seedling", []int{100, 300}, StorageSeedling},
+		{"sapling", []int{500, 700, 5000}, StorageSapling},
+		{"tree", []int{100, 130000, 200000}, StorageTree},
+		{"treeToSeedling", []int{200000, 10}, StorageSeedling},
+		{"treeToSapling", []int{200000, 1000}, StorageSapling},
+		{"saplingToSeedling", []int{10000, 512}, StorageSeedling},
+		{"empty", []int{5000, 0}, StorageSeedling},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			volume := createVerifyVolume()
+			volumeBitmap, _ := ReadVolumeBitmap(volume)
+			freeBlocks := GetFreeBlockCount(volumeBitmap, 2048)
+
+			file, err := OpenFile(volume, "/verify/docs/stream", os.O_RDWR|os.O_CREATE|os.O_EXCL)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			// grow to each size with bytes based on their position or truncate to it
+			want := []byte{}
+			for _, size := range tt.sizes {
+				if size < len(want) {
+					err = file.Truncate(int64(size))
+					want = want[:size]
+				} else {
+					data := make([]byte, size-len(want))
+					for i := range data {
+						data[i] = byte((len(want) + i) % 251)
+					}
+					_, err = file.Write(data)
+					want = append(want, data...)
+				}
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+			}
+			err = file.Close()
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			fileEntry, _ := GetFileEntry(volume, "/verify/docs/stream")
+			if fileEntry.StorageType != tt.wantStorageType || fileEntry.EndOfFile != uint32(len(want)) {
+				t.Errorf("got storage type %d end of file %d, want %d and %d",
+					fileEntry.StorageType, fileEntry.EndOfFile, tt.wantStorageType, len(want))
+			}
+			got, _ := LoadFile(volume, "/verify/docs/stream")
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %d bytes that do not match, want %d", len(got), len(want))
+			}
+
+			report, _ := Verify(volume)
+			if report.HasProblems() {
+				t.Errorf("got problems %v", report.Problems)
+			}
+			volumeBitmap, _ = ReadVolumeBitmap(volume)
+			gotFreeBlocks := GetFreeBlockCount(volumeBitmap, 2048)
+			if gotFreeBlocks != freeBlocks-fileEntry.BlocksUsed {
+				t.Errorf("got %d free blocks, want %d", gotFreeBlocks, freeBlocks-fileEntry.BlocksUsed)
+			}
+		})
+	}
+}
+
+func TestOpenFileWriteAt(t *testing.T) {
+	volume := createVerifyVolume()
+
+	file, err := OpenFile(volume, "/verify/large", os.O_RDWR)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	_, err = file.WriteAt([]byte("MIDDLE"), 100000)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	_, err = file.WriteAt([]byte("END"), 300000)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	file.Close()
+
+	want := bytes.Repeat([]byte{2}, 300003)
+	copy(want[100000:], "MIDDLE")
+	clear(want[200000:300000])
+	copy(want[300000:], "END")
+	got, _ := LoadFile(volume, "/verify/large")
+	if !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes that do not match, want %d", len(got), len(want))
+	}
+
+	fileEntry, _ := GetFileEntry(volume, "/verify/large")
+	// 392 data blocks, 3 index blocks and the master index
+	if fileEntry.BlocksUsed != 396 {
+		t.Errorf("got %d blocks used, want 396 with the gap left sparse", fileEntry.BlocksUsed)
+	}
+	report, _ := Verify(volume)
+	if report.HasProblems() {
+		t.Errorf("got problems %v", report.Problems)
+	}
+}
+
+func TestOpenFileExtended(t *testing.T) {
+	volume := createVerifyVolume()
+
+	file, err := OpenFile(volume, "/verify/forked", os.O_WRONLY|os.O_APPEND)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	file.Write(bytes.Repeat([]byte{4}, 1000))
+	file.Close()
+
+	dataFork, resourceFork, _, _ := LoadFileForks(volume, "/verify/forked")
+	if !bytes.Equal(dataFork, append([]byte{1}, bytes.Repeat([]byte{4}, 1000)...)) {
+		t.Errorf("got data fork of %d bytes that does not match, want 1001", len(dataFork))
+	}
+	if !bytes.Equal(resourceFork, bytes.Repeat([]byte{3}, 1000)) {
+		t.Errorf("got resource fork of %d bytes that changed", len(resourceFork))
+	}
+	report, _ := Verify(volume)
+	if report.HasProblems() {
+		t.Errorf("got problems %v", report.Problems)
+	}
+}
+
+func TestOpenFileErrors(t *testing.T) {
+	volume := createVerifyVolume()
+	access := uint8(AccessRead)
+	SetFileInfo(volume, "/verify/small", FileInfoUpdate{Access: &access})
+
+	var tests = []struct {
+		testName string
+		path     string
+		flag     int
+	}{
+		{"missing", "/verify/none", os.O_RDWR},
+		{"exclusive", "/verify/large", os.O_RDWR | os.O_CREATE | os.O_EXCL},
+		{"locked", "/verify/small", os.O_WRONLY},
+		{"directory", "/verify/docs", os.O_RDONLY},
+		{"invalidName", "/verify/1bad", os.O_RDWR | os.O_CREATE},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			_, err := OpenFile(volume, tt.path, tt.flag)
+			if err == nil {
+				t.Errorf("got no error, want error")
+			}
+		})
+	}
+}
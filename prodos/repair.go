@@ -0,0 +1,574 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides repair of damaged ProDOS drive images with a
+// backup of every changed block so the repair can be reverted
+
+package prodos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const lostFoundDirectory = "LOST.FOUND"
+
+// "PDOUBLKS" marks a backup of blocks changed by Repair
+var blockBackupID = []byte{0x50, 0x44, 0x4F, 0x55, 0x42, 0x4C, 0x4B, 0x53}
+
+// blockBackup passes reads and writes through to a drive image writing the
+// original contents of each block to the backup the first time it is
+// written, as the block number followed by the contents of the block
+type blockBackup struct {
+	readerWriter ReaderWriterAt
+	writer       io.Writer
+	saved        map[uint16]bool
+}
+
+func (backup *blockBackup) ReadAt(data []byte, offset int64) (int, error) {
+	return backup.readerWriter.ReadAt(data, offset)
+}
+
+// WriteAt saves the original blocks before passing the write through so
+// the backup has every block that was changed even if the repair stops
+func (backup *blockBackup) WriteAt(data []byte, offset int64) (int, error) {
+	if len(data) > 0 {
+		for block := offset / 512; block <= (offset+int64(len(data))-1)/512; block++ {
+			if backup.saved[uint16(block)] {
+				continue
+			}
+			original, err := ReadBlock(backup.readerWriter, uint16(block))
+			if err != nil {
+				return 0, err
+			}
+			record := binary.LittleEndian.AppendUint16(nil, uint16(block))
+			_, err = backup.writer.Write(append(record, original...))
+			if err != nil {
+				return 0, fmt.Errorf("failed to write block backup: %w", err)
+			}
+			backup.saved[uint16(block)] = true
+		}
+	}
+
+	return backup.readerWriter.WriteAt(data, offset)
+}
+
+type repairer struct {
+	readerWriter ReaderWriterAt
+	totalBlocks  uint16
+	owners       map[uint16]bool
+	emptiedForks []uint32
+	fixes        []string
+}
+
+// Repair fixes a damaged ProDOS volume by following every directory and
+// file. Directory block links and file count headers are corrected, entries
+// with key blocks beyond the volume or used by another file are removed,
+// index pointers beyond the volume or cross-linked are cleared, BlocksUsed
+// and EndOfFile are recalculated and the volume bitmap is rebuilt. Blocks
+// that were allocated but not used by any file and are not empty are saved
+// as files in LOST.FOUND. The original contents of every changed block are
+// written to the backup before they change so RestoreBlockBackup can
+// revert the repair, even one that failed part way. A description of each
+// fix is returned.
+func Repair(readerWriter ReaderWriterAt, backup io.Writer) ([]string, error) {
+	buffer, err := ReadBlock(readerWriter, 2)
+	if err != nil {
+		return nil, err
+	}
+	if buffer[4]>>4 != 0x0F {
+		return nil, errors.New("missing ProDOS volume header")
+	}
+	volumeHeader := parseVolumeHeader(buffer)
+
+	_, err = backup.Write(blockBackupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to write block backup: %w", err)
+	}
+
+	blockBackup := &blockBackup{readerWriter: readerWriter, writer: backup, saved: make(map[uint16]bool)}
+	r := &repairer{
+		readerWriter: blockBackup,
+		totalBlocks:  volumeHeader.TotalBlocks,
+		owners:       make(map[uint16]bool),
+	}
+
+	r.markBlock(0)
+	r.markBlock(1)
+	r.markBlock(2)
+	bitmapBlocks := (uint32(volumeHeader.TotalBlocks) + 4095) / 4096
+	for i := uint16(0); i < uint16(bitmapBlocks); i++ {
+		r.markBlock(volumeHeader.BitmapStartBlock + i)
+	}
+
+	_, err = r.repairDirectory("/"+volumeHeader.VolumeName, 2, 0, 0)
+	if err == nil {
+		err = r.rebuildVolumeBitmap(volumeHeader.VolumeName)
+	}
+
+	return r.fixes, err
+}
+
+// RestoreBlockBackup writes the original blocks saved by Repair
+// back to the drive image
+func RestoreBlockBackup(readerWriter ReaderWriterAt, backup io.Reader) error {
+	data, err := io.ReadAll(backup)
+	if err != nil {
+		return fmt.Errorf("failed to read block backup: %w", err)
+	}
+	if len(data) < len(blockBackupID) || string(data[:len(blockBackupID)]) != string(blockBackupID) {
+		return errors.New("missing block backup ID")
+	}
+	data = data[len(blockBackupID):]
+	if len(data)%514 != 0 {
+		return errors.New("truncated block backup")
+	}
+
+	for offset := 0; offset < len(data); offset += 514 {
+		block := binary.LittleEndian.Uint16(data[offset:])
+		err = WriteBlock(readerWriter, block, data[offset+2:offset+514])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *repairer) addFix(format string, a ...interface{}) {
+	r.fixes = append(r.fixes, fmt.Sprintf(format, a...))
+}
+
+// markBlock records a block as used returning false if it is
+// beyond the volume or already used
+func (r *repairer) markBlock(block uint16) bool {
+	if block >= r.totalBlocks || r.owners[block] {
+		return false
+	}
+	r.owners[block] = true
+	return true
+}
+
+func (r *repairer) writeLink(block uint16, offset int64, value uint16) error {
+	_, err := r.readerWriter.WriteAt([]byte{byte(value), byte(value >> 8)}, int64(block)*512+offset)
+	return err
+}
+
+// repairDirectory follows the blocks of a directory fixing links and
+// entries, returning the number of blocks in the directory
+func (r *repairer) repairDirectory(path string, keyBlock uint16, parentBlock uint16, parentEntry uint16) (uint16, error) {
+	previousBlock := uint16(0)
+	blockCount := uint16(0)
+	activeFileCount := uint16(0)
+
+	for block := keyBlock; block != 0; {
+		buffer, err := ReadBlock(r.readerWriter, block)
+		if err != nil {
+			return 0, err
+		}
+		blockCount++
+
+		if uint16(buffer[0])+uint16(buffer[1])*256 != previousBlock {
+			r.addFix("%s: fixed previous link of directory block %04X", path, block)
+			err = r.writeLink(block, 0, previousBlock)
+			if err != nil {
+				return 0, err
+			}
+		}
+
+		entryOffset := 4
+		if block == keyBlock {
+			directoryHeader := parseDirectoryHeader(buffer, block)
+			if directoryHeader.IsSubDirectory &&
+				(directoryHeader.ParentBlock != parentBlock ||
+					(directoryHeader.ParentEntry != parentEntry && directoryHeader.ParentEntry != parentEntry-1)) {
+				r.addFix("%s: fixed parent link of directory header", path)
+				directoryHeader.ParentBlock = parentBlock
+				directoryHeader.ParentEntry = parentEntry
+				err = writeDirectoryHeader(r.readerWriter, directoryHeader)
+				if err != nil {
+					return 0, err
+				}
+			}
+			entryOffset += 39
+		}
+
+		for ; entryOffset+39 <= 512; entryOffset += 39 {
+			if buffer[entryOffset]>>4 == StorageDeleted {
+				continue
+			}
+			fileEntry := parseFileEntry(buffer[entryOffset:entryOffset+39], block, uint16(entryOffset))
+			keep, err := r.repairFileEntry(path+"/"+fileEntry.FileName, fileEntry, directoryEntryNumber(uint16(entryOffset)))
+			if err != nil {
+				return 0, err
+			}
+			if !keep {
+				_, err = r.readerWriter.WriteAt(make([]byte, 39), int64(block)*512+int64(entryOffset))
+				if err != nil {
+					return 0, err
+				}
+				continue
+			}
+			activeFileCount++
+		}
+
+		nextBlock := uint16(buffer[2]) + uint16(buffer[3])*256
+		if nextBlock != 0 && !r.markBlock(nextBlock) {
+			r.addFix("%s: removed invalid next link %04X of directory block %04X", path, nextBlock, block)
+			err = r.writeLink(block, 2, 0)
+			if err != nil {
+				return 0, err
+			}
+			nextBlock = 0
+		}
+
+		previousBlock = block
+		block = nextBlock
+	}
+
+	buffer, err := ReadBlock(r.readerWriter, keyBlock)
+	if err != nil {
+		return 0, err
+	}
+	directoryHeader := parseDirectoryHeader(buffer, keyBlock)
+	if directoryHeader.ActiveFileCount != activeFileCount {
+		r.addFix("%s: fixed file count from %d to %d", path, directoryHeader.ActiveFileCount, activeFileCount)
+		directoryHeader.ActiveFileCount = activeFileCount
+		err = writeDirectoryHeader(r.readerWriter, directoryHeader)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return blockCount, nil
+}
+
+// repairFileEntry repairs the blocks of a file or directory and its
+// BlocksUsed and EndOfFile, returning false if the entry must be removed
+func (r *repairer) repairFileEntry(path string, fileEntry FileEntry, entryNumber uint16) (bool, error) {
+	if fileEntry.StorageType == StoragePascal {
+		// a Pascal area is a range of blocks
+		for i := uint16(0); i < fileEntry.BlocksUsed; i++ {
+			r.markBlock(fileEntry.KeyPointer + i)
+		}
+		return true, nil
+	}
+
+	if fileEntry.StorageType != StorageSeedling && fileEntry.StorageType != StorageSapling &&
+		fileEntry.StorageType != StorageTree && fileEntry.StorageType != StorageExtended &&
+		fileEntry.StorageType != StorageDirectory {
+		r.addFix("%s: removed entry with unsupported storage type %d", path, fileEntry.StorageType)
+		return false, nil
+	}
+	if !r.markBlock(fileEntry.KeyPointer) {
+		r.addFix("%s: removed entry with invalid or cross-linked key block %04X", path, fileEntry.KeyPointer)
+		return false, nil
+	}
+
+	var blocksUsed uint16
+	endOfFile := fileEntry.EndOfFile
+	var err error
+	switch fileEntry.StorageType {
+	case StorageDirectory:
+		blocksUsed, err = r.repairDirectory(path, fileEntry.KeyPointer, fileEntry.DirectoryBlock, entryNumber)
+		endOfFile = uint32(blocksUsed) * 512
+	case StorageExtended:
+		blocksUsed, err = r.repairExtendedFile(path, fileEntry.KeyPointer)
+	default:
+		var minEndOfFile, maxEndOfFile uint32
+		blocksUsed, minEndOfFile, maxEndOfFile, err = r.repairFileBlocks(path, fileEntry.StorageType, fileEntry.KeyPointer)
+		endOfFile = clampEndOfFile(endOfFile, minEndOfFile, maxEndOfFile)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if blocksUsed != fileEntry.BlocksUsed || endOfFile != fileEntry.EndOfFile {
+		r.addFix("%s: fixed blocks used from %d to %d and end of file from %d to %d",
+			path, fileEntry.BlocksUsed, blocksUsed, fileEntry.EndOfFile, endOfFile)
+		fileEntry.BlocksUsed = blocksUsed
+		fileEntry.EndOfFile = endOfFile
+		err = writeFileEntry(r.readerWriter, fileEntry)
+	}
+
+	return true, err
+}
+
+// repairExtendedFile repairs both forks of an extended file returning
+// the number of blocks including the key block
+func (r *repairer) repairExtendedFile(path string, keyBlock uint16) (uint16, error) {
+	buffer, err := ReadBlock(r.readerWriter, keyBlock)
+	if err != nil {
+		return 0, err
+	}
+
+	blocksUsed := uint16(1)
+	changed := false
+	for _, offset := range []int{0x000, 0x100} {
+		forkEntry := parseForkEntry(buffer[offset:])
+		validStorageType := forkEntry.StorageType >= StorageSeedling && forkEntry.StorageType <= StorageTree
+		if !validStorageType || !r.markBlock(forkEntry.KeyPointer) {
+			// the fork is emptied and given a free block once the
+			// blocks in use by every file are known
+			r.addFix("%s: emptied fork with invalid key block %04X", path, forkEntry.KeyPointer)
+			copy(buffer[offset:offset+8], []byte{StorageSeedling, 0, 0, 1, 0, 0, 0, 0})
+			r.emptiedForks = append(r.emptiedForks, uint32(keyBlock)*512+uint32(offset))
+			blocksUsed++
+			changed = true
+			continue
+		}
+
+		forkBlocksUsed, minEndOfFile, maxEndOfFile, err := r.repairFileBlocks(path, forkEntry.StorageType, forkEntry.KeyPointer)
+		if err != nil {
+			return 0, err
+		}
+		endOfFile := clampEndOfFile(forkEntry.EndOfFile, minEndOfFile, maxEndOfFile)
+		if forkBlocksUsed != forkEntry.BlocksUsed || endOfFile != forkEntry.EndOfFile {
+			r.addFix("%s: fixed fork blocks used from %d to %d", path, forkEntry.BlocksUsed, forkBlocksUsed)
+			buffer[offset+3] = byte(forkBlocksUsed)
+			buffer[offset+4] = byte(forkBlocksUsed >> 8)
+			buffer[offset+5] = byte(endOfFile)
+			buffer[offset+6] = byte(endOfFile >> 8)
+			buffer[offset+7] = byte(endOfFile >> 16)
+			changed = true
+		}
+		blocksUsed += forkBlocksUsed
+	}
+
+	if changed {
+		err = WriteBlock(r.readerWriter, keyBlock, buffer)
+	}
+
+	return blocksUsed, err
+}
+
+// repairFileBlocks clears index pointers that are beyond the volume or
+// cross-linked returning the number of blocks including index blocks and
+// the smallest and largest end of file for the data blocks in the index
+func (r *repairer) repairFileBlocks(path string, storageType uint8, keyBlock uint16) (uint16, uint32, uint32, error) {
+	if storageType == StorageSeedling {
+		return 1, 0, 512, nil
+	}
+	if storageType == StorageSapling {
+		dataBlocks, lastDataBlock, err := r.repairIndexBlock(path, keyBlock, false)
+		return 1 + dataBlocks, endOfFileAfter(lastDataBlock), 256 * 512, err
+	}
+
+	// the master index of a tree points to index blocks
+	indexBlocks, _, err := r.repairIndexBlock(path, keyBlock, true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	masterIndex, err := ReadBlock(r.readerWriter, keyBlock)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	blocksUsed := 1 + indexBlocks
+	minEndOfFile := uint32(0)
+	for i := 0; i < 128; i++ {
+		indexBlock := uint16(masterIndex[i]) + uint16(masterIndex[i+256])*256
+		if indexBlock == 0 {
+			continue
+		}
+		dataBlocks, lastDataBlock, err := r.repairIndexBlock(path, indexBlock, false)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		blocksUsed += dataBlocks
+		if lastDataBlock >= 0 {
+			minEndOfFile = endOfFileAfter(i*256 + lastDataBlock)
+		}
+	}
+
+	return blocksUsed, minEndOfFile, 128 * 256 * 512, nil
+}
+
+// endOfFileAfter returns the smallest end of file that
+// includes a data block or zero for no data block
+func endOfFileAfter(dataBlock int) uint32 {
+	if dataBlock < 0 {
+		return 0
+	}
+	return uint32(dataBlock)*512 + 1
+}
+
+func clampEndOfFile(endOfFile uint32, minEndOfFile uint32, maxEndOfFile uint32) uint32 {
+	if endOfFile < minEndOfFile {
+		return minEndOfFile
+	}
+	if endOfFile > maxEndOfFile {
+		return maxEndOfFile
+	}
+	return endOfFile
+}
+
+// repairIndexBlock clears invalid pointers in an index block returning the
+// number of valid pointers and the position of the last one or -1 if there
+// are none, a master index only has 128 pointers
+func (r *repairer) repairIndexBlock(path string, indexBlock uint16, master bool) (uint16, int, error) {
+	index, err := ReadBlock(r.readerWriter, indexBlock)
+	if err != nil {
+		return 0, -1, err
+	}
+
+	pointers := 256
+	if master {
+		pointers = 128
+	}
+
+	count := uint16(0)
+	last := -1
+	changed := false
+	for i := 0; i < 256; i++ {
+		block := uint16(index[i]) + uint16(index[i+256])*256
+		if block == 0 {
+			continue
+		}
+		if i < pointers && r.markBlock(block) {
+			count++
+			last = i
+			continue
+		}
+		r.addFix("%s: cleared invalid or cross-linked block pointer %04X", path, block)
+		index[i] = 0
+		index[i+256] = 0
+		changed = true
+	}
+
+	if changed {
+		err = WriteBlock(r.readerWriter, indexBlock, index)
+	}
+
+	return count, last, err
+}
+
+// rebuildVolumeBitmap writes a volume bitmap with only the blocks in use
+// allocated, saving the contents of allocated blocks that are not in use
+// and not empty to LOST.FOUND
+func (r *repairer) rebuildVolumeBitmap(volumeName string) error {
+	volumeBitmap, err := ReadVolumeBitmap(r.readerWriter)
+	if err != nil {
+		return err
+	}
+
+	err = r.allocateEmptiedForks(volumeBitmap)
+	if err != nil {
+		return err
+	}
+
+	newVolumeBitmap := make([]byte, len(volumeBitmap))
+	copy(newVolumeBitmap, volumeBitmap)
+	var orphanedBlocks []uint16
+	changed := false
+	for block := uint16(0); block < r.totalBlocks; block++ {
+		free := checkFreeBlockInVolumeBitmap(volumeBitmap, block)
+		switch {
+		case r.owners[block] && free:
+			markBlockInVolumeBitmap(newVolumeBitmap, block)
+			changed = true
+		case !r.owners[block] && !free:
+			freeBlockInVolumeBitmap(newVolumeBitmap, block)
+			changed = true
+			orphanedBlocks = append(orphanedBlocks, block)
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	r.addFix("rebuilt volume bitmap")
+	err = writeVolumeBitmap(r.readerWriter, newVolumeBitmap)
+	if err != nil {
+		return err
+	}
+
+	return r.saveOrphanedBlocks(volumeName, orphanedBlocks)
+}
+
+// allocateEmptiedForks gives each emptied fork an empty key block
+// that was free and is not used by any file
+func (r *repairer) allocateEmptiedForks(volumeBitmap []byte) error {
+	block := uint16(0)
+	for _, forkOffset := range r.emptiedForks {
+		for block < r.totalBlocks && (r.owners[block] || !checkFreeBlockInVolumeBitmap(volumeBitmap, block)) {
+			block++
+		}
+		if block >= r.totalBlocks {
+			return fmt.Errorf("no free block for emptied fork: %w", ErrDiskFull)
+		}
+		r.owners[block] = true
+
+		err := WriteBlock(r.readerWriter, block, make([]byte, 512))
+		if err == nil {
+			_, err = r.readerWriter.WriteAt([]byte{byte(block), byte(block >> 8)}, int64(forkOffset)+1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// saveOrphanedBlocks writes each run of consecutive orphaned blocks that
+// are not empty to a file in LOST.FOUND named with the first block number
+func (r *repairer) saveOrphanedBlocks(volumeName string, orphanedBlocks []uint16) error {
+	type run struct {
+		start uint16
+		data  []byte
+	}
+	var runs []run
+	for i, block := range orphanedBlocks {
+		buffer, err := ReadBlock(r.readerWriter, block)
+		if err != nil {
+			return err
+		}
+		if i > 0 && orphanedBlocks[i-1] == block-1 && len(runs) > 0 &&
+			runs[len(runs)-1].start+uint16(len(runs[len(runs)-1].data)/512) == block {
+			runs[len(runs)-1].data = append(runs[len(runs)-1].data, buffer...)
+			continue
+		}
+		if isEmptyBlock(buffer) {
+			continue
+		}
+		runs = append(runs, run{start: block, data: buffer})
+	}
+	if len(runs) == 0 {
+		return nil
+	}
+
+	lostFoundPath := "/" + volumeName + "/" + lostFoundDirectory
+	existingFileEntry, _ := GetFileEntry(r.readerWriter, lostFoundPath)
+	if existingFileEntry.StorageType != StorageDirectory {
+		err := CreateDirectory(r.readerWriter, lostFoundPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, run := range runs {
+		filePath := fmt.Sprintf("%s/BLOCKS.%04X", lostFoundPath, run.start)
+		err := WriteFileWithOptions(r.readerWriter, filePath, 0x00, run.start, time.Now(), time.Now(), run.data,
+			WriteFileOptions{Overwrite: true})
+		if err != nil {
+			return err
+		}
+		r.addFix("saved %d orphaned blocks from %04X to %s", len(run.data)/512, run.start, filePath)
+	}
+
+	return nil
+}
+
+func isEmptyBlock(buffer []byte) bool {
+	for _, value := range buffer {
+		if value != 0 {
+			return false
+		}
+	}
+	return true
+}
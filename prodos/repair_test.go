@@ -0,0 +1,168 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for repairing a volume
+
+package prodos
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestRepair(t *testing.T) {
+	var tests = []struct {
+		testName  string
+		corrupt   func(volume *MemoryFile)
+		wantFiles []string
+	}{
+		{"blockMarkedFree", func(volume *MemoryFile) {
+			fileEntry, _ := GetFileEntry(volume, "/verify/small")
+			volumeBitmap, _ := ReadVolumeBitmap(volume)
+			freeBlockInVolumeBitmap(volumeBitmap, fileEntry.KeyPointer)
+			writeVolumeBitmap(volume, volumeBitmap)
+		}, nil},
+		{"orphanedBlocks", func(volume *MemoryFile) {
+			volumeBitmap, _ := ReadVolumeBitmap(volume)
+			markBlockInVolumeBitmap(volumeBitmap, 2000)
+			markBlockInVolumeBitmap(volumeBitmap, 2001)
+			markBlockInVolumeBitmap(volumeBitmap, 2010)
+			writeVolumeBitmap(volume, volumeBitmap)
+			WriteBlock(volume, 2000, bytes.Repeat([]byte{0x55}, 512))
+			WriteBlock(volume, 2001, bytes.Repeat([]byte{0xAA}, 512))
+		}, []string{"/verify/lost.found/blocks.07d0"}},
+		{"crossLinked", func(volume *MemoryFile) {
+			small, _ := GetFileEntry(volume, "/verify/small")
+			medium, _ := GetFileEntry(volume, "/verify/docs/medium")
+			index, _ := ReadBlock(volume, medium.KeyPointer)
+			index[0] = byte(small.KeyPointer)
+			index[256] = byte(small.KeyPointer >> 8)
+			WriteBlock(volume, medium.KeyPointer, index)
+		}, nil},
+		{"beyondTotalBlocks", func(volume *MemoryFile) {
+			large, _ := GetFileEntry(volume, "/verify/large")
+			index, _ := ReadBlock(volume, large.KeyPointer)
+			index[5] = 0xFF
+			index[261] = 0xFF
+			WriteBlock(volume, large.KeyPointer, index)
+			small, _ := GetFileEntry(volume, "/verify/small")
+			small.KeyPointer = 0x1000
+			writeFileEntry(volume, small)
+		}, nil},
+		{"countsAndLinks", func(volume *MemoryFile) {
+			_, directoryHeader, _, _ := ReadDirectory(volume, "/verify/docs")
+			directoryHeader.ActiveFileCount = 3
+			writeDirectoryHeader(volume, directoryHeader)
+			fileEntry, _ := GetFileEntry(volume, "/verify/large")
+			fileEntry.BlocksUsed++
+			writeFileEntry(volume, fileEntry)
+			buffer, _ := ReadBlock(volume, 3)
+			buffer[0] = 0x09
+			WriteBlock(volume, 3, buffer)
+		}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			volume := createVerifyVolume()
+			tt.corrupt(volume)
+			corrupted := make([]byte, len(volume.data))
+			copy(corrupted, volume.data)
+
+			var backup bytes.Buffer
+			fixes, err := Repair(volume, &backup)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if len(fixes) == 0 {
+				t.Errorf("got no fixes")
+			}
+
+			report, err := Verify(volume)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if report.HasProblems() {
+				t.Errorf("got problems %v after fixes %v", report.Problems, fixes)
+			}
+			for _, path := range tt.wantFiles {
+				_, err := GetFileEntry(volume, path)
+				if err != nil {
+					t.Errorf("got error %s for %s", err, path)
+				}
+			}
+
+			err = RestoreBlockBackup(volume, &backup)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !bytes.Equal(volume.data, corrupted) {
+				t.Errorf("restored volume does not match corrupted volume")
+			}
+		})
+	}
+
+	t.Run("clean", func(t *testing.T) {
+		var backup bytes.Buffer
+		fixes, err := Repair(createVerifyVolume(), &backup)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if len(fixes) != 0 || backup.Len() != len(blockBackupID) {
+			t.Errorf("got fixes %v and %d byte backup, want none", fixes, backup.Len())
+		}
+	})
+
+	t.Run("orphanedData", func(t *testing.T) {
+		volume := createVerifyVolume()
+		volumeBitmap, _ := ReadVolumeBitmap(volume)
+		markBlockInVolumeBitmap(volumeBitmap, 2000)
+		writeVolumeBitmap(volume, volumeBitmap)
+		WriteBlock(volume, 2000, bytes.Repeat([]byte{0x55}, 512))
+
+		var backup bytes.Buffer
+		_, err := Repair(volume, &backup)
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		got, err := LoadFile(volume, "/verify/lost.found/blocks.07d0")
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if !bytes.Equal(got, bytes.Repeat([]byte{0x55}, 512)) {
+			t.Errorf("got orphaned data that does not match")
+		}
+	})
+
+	t.Run("backupFailed", func(t *testing.T) {
+		volume := createVerifyVolume()
+		volumeBitmap, _ := ReadVolumeBitmap(volume)
+		markBlockInVolumeBitmap(volumeBitmap, 2000)
+		writeVolumeBitmap(volume, volumeBitmap)
+		corrupted := make([]byte, len(volume.data))
+		copy(corrupted, volume.data)
+
+		_, err := Repair(volume, &failingWriter{remaining: len(blockBackupID)})
+		if err == nil {
+			t.Fatalf("got no error for failed backup")
+		}
+		if !bytes.Equal(volume.data, corrupted) {
+			t.Errorf("volume changed without a backup")
+		}
+	})
+}
+
+// failingWriter fails once more than remaining bytes are written
+type failingWriter struct {
+	remaining int
+}
+
+func (writer *failingWriter) Write(data []byte) (int, error) {
+	if len(data) > writer.remaining {
+		return 0, errors.New("backup is full")
+	}
+	writer.remaining -= len(data)
+	return len(data), nil
+}
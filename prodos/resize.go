@@ -0,0 +1,125 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides resizing of the volume on a ProDOS drive image
+
+package prodos
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ResizeVolume grows or shrinks a volume to a new number of blocks,
+// updating the volume header and bitmap. Growing adds bitmap blocks when
+// needed and shrinking frees the blocks past the new end. When files are
+// in the way of new bitmap blocks or past the new end, the volume is
+// defragmented first to move them. The volume is not changed if there is
+// not enough room for the blocks in use. The drive image is expected to
+// grow when written past its end, shrinking does not truncate it.
+func ResizeVolume(readerWriter ReaderWriterAt, newBlocks uint16) error {
+	buffer, err := ReadBlock(readerWriter, 2)
+	if err != nil {
+		return err
+	}
+	volumeHeader := parseVolumeHeader(buffer)
+	oldBlocks := volumeHeader.TotalBlocks
+	if newBlocks == oldBlocks {
+		return nil
+	}
+
+	oldBitmapBlocks := (uint32(oldBlocks) + 4095) / 4096
+	newBitmapBlocks := (uint32(newBlocks) + 4095) / 4096
+	firstFreeBlock := uint32(volumeHeader.BitmapStartBlock) + newBitmapBlocks
+	if uint32(newBlocks) <= firstFreeBlock {
+		errString := fmt.Sprintf("volume must be more than %d blocks", firstFreeBlock)
+		return errors.New(errString)
+	}
+
+	volumeBitmap, err := ReadVolumeBitmap(readerWriter)
+	if err != nil {
+		return err
+	}
+
+	// new bitmap blocks must be free along with any blocks past the new end
+	var reservedBlocks []uint16
+	for i := oldBitmapBlocks; i < newBitmapBlocks; i++ {
+		reservedBlocks = append(reservedBlocks, volumeHeader.BitmapStartBlock+uint16(i))
+	}
+	usedBlocks := oldBlocks - GetFreeBlockCount(volumeBitmap, oldBlocks)
+	if uint32(usedBlocks)+uint32(len(reservedBlocks)) > uint32(newBlocks) {
+		errString := fmt.Sprintf("%d blocks in use, cannot resize to %d blocks", usedBlocks, newBlocks)
+		return errors.New(errString)
+	}
+
+	if !blocksAreFree(volumeBitmap, oldBlocks, reservedBlocks, newBlocks) {
+		_, err = defragment(readerWriter, DefragmentOptions{Directories: true}, reservedBlocks)
+		if err != nil {
+			return fmt.Errorf("failed to move files to resize volume: %w", err)
+		}
+		volumeBitmap, err = ReadVolumeBitmap(readerWriter)
+		if err != nil {
+			return err
+		}
+		if !blocksAreFree(volumeBitmap, oldBlocks, reservedBlocks, newBlocks) {
+			errString := fmt.Sprintf("files past block %04X could not be moved", newBlocks)
+			return errors.New(errString)
+		}
+	}
+
+	// writing the last block makes sure the drive image can hold the volume
+	if newBlocks > oldBlocks {
+		err = WriteBlock(readerWriter, newBlocks-1, make([]byte, 512))
+		if err != nil {
+			return err
+		}
+	}
+
+	// blocks past the end of the volume are marked as used
+	newVolumeBitmap := make([]byte, newBitmapBlocks*512)
+	for block := uint16(0); block < newBlocks; block++ {
+		if block >= oldBlocks || checkFreeBlockInVolumeBitmap(volumeBitmap, block) {
+			freeBlockInVolumeBitmap(newVolumeBitmap, block)
+		}
+	}
+	for _, block := range reservedBlocks {
+		markBlockInVolumeBitmap(newVolumeBitmap, block)
+	}
+	for i := newBitmapBlocks; i < oldBitmapBlocks; i++ {
+		freeBlockInVolumeBitmap(newVolumeBitmap, volumeHeader.BitmapStartBlock+uint16(i))
+	}
+	for i := uint16(0); i < uint16(newBitmapBlocks); i++ {
+		err = WriteBlock(readerWriter, volumeHeader.BitmapStartBlock+i, newVolumeBitmap[i*512:i*512+512])
+		if err != nil {
+			return err
+		}
+	}
+
+	// the volume directory may have been changed by defragmenting
+	buffer, err = ReadBlock(readerWriter, 2)
+	if err != nil {
+		return err
+	}
+	buffer[0x29] = byte(newBlocks & 0x00FF)
+	buffer[0x2A] = byte(newBlocks >> 8)
+
+	return WriteBlock(readerWriter, 2, buffer)
+}
+
+// blocksAreFree returns true if the reserved blocks that are on
+// the volume and every block from the new end are free
+func blocksAreFree(volumeBitmap []byte, totalBlocks uint16, reservedBlocks []uint16, newBlocks uint16) bool {
+	for _, block := range reservedBlocks {
+		if block < totalBlocks && !checkFreeBlockInVolumeBitmap(volumeBitmap, block) {
+			return false
+		}
+	}
+	for block := uint32(newBlocks); block < uint32(totalBlocks); block++ {
+		if !checkFreeBlockInVolumeBitmap(volumeBitmap, uint16(block)) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,79 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for resizing a volume
+
+package prodos
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestResizeVolume(t *testing.T) {
+	var tests = []struct {
+		testName  string
+		oldBlocks uint16
+		newBlocks uint16
+		wantError bool
+	}{
+		{"growFloppyToHardDisk", 280, 65535, false},
+		{"grow", 1600, 8000, false},
+		{"shrinkHardDiskTo800K", 65535, 1600, false},
+		{"shrinkPastFiles", 2048, 600, false},
+		{"shrinkTooSmall", 2048, 200, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			volume := NewMemoryFile(0x2000000)
+			CreateVolume(volume, "resize", tt.oldBlocks)
+			CreateDirectory(volume, "/resize/docs")
+			data := bytes.Repeat([]byte{0x5A}, 60000)
+			WriteFile(volume, "/resize/docs/medium", 0x06, 0x2000, time.Now(), time.Now(), data)
+			if tt.oldBlocks > 1000 {
+				// fill most of the start of the volume so files end up past the new end
+				WriteFile(volume, "/resize/filler", 0x06, 0, time.Now(), time.Now(), make([]byte, 250000))
+			}
+			err := WriteFile(volume, "/resize/large", 0x06, 0, time.Now(), time.Now(), data)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			DeleteFile(volume, "/resize/filler")
+
+			err = ResizeVolume(volume, tt.newBlocks)
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("got no error, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			report, err := Verify(volume)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if report.TotalBlocks != tt.newBlocks {
+				t.Errorf("got %d blocks, want %d", report.TotalBlocks, tt.newBlocks)
+			}
+			if report.HasProblems() {
+				t.Errorf("got problems %v", report.Problems)
+			}
+
+			for _, path := range []string{"/resize/docs/medium", "/resize/large"} {
+				got, err := LoadFile(volume, path)
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+				if !bytes.Equal(got, data) {
+					t.Errorf("got %s data that does not match", path)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides the sizes of sparse files and copying
+// files between ProDOS drive images
+
+package prodos
+
+import (
+	"errors"
+	"io"
+)
+
+// GetFileSize returns the logical size of a file, which is the end of
+// file of its data and resource forks, and the size of the blocks
+// allocated to it including index blocks. Sparse files can have less
+// allocated than their logical size.
+func GetFileSize(reader io.ReaderAt, path string) (int64, int64, error) {
+	fileEntry, err := GetFileEntry(reader, path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	logicalSize := int64(fileEntry.EndOfFile)
+	if fileEntry.StorageType == StorageExtended {
+		dataForkEntry, resourceForkEntry, err := readExtendedKeyBlock(reader, fileEntry)
+		if err != nil {
+			return 0, 0, err
+		}
+		logicalSize = int64(dataForkEntry.EndOfFile) + int64(resourceForkEntry.EndOfFile)
+	}
+
+	return logicalSize, int64(fileEntry.BlocksUsed) * 512, nil
+}
+
+// CopyFile copies a file from one ProDOS volume to another, or within the
+// same volume, keeping its file type, aux type, dates, access, resource
+// fork and Finder info. Gaps in sparse files are left unallocated in the
+// copy whatever the sparse option is.
+func CopyFile(reader io.ReaderAt, path string, readerWriter ReaderWriterAt, newPath string, options WriteFileOptions) error {
+	fileEntry, err := GetFileEntry(reader, path)
+	if err != nil {
+		return err
+	}
+	if fileEntry.StorageType == StorageDirectory {
+		return errors.New("cannot copy a directory")
+	}
+
+	newPath, err = makeFullPath(newPath, readerWriter)
+	if err != nil {
+		return err
+	}
+	_, fileName := GetDirectoryAndFileNameFromPath(newPath)
+	err = validateFileName(fileName)
+	if err != nil {
+		return err
+	}
+
+	return withVolume(readerWriter, func(volume *Volume) error {
+		exists, err := fileExists(volume, newPath)
+		if err != nil {
+			return err
+		}
+		if exists && options.IgnoreDuplicates && !options.Overwrite {
+			return nil
+		}
+
+		if fileEntry.StorageType == StorageExtended {
+			err = copyForkedFile(reader, fileEntry, volume, newPath, options)
+		} else {
+			var data []byte
+			var allocate []bool
+			data, allocate, err = readSparseData(reader, fileEntry, options)
+			if err != nil {
+				return err
+			}
+			err = writeSparseFile(volume, newPath, fileEntry.FileType, fileEntry.AuxType,
+				fileEntry.CreationTime, fileEntry.ModifiedTime, data, allocate, options)
+		}
+		if err != nil {
+			return err
+		}
+
+		if exists && options.PreserveAccess {
+			return nil
+		}
+		return SetFileInfo(volume, newPath, FileInfoUpdate{Access: &fileEntry.Access})
+	})
+}
+
+// copyForkedFile copies both forks and the Finder info of an extended file
+func copyForkedFile(reader io.ReaderAt, fileEntry FileEntry, readerWriter ReaderWriterAt, newPath string, options WriteFileOptions) error {
+	dataForkEntry, resourceForkEntry, err := readExtendedKeyBlock(reader, fileEntry)
+	if err != nil {
+		return err
+	}
+	dataFork, dataAllocate, err := readSparseData(reader, dataForkEntry, options)
+	if err != nil {
+		return err
+	}
+	resourceFork, resourceAllocate, err := readSparseData(reader, resourceForkEntry, options)
+	if err != nil {
+		return err
+	}
+	keyBlock, err := ReadBlock(reader, fileEntry.KeyPointer)
+	if err != nil {
+		return err
+	}
+
+	return writeSparseForkedFile(readerWriter, newPath, fileEntry.FileType, fileEntry.AuxType,
+		fileEntry.CreationTime, fileEntry.ModifiedTime, dataFork, dataAllocate,
+		resourceFork, resourceAllocate, parseFinderInfo(keyBlock), options)
+}
+
+// readSparseData reads the data of a seedling, sapling or tree file and
+// returns which blocks to allocate when writing it, leaving out the gaps
+// that were not allocated as well as blocks of zeroes when sparse
+func readSparseData(reader io.ReaderAt, fileEntry FileEntry, options WriteFileOptions) ([]byte, []bool, error) {
+	data, err := readFileData(reader, fileEntry)
+	if err != nil {
+		return nil, nil, err
+	}
+	blockList, err := getDataBlocklist(reader, fileEntry)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	allocate := dataBlocksToAllocate(data, options.sparse(len(data)))
+	for i := 1; i < len(allocate) && i < len(blockList); i++ {
+		if blockList[i] == 0 {
+			allocate[i] = false
+		}
+	}
+
+	return data, allocate, nil
+}
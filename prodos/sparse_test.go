@@ -0,0 +1,156 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for sparse files
+
+package prodos
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteSparseFile(t *testing.T) {
+	withData := func(size int, positions ...int) []byte {
+		buffer := make([]byte, size)
+		for _, position := range positions {
+			buffer[position] = 0xAA
+		}
+		return buffer
+	}
+
+	var tests = []struct {
+		testName       string
+		buffer         []byte
+		sparse         SparseMode
+		wantBlocksUsed uint16
+	}{
+		{"largeDefault", withData(300000), SparseLargeFiles, 3},
+		{"largeNever", withData(300000), SparseNever, 590},
+		{"largeWithData", withData(300000, 200000, 299999), SparseLargeFiles, 7},
+		{"smallDefault", withData(10000), SparseLargeFiles, 21},
+		{"smallAlways", withData(10000, 9999), SparseAlways, 3},
+		{"seedlingAlways", withData(100), SparseAlways, 1},
+		{"emptyAlways", withData(0), SparseAlways, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			volume := createVerifyVolume()
+			err := WriteFileWithOptions(volume, "/verify/sparse", 0x04, 0x0000, time.Now(), time.Now(), tt.buffer, WriteFileOptions{Sparse: tt.sparse})
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			fileEntry, _ := GetFileEntry(volume, "/verify/sparse")
+			if fileEntry.BlocksUsed != tt.wantBlocksUsed {
+				t.Errorf("got %d blocks used, want %d", fileEntry.BlocksUsed, tt.wantBlocksUsed)
+			}
+			got, _ := LoadFile(volume, "/verify/sparse")
+			if !bytes.Equal(got, tt.buffer) {
+				t.Errorf("got %d bytes that do not match, want %d", len(got), len(tt.buffer))
+			}
+			report, _ := Verify(volume)
+			if report.HasProblems() {
+				t.Errorf("got problems %v", report.Problems)
+			}
+
+			err = DeleteFile(volume, "/verify/sparse")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			report, _ = Verify(volume)
+			if report.HasProblems() {
+				t.Errorf("got problems after delete %v", report.Problems)
+			}
+		})
+	}
+}
+
+func TestGetFileSize(t *testing.T) {
+	volume := createVerifyVolume()
+	WriteFile(volume, "/verify/sparse", 0x04, 0x0000, time.Now(), time.Now(), make([]byte, 300000))
+
+	var tests = []struct {
+		path          string
+		wantLogical   int64
+		wantAllocated int64
+	}{
+		{"/verify/small", 5, 512},
+		{"/verify/docs/medium", 5000, 11 * 512},
+		{"/verify/forked", 1001, 5 * 512},
+		{"/verify/sparse", 300000, 3 * 512},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			logical, allocated, err := GetFileSize(volume, tt.path)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if logical != tt.wantLogical || allocated != tt.wantAllocated {
+				t.Errorf("got %d logical %d allocated, want %d and %d", logical, allocated, tt.wantLogical, tt.wantAllocated)
+			}
+		})
+	}
+}
+
+func TestCopyFile(t *testing.T) {
+	source := createVerifyVolume()
+	data := make([]byte, 10000)
+	copy(data[9000:], "END")
+	WriteFileWithOptions(source, "/verify/sparse", 0x04, 0x1234, time.Now(), time.Now(), data, WriteFileOptions{Sparse: SparseAlways})
+	access := uint8(AccessRead)
+	SetFileInfo(source, "/verify/sparse", FileInfoUpdate{Access: &access})
+
+	destination := NewMemoryFile(0x2000000)
+	CreateVolume(destination, "copy", 1024)
+
+	var tests = []struct {
+		path    string
+		newPath string
+	}{
+		{"/verify/sparse", "sparse"},
+		{"/verify/large", "/copy/large"},
+		{"/verify/forked", "/copy/forked"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			err := CopyFile(source, tt.path, destination, tt.newPath, WriteFileOptions{})
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			want, _ := GetFileEntry(source, tt.path)
+			got, _ := GetFileEntry(destination, "/copy/"+want.FileName)
+			if got.BlocksUsed != want.BlocksUsed || got.FileType != want.FileType || got.AuxType != want.AuxType ||
+				got.Access != want.Access || !got.ModifiedTime.Equal(want.ModifiedTime) {
+				t.Errorf("got blocks %d type %02X aux %04X access %02X, want blocks %d type %02X aux %04X access %02X",
+					got.BlocksUsed, got.FileType, got.AuxType, got.Access, want.BlocksUsed, want.FileType, want.AuxType, want.Access)
+			}
+
+			wantData, wantResource, wantFinderInfo, _ := LoadFileForks(source, tt.path)
+			gotData, gotResource, gotFinderInfo, _ := LoadFileForks(destination, "/copy/"+want.FileName)
+			if !bytes.Equal(gotData, wantData) || !bytes.Equal(gotResource, wantResource) || !bytes.Equal(gotFinderInfo, wantFinderInfo) {
+				t.Errorf("got forks that do not match")
+			}
+		})
+	}
+
+	report, _ := Verify(destination)
+	if report.HasProblems() {
+		t.Errorf("got problems %v", report.Problems)
+	}
+
+	err := CopyFile(source, "/verify/docs", destination, "/copy/docs", WriteFileOptions{})
+	if err == nil {
+		t.Errorf("got no error, want error copying a directory")
+	}
+	err = CopyFile(source, "/verify/small", destination, "/copy/large", WriteFileOptions{})
+	if err == nil {
+		t.Errorf("got no error, want error copying over an existing file")
+	}
+}
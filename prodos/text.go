@@ -189,3 +189,33 @@ func DumpDirectory(blocksFree uint16, totalBlocks uint16, path string, fileEntri
 	fmt.Printf("\n")
 	fmt.Printf("BLOCKS FREE: %5d    BLOCKS USED: %5d      TOTAL BLOCKS: %5d\n", blocksFree, totalBlocks-blocksFree, totalBlocks)
 }
+
+// DumpDeletedFiles displays the deleted entries in a directory numbered
+// for undelete along with whether each can be recovered
+func DumpDeletedFiles(path string, deletedFiles []DeletedFileEntry) {
+	fmt.Printf("%s\n\n", path)
+	fmt.Printf("ENTRY NAME            TYPE BLOCKS  MODIFIED          ENDFILE  SUBTYPE  STATUS\n\n")
+
+	for i, deletedFile := range deletedFiles {
+		fileEntry := deletedFile.FileEntry
+		modifiedTime := "<NO DATE>        "
+		if fileEntry.ModifiedTime != (time.Time{}) {
+			modifiedTime = TimeToString(fileEntry.ModifiedTime)
+		}
+		status := "recoverable"
+		if !deletedFile.Recoverable {
+			status = deletedFile.Problem
+		}
+		fmt.Printf("%5d %-15s %s%6d  %s%8d %8d  %s\n",
+			i,
+			fileEntry.FileName,
+			FileTypeToString(fileEntry.FileType),
+			fileEntry.BlocksUsed,
+			modifiedTime,
+			fileEntry.EndOfFile,
+			fileEntry.AuxType,
+			status,
+		)
+	}
+	fmt.Printf("\n")
+}
@@ -0,0 +1,187 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides access to 2IMG (.2mg/.2img) drive images
+// which wrap a disk image with a 64 byte header
+
+package prodos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	// TwoImgFormatDOS signifies DOS 3.3 sector order image data
+	TwoImgFormatDOS = 0
+	// TwoImgFormatProDOS signifies ProDOS block order image data
+	TwoImgFormatProDOS = 1
+	// TwoImgFormatNibble signifies nibblized image data
+	TwoImgFormatNibble = 2
+)
+
+const twoImgHeaderSize = 64
+
+// TwoImg is a 2IMG drive image that offsets block access by the
+// header so it can be used with all other functions in this package
+type TwoImg struct {
+	readerWriter ReaderWriterAt
+
+	Creator        string
+	Version        uint16
+	Format         uint32
+	WriteProtected bool
+	VolumeNumber   uint8
+	Blocks         uint32
+	DataOffset     uint32
+	DataLength     uint32
+	Comment        string
+	CreatorData    []byte
+}
+
+// IsTwoImg returns true if the image starts with a 2IMG header
+func IsTwoImg(reader io.ReaderAt) bool {
+	magic := make([]byte, 4)
+	_, err := reader.ReadAt(magic, 0)
+	return err == nil && string(magic) == "2IMG"
+}
+
+// OpenTwoImg parses the 2IMG header and chunks of an image
+func OpenTwoImg(readerWriter ReaderWriterAt) (*TwoImg, error) {
+	header := make([]byte, twoImgHeaderSize)
+	_, err := readerWriter.ReadAt(header, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read 2IMG header: %w", err)
+	}
+
+	if string(header[0x00:0x04]) != "2IMG" {
+		return nil, errors.New("missing 2IMG header")
+	}
+
+	flags := binary.LittleEndian.Uint32(header[0x10:])
+	twoImg := &TwoImg{
+		readerWriter:   readerWriter,
+		Creator:        string(header[0x04:0x08]),
+		Version:        binary.LittleEndian.Uint16(header[0x0A:]),
+		Format:         binary.LittleEndian.Uint32(header[0x0C:]),
+		WriteProtected: flags&0x80000000 != 0,
+		Blocks:         binary.LittleEndian.Uint32(header[0x14:]),
+		DataOffset:     binary.LittleEndian.Uint32(header[0x18:]),
+		DataLength:     binary.LittleEndian.Uint32(header[0x1C:]),
+	}
+	if flags&0x00000100 != 0 {
+		twoImg.VolumeNumber = uint8(flags & 0xFF)
+	}
+
+	headerSize := binary.LittleEndian.Uint16(header[0x08:])
+	if headerSize < twoImgHeaderSize || twoImg.DataOffset < uint32(headerSize) {
+		return nil, errors.New("invalid 2IMG header size or data offset")
+	}
+
+	// some images leave the data length empty for ProDOS ordered data
+	if twoImg.DataLength == 0 && twoImg.Format == TwoImgFormatProDOS {
+		twoImg.DataLength = twoImg.Blocks * 512
+	}
+
+	comment, err := readTwoImgChunk(readerWriter, header[0x20:])
+	if err != nil {
+		return nil, err
+	}
+	twoImg.Comment = strings.TrimRight(string(comment), "\x00")
+
+	twoImg.CreatorData, err = readTwoImgChunk(readerWriter, header[0x28:])
+	if err != nil {
+		return nil, err
+	}
+
+	return twoImg, nil
+}
+
+// CreateTwoImg writes a 2IMG header for a ProDOS ordered image of the
+// specified number of blocks with an optional comment and a four character
+// creator code, the returned image is ready to be formatted by CreateVolume
+func CreateTwoImg(readerWriter ReaderWriterAt, numberOfBlocks uint16, comment string, creator string) (*TwoImg, error) {
+	if len(creator) > 4 {
+		return nil, errors.New("creator code must be up to 4 characters")
+	}
+	creator = fmt.Sprintf("%-4s", creator)
+
+	dataLength := uint32(numberOfBlocks) * 512
+	header := make([]byte, twoImgHeaderSize)
+	copy(header[0x00:], "2IMG")
+	copy(header[0x04:], creator)
+	binary.LittleEndian.PutUint16(header[0x08:], twoImgHeaderSize)
+	binary.LittleEndian.PutUint16(header[0x0A:], 1)
+	binary.LittleEndian.PutUint32(header[0x0C:], TwoImgFormatProDOS)
+	binary.LittleEndian.PutUint32(header[0x14:], uint32(numberOfBlocks))
+	binary.LittleEndian.PutUint32(header[0x18:], twoImgHeaderSize)
+	binary.LittleEndian.PutUint32(header[0x1C:], dataLength)
+	if len(comment) > 0 {
+		binary.LittleEndian.PutUint32(header[0x20:], twoImgHeaderSize+dataLength)
+		binary.LittleEndian.PutUint32(header[0x24:], uint32(len(comment)))
+	}
+
+	_, err := readerWriter.WriteAt(header, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(comment) > 0 {
+		_, err = readerWriter.WriteAt([]byte(comment), int64(twoImgHeaderSize+dataLength))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &TwoImg{
+		readerWriter: readerWriter,
+		Creator:      creator,
+		Version:      1,
+		Format:       TwoImgFormatProDOS,
+		Blocks:       uint32(numberOfBlocks),
+		DataOffset:   twoImgHeaderSize,
+		DataLength:   dataLength,
+		Comment:      comment,
+	}, nil
+}
+
+// ReadAt reads data from the specified offset in the image data
+func (twoImg *TwoImg) ReadAt(data []byte, offset int64) (int, error) {
+	if offset < 0 || offset+int64(len(data)) > int64(twoImg.DataLength) {
+		return 0, errors.New("read beyond end of 2IMG image data")
+	}
+	return twoImg.readerWriter.ReadAt(data, offset+int64(twoImg.DataOffset))
+}
+
+// WriteAt writes data to the specified offset in the image data
+func (twoImg *TwoImg) WriteAt(data []byte, offset int64) (int, error) {
+	if twoImg.WriteProtected {
+		return 0, errors.New("2IMG image is write protected")
+	}
+	if offset < 0 || offset+int64(len(data)) > int64(twoImg.DataLength) {
+		return 0, errors.New("write beyond end of 2IMG image data")
+	}
+	return twoImg.readerWriter.WriteAt(data, offset+int64(twoImg.DataOffset))
+}
+
+// readTwoImgChunk reads the optional comment or creator chunk
+// described by an offset and length pair in the header
+func readTwoImgChunk(reader io.ReaderAt, offsetAndLength []byte) ([]byte, error) {
+	offset := binary.LittleEndian.Uint32(offsetAndLength[0:])
+	length := binary.LittleEndian.Uint32(offsetAndLength[4:])
+	if offset == 0 || length == 0 {
+		return nil, nil
+	}
+
+	chunk := make([]byte, length)
+	_, err := reader.ReadAt(chunk, int64(offset))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read 2IMG chunk: %w", err)
+	}
+
+	return chunk, nil
+}
@@ -0,0 +1,135 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for 2IMG drive images
+
+package prodos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func TestCreateAndOpenTwoImg(t *testing.T) {
+	var tests = []struct {
+		testName string
+		blocks   uint16
+		comment  string
+		creator  string
+	}{
+		{"floppy", 280, "", "PDOU"},
+		{"withComment", 1600, "Build 42", "PDOU"},
+		{"shortCreator", 2048, "Test image", "AB"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			file := NewMemoryFile(0x2000000)
+			twoImg, err := CreateTwoImg(file, tt.blocks, tt.comment, tt.creator)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			CreateVolume(twoImg, "test", tt.blocks)
+
+			if !IsTwoImg(file) {
+				t.Fatalf("got IsTwoImg false, want true")
+			}
+
+			twoImg, err = OpenTwoImg(file)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if twoImg.Format != TwoImgFormatProDOS {
+				t.Errorf("got format %d, want %d", twoImg.Format, TwoImgFormatProDOS)
+			}
+			if twoImg.Blocks != uint32(tt.blocks) {
+				t.Errorf("got blocks %d, want %d", twoImg.Blocks, tt.blocks)
+			}
+			if twoImg.DataOffset != 64 {
+				t.Errorf("got data offset %d, want 64", twoImg.DataOffset)
+			}
+			if twoImg.Comment != tt.comment {
+				t.Errorf("got comment %q, want %q", twoImg.Comment, tt.comment)
+			}
+			if twoImg.Creator[0:len(tt.creator)] != tt.creator {
+				t.Errorf("got creator %q, want %q", twoImg.Creator, tt.creator)
+			}
+
+			volumeHeader, _, _, err := ReadDirectory(twoImg, "")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if volumeHeader.TotalBlocks != tt.blocks {
+				t.Errorf("got total blocks %d, want %d", volumeHeader.TotalBlocks, tt.blocks)
+			}
+
+			// the volume directory must sit after the header in the container
+			block := make([]byte, 512)
+			file.ReadAt(block, 64+2*512)
+			if block[0x04]&0x0F != 4 || string(block[0x05:0x09]) != "TEST" {
+				t.Errorf("volume directory not found after 2IMG header")
+			}
+
+			want := []byte("hello")
+			err = WriteFile(twoImg, "/test/hello", 0x04, 0, time.Now(), time.Now(), want)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			got, err := LoadFile(twoImg, "/test/hello")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestTwoImgWriteProtected(t *testing.T) {
+	file := NewMemoryFile(0x2000000)
+	twoImg, err := CreateTwoImg(file, 280, "", "PDOU")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	CreateVolume(twoImg, "test", 280)
+
+	flags := make([]byte, 4)
+	binary.LittleEndian.PutUint32(flags, 0x80000000)
+	file.WriteAt(flags, 0x10)
+
+	twoImg, err = OpenTwoImg(file)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	if !twoImg.WriteProtected {
+		t.Fatalf("got WriteProtected false, want true")
+	}
+
+	_, _, _, err = ReadDirectory(twoImg, "")
+	if err != nil {
+		t.Errorf("got error %s reading write protected image", err)
+	}
+
+	err = WriteFile(twoImg, "/test/hello", 0x04, 0, time.Now(), time.Now(), []byte("hello"))
+	if err == nil {
+		t.Errorf("got no error writing to write protected image")
+	}
+}
+
+func TestOpenTwoImgInvalid(t *testing.T) {
+	file := NewMemoryFile(0x2000000)
+	CreateVolume(file, "test", 280)
+
+	if IsTwoImg(file) {
+		t.Errorf("got IsTwoImg true for raw image, want false")
+	}
+
+	_, err := OpenTwoImg(file)
+	if err == nil {
+		t.Errorf("got no error opening raw image as 2IMG")
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides recovery of deleted files whose
+// blocks have not been reused
+
+package prodos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DeletedFileEntry is a deleted entry found in a directory with the
+// storage type worked out from its blocks. The file name is empty unless
+// the tool that deleted the file left it in the entry. Problem describes
+// why the file cannot be recovered when Recoverable is false.
+type DeletedFileEntry struct {
+	FileEntry   FileEntry
+	Recoverable bool
+	Problem     string
+}
+
+// ListDeleted returns the deleted entries in a directory that still
+// point to a key block, showing which can be recovered because their
+// blocks are still free in the volume bitmap and not reused
+func ListDeleted(reader io.ReaderAt, path string) ([]DeletedFileEntry, error) {
+	volumeHeader, directoryHeader, _, err := ReadDirectory(reader, path)
+	if err != nil {
+		return nil, err
+	}
+	blocks, err := getDirectoryBlocks(reader, directoryHeader.StartingBlock)
+	if err != nil {
+		return nil, err
+	}
+	volumeBitmap, err := ReadVolumeBitmap(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	deletedFiles := []DeletedFileEntry{}
+	var deletedBlocks [][]uint16
+	for i, blockNumber := range blocks {
+		buffer, err := ReadBlock(reader, blockNumber)
+		if err != nil {
+			return nil, err
+		}
+
+		entryOffset := uint16(4)
+		if i == 0 {
+			// header is essentially the first entry so skip it
+			entryOffset += 39
+		}
+
+		for ; entryOffset+39 <= 512; entryOffset += 39 {
+			fileEntry := parseFileEntry(buffer[entryOffset:entryOffset+39], blockNumber, entryOffset)
+			if fileEntry.StorageType != StorageDeleted || fileEntry.KeyPointer == 0 {
+				continue
+			}
+			fileEntry.HeaderPointer = directoryHeader.StartingBlock
+
+			deletedFile, fileBlocks := checkDeletedFile(reader, volumeBitmap, volumeHeader.TotalBlocks, fileEntry)
+			deletedFiles = append(deletedFiles, deletedFile)
+			deletedBlocks = append(deletedBlocks, fileBlocks)
+		}
+	}
+
+	// a block freed by one file may have been reused and freed by another
+	owners := make(map[uint16]int)
+	for i, fileBlocks := range deletedBlocks {
+		for _, block := range fileBlocks {
+			if owner, found := owners[block]; found && owner != i {
+				markDeletedFileReused(&deletedFiles[owner])
+				markDeletedFileReused(&deletedFiles[i])
+			}
+			owners[block] = i
+		}
+	}
+
+	return deletedFiles, nil
+}
+
+// Undelete restores a deleted entry found by ListDeleted with a new file
+// name in the same directory, marking its blocks as used again
+func Undelete(readerWriter ReaderWriterAt, deletedFile DeletedFileEntry, fileName string) error {
+	fileName = strings.ToUpper(fileName)
+	err := validateFileName(fileName)
+	if err != nil {
+		return err
+	}
+
+	buffer, err := ReadBlock(readerWriter, deletedFile.FileEntry.DirectoryBlock)
+	if err != nil {
+		return err
+	}
+	entryOffset := deletedFile.FileEntry.DirectoryOffset
+	fileEntry := parseFileEntry(buffer[entryOffset:entryOffset+39], deletedFile.FileEntry.DirectoryBlock, entryOffset)
+	if fileEntry.StorageType != StorageDeleted || fileEntry.KeyPointer != deletedFile.FileEntry.KeyPointer {
+		return errors.New("deleted entry has been reused")
+	}
+	fileEntry.HeaderPointer = deletedFile.FileEntry.HeaderPointer
+
+	_, fileEntries, err := readDirectoryEntries(readerWriter, fileEntry.HeaderPointer)
+	if err != nil {
+		return err
+	}
+	for _, existingFileEntry := range fileEntries {
+		if existingFileEntry.FileName == fileName {
+			return &PathError{Op: "undelete", Path: fileName, Err: ErrExists}
+		}
+	}
+
+	volumeHeaderBlock, err := ReadBlock(readerWriter, 2)
+	if err != nil {
+		return err
+	}
+	volumeBitmap, err := ReadVolumeBitmap(readerWriter)
+	if err != nil {
+		return err
+	}
+	checkedFile, blocks := checkDeletedFile(readerWriter, volumeBitmap, parseVolumeHeader(volumeHeaderBlock).TotalBlocks, fileEntry)
+	if !checkedFile.Recoverable {
+		errString := fmt.Sprintf("cannot undelete file: %s", checkedFile.Problem)
+		return errors.New(errString)
+	}
+
+	err = updateVolumeBitmap(readerWriter, blocks)
+	if err != nil {
+		return err
+	}
+
+	fileEntry = checkedFile.FileEntry
+	fileEntry.FileName = fileName
+	err = writeFileEntry(readerWriter, fileEntry)
+	if err != nil {
+		return err
+	}
+
+	if fileEntry.StorageType == StorageDirectory {
+		keyBlock, err := ReadBlock(readerWriter, fileEntry.KeyPointer)
+		if err != nil {
+			return err
+		}
+		directoryHeader := parseDirectoryHeader(keyBlock, fileEntry.KeyPointer)
+		directoryHeader.Name = fileName
+		err = writeDirectoryHeader(readerWriter, directoryHeader)
+		if err != nil {
+			return err
+		}
+	}
+
+	return incrementFileCount(readerWriter, fileEntry)
+}
+
+// checkDeletedFile works out the storage type of a deleted entry and
+// returns its blocks when they are all in range and free
+func checkDeletedFile(reader io.ReaderAt, volumeBitmap []byte, totalBlocks uint16, fileEntry FileEntry) (DeletedFileEntry, []uint16) {
+	deletedFile := DeletedFileEntry{FileEntry: fileEntry}
+	if fileEntry.KeyPointer >= totalBlocks {
+		deletedFile.Problem = "key block is beyond the volume"
+		return deletedFile, nil
+	}
+
+	deletedFile.FileEntry.StorageType = guessDeletedStorageType(reader, fileEntry)
+	if deletedFile.FileEntry.StorageType == StorageSapling && fileEntry.BlocksUsed > 257 {
+		deletedFile.Problem = "blocks used is more than an index block holds"
+		return deletedFile, nil
+	}
+
+	var blocks []uint16
+	var err error
+	if deletedFile.FileEntry.StorageType == StorageDirectory {
+		blocks, err = getDirectoryBlocks(reader, fileEntry.KeyPointer)
+	} else {
+		blocks, err = getAllBlockList(reader, deletedFile.FileEntry)
+	}
+	if err != nil {
+		deletedFile.Problem = err.Error()
+		return deletedFile, nil
+	}
+
+	fileBlocks := []uint16{}
+	for _, block := range blocks {
+		// sparse files have no block for empty data
+		if block == 0 {
+			continue
+		}
+		if block >= totalBlocks {
+			deletedFile.Problem = fmt.Sprintf("block %04X is beyond the volume", block)
+			return deletedFile, nil
+		}
+		if !checkFreeBlockInVolumeBitmap(volumeBitmap, block) {
+			deletedFile.Problem = fmt.Sprintf("block %04X has been reused", block)
+			return deletedFile, nil
+		}
+		fileBlocks = append(fileBlocks, block)
+	}
+
+	deletedFile.Recoverable = true
+	return deletedFile, fileBlocks
+}
+
+// guessDeletedStorageType works out the storage type that was cleared
+// when the file was deleted from the file type, blocks used and end of file
+func guessDeletedStorageType(reader io.ReaderAt, fileEntry FileEntry) uint8 {
+	if fileEntry.FileType == 0x0F {
+		return StorageDirectory
+	}
+	if fileEntry.BlocksUsed <= 1 {
+		return StorageSeedling
+	}
+	if fileEntry.EndOfFile == 0x200 && fileEntry.BlocksUsed >= 3 {
+		// the key block of an extended file has the blocks used by each fork
+		keyBlock, err := ReadBlock(reader, fileEntry.KeyPointer)
+		if err == nil {
+			dataForkEntry := parseForkEntry(keyBlock[0x000:])
+			resourceForkEntry := parseForkEntry(keyBlock[0x100:])
+			if dataForkEntry.StorageType >= StorageSeedling && dataForkEntry.StorageType <= StorageTree &&
+				resourceForkEntry.StorageType >= StorageSeedling && resourceForkEntry.StorageType <= StorageTree &&
+				1+dataForkEntry.BlocksUsed+resourceForkEntry.BlocksUsed == fileEntry.BlocksUsed &&
+				dataForkEntry.BlocksUsed <= 257 && resourceForkEntry.BlocksUsed <= 257 {
+				return StorageExtended
+			}
+		}
+	}
+	if fileEntry.EndOfFile > 0x20000 {
+		return StorageTree
+	}
+	return StorageSapling
+}
+
+func markDeletedFileReused(deletedFile *DeletedFileEntry) {
+	if deletedFile.Recoverable {
+		deletedFile.Recoverable = false
+		deletedFile.Problem = "blocks shared with another deleted file"
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for recovering deleted files
+
+package prodos
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestUndelete(t *testing.T) {
+	var tests = []struct {
+		testName     string
+		path         string
+		wantNewName  string
+		wantData     []byte
+		wantResource []byte
+	}{
+		{"seedling", "/verify/small", "SMALL.2", []byte("SMALL"), nil},
+		{"sapling", "/verify/docs/medium", "MEDIUM", bytes.Repeat([]byte{1}, 5000), nil},
+		{"tree", "/verify/large", "LARGE", bytes.Repeat([]byte{2}, 200000), nil},
+		{"extended", "/verify/forked", "FORKED", []byte{1}, bytes.Repeat([]byte{3}, 1000)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			volume := createVerifyVolume()
+			err := DeleteFile(volume, tt.path)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			directory, _ := GetDirectoryAndFileNameFromPath(tt.path)
+
+			deletedFiles, err := ListDeleted(volume, directory)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if len(deletedFiles) != 1 || !deletedFiles[0].Recoverable {
+				t.Fatalf("got %v, want one recoverable file", deletedFiles)
+			}
+
+			err = Undelete(volume, deletedFiles[0], tt.wantNewName)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			dataFork, resourceFork, _, err := LoadFileForks(volume, directory+"/"+tt.wantNewName)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !bytes.Equal(dataFork, tt.wantData) || !bytes.Equal(resourceFork, tt.wantResource) {
+				t.Errorf("got data that does not match")
+			}
+
+			report, _ := Verify(volume)
+			if report.HasProblems() {
+				t.Errorf("got problems %v", report.Problems)
+			}
+		})
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		volume := createVerifyVolume()
+		DeleteDirectory(volume, "/verify/docs", true)
+		deletedFiles, _ := ListDeleted(volume, "/verify")
+		if len(deletedFiles) != 1 || !deletedFiles[0].Recoverable {
+			t.Fatalf("got %v, want one recoverable directory", deletedFiles)
+		}
+		err := Undelete(volume, deletedFiles[0], "DOCS")
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		deletedFiles, _ = ListDeleted(volume, "/verify/docs")
+		if len(deletedFiles) != 1 || !deletedFiles[0].Recoverable {
+			t.Fatalf("got %v, want one recoverable file", deletedFiles)
+		}
+		report, _ := Verify(volume)
+		if report.HasProblems() {
+			t.Errorf("got problems %v", report.Problems)
+		}
+	})
+
+	t.Run("reused", func(t *testing.T) {
+		volume := createVerifyVolume()
+		DeleteFile(volume, "/verify/small")
+		WriteFile(volume, "/verify/docs/other", 0x04, 0, time.Now(), time.Now(), []byte("OTHER"))
+		deletedFiles, _ := ListDeleted(volume, "/verify")
+		if len(deletedFiles) != 1 || deletedFiles[0].Recoverable {
+			t.Fatalf("got %v, want one file that cannot be recovered", deletedFiles)
+		}
+		err := Undelete(volume, deletedFiles[0], "SMALL")
+		if err == nil {
+			t.Errorf("got no error, want error for reused blocks")
+		}
+	})
+
+	t.Run("nameExists", func(t *testing.T) {
+		volume := createVerifyVolume()
+		DeleteFile(volume, "/verify/small")
+		deletedFiles, _ := ListDeleted(volume, "/verify")
+		err := Undelete(volume, deletedFiles[0], "LARGE")
+		if err == nil {
+			t.Errorf("got no error, want error for existing file")
+		}
+	})
+}
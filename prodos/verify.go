@@ -0,0 +1,371 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides a consistency check of the directories, files
+// and volume bitmap of a ProDOS drive image
+
+package prodos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// VerifyProblemKind is the type of problem found by Verify
+type VerifyProblemKind int
+
+const (
+	// VerifyBlockMarkedFree is a block in use that is free in the bitmap
+	VerifyBlockMarkedFree VerifyProblemKind = iota
+	// VerifyBlockNotReferenced is a block allocated in the bitmap that is not in use
+	VerifyBlockNotReferenced
+	// VerifyBlockCrossLinked is a block used more than once
+	VerifyBlockCrossLinked
+	// VerifyBlockOutOfRange is a block pointer past the end of the volume
+	VerifyBlockOutOfRange
+	// VerifyBlocksUsedMismatch is a BlocksUsed that does not match the blocks of a file
+	VerifyBlocksUsedMismatch
+	// VerifyEndOfFileMismatch is an EndOfFile that does not match the blocks of a file
+	VerifyEndOfFileMismatch
+	// VerifyFileCountMismatch is an ActiveFileCount that does not match the directory
+	VerifyFileCountMismatch
+	// VerifyDirectoryLink is a broken previous, next or parent directory block link
+	VerifyDirectoryLink
+	// VerifyInvalidName is a volume, directory or file name that breaks ProDOS rules
+	VerifyInvalidName
+	// VerifyInvalidDate is a creation or modification date that cannot exist
+	VerifyInvalidDate
+	// VerifyInvalidStorageType is a storage type that is not supported
+	VerifyInvalidStorageType
+)
+
+// VerifyProblem describes one problem found by Verify
+type VerifyProblem struct {
+	Kind    VerifyProblemKind
+	Path    string
+	Block   uint16
+	Message string
+}
+
+// VerifyReport is the result of checking a ProDOS volume
+type VerifyReport struct {
+	TotalBlocks uint16
+	UsedBlocks  uint16
+	Directories int
+	Files       int
+	Problems    []VerifyProblem
+}
+
+// HasProblems returns true if any problems were found
+func (report VerifyReport) HasProblems() bool {
+	return len(report.Problems) > 0
+}
+
+type verifier struct {
+	reader      io.ReaderAt
+	totalBlocks uint16
+	owners      map[uint16]string
+	report      VerifyReport
+}
+
+// Verify checks the consistency of a ProDOS volume without changing it,
+// reporting blocks used by files but marked free, blocks allocated but not
+// used, cross-linked blocks, files with BlocksUsed or EndOfFile that do not
+// match their blocks, directory file counts, broken directory block links
+// and invalid names or dates. An error is only returned if the volume
+// cannot be read at all.
+func Verify(reader io.ReaderAt) (VerifyReport, error) {
+	buffer, err := ReadBlock(reader, 2)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	if buffer[4]>>4 != 0x0F {
+		return VerifyReport{}, errors.New("missing ProDOS volume header")
+	}
+	volumeHeader := parseVolumeHeader(buffer)
+
+	v := &verifier{
+		reader:      reader,
+		totalBlocks: volumeHeader.TotalBlocks,
+		owners:      make(map[uint16]string),
+	}
+	v.report.TotalBlocks = volumeHeader.TotalBlocks
+
+	volumePath := "/" + volumeHeader.VolumeName
+	v.markBlock(0, "boot blocks")
+	v.markBlock(1, "boot blocks")
+	bitmapBlocks := (uint32(volumeHeader.TotalBlocks) + 4095) / 4096
+	for i := uint16(0); i < uint16(bitmapBlocks); i++ {
+		v.markBlock(volumeHeader.BitmapStartBlock+i, "volume bitmap")
+	}
+
+	v.checkName(volumePath, 2, volumeHeader.VolumeName)
+	v.checkDirectory(volumePath, 2, 0, 0)
+
+	volumeBitmap, err := ReadVolumeBitmap(reader)
+	if err != nil {
+		return VerifyReport{}, err
+	}
+	for block := uint16(0); block < volumeHeader.TotalBlocks; block++ {
+		owner, used := v.owners[block]
+		free := checkFreeBlockInVolumeBitmap(volumeBitmap, block)
+		switch {
+		case used && free:
+			v.addProblem(VerifyBlockMarkedFree, owner, block, "block %04X is in use but marked free in the volume bitmap", block)
+		case !used && !free:
+			v.addProblem(VerifyBlockNotReferenced, "", block, "block %04X is allocated in the volume bitmap but not used", block)
+		}
+	}
+	v.report.UsedBlocks = uint16(len(v.owners))
+
+	return v.report, nil
+}
+
+func (v *verifier) addProblem(kind VerifyProblemKind, path string, block uint16, format string, a ...interface{}) {
+	v.report.Problems = append(v.report.Problems, VerifyProblem{
+		Kind:    kind,
+		Path:    path,
+		Block:   block,
+		Message: fmt.Sprintf(format, a...),
+	})
+}
+
+// markBlock records the owner of a block returning false if the block
+// is out of range or already used so it should not be followed
+func (v *verifier) markBlock(block uint16, path string) bool {
+	if block >= v.totalBlocks {
+		v.addProblem(VerifyBlockOutOfRange, path, block, "block %04X is past the end of the volume", block)
+		return false
+	}
+	if owner, used := v.owners[block]; used {
+		v.addProblem(VerifyBlockCrossLinked, path, block, "block %04X is also used by %s", block, owner)
+		return false
+	}
+	v.owners[block] = path
+	return true
+}
+
+func (v *verifier) checkName(path string, block uint16, name string) {
+	if validateFileName(name) != nil {
+		v.addProblem(VerifyInvalidName, path, block, "invalid name %q", name)
+	}
+}
+
+func (v *verifier) checkDate(path string, block uint16, buffer []byte, description string) {
+	if !isValidProDOSDateTime(buffer) {
+		v.addProblem(VerifyInvalidDate, path, block, "invalid %s date % X", description, buffer)
+	}
+}
+
+// checkDirectory follows the blocks of a directory checking the links
+// between them and every entry, then checks the active file count
+func (v *verifier) checkDirectory(path string, keyBlock uint16, parentBlock uint16, parentEntry uint16) uint16 {
+	v.report.Directories++
+	previousBlock := uint16(0)
+	blockCount := uint16(0)
+	activeFileCount := uint16(0)
+	headerFileCount := uint16(0)
+
+	for block := keyBlock; block != 0; {
+		if !v.markBlock(block, path) {
+			break
+		}
+		blockCount++
+		buffer, err := ReadBlock(v.reader, block)
+		if err != nil {
+			v.addProblem(VerifyBlockOutOfRange, path, block, "%s", err)
+			break
+		}
+
+		linkedPreviousBlock := uint16(buffer[0]) + uint16(buffer[1])*256
+		if linkedPreviousBlock != previousBlock {
+			v.addProblem(VerifyDirectoryLink, path, block,
+				"directory block %04X links to previous block %04X instead of %04X", block, linkedPreviousBlock, previousBlock)
+		}
+
+		entryOffset := 4
+		if block == keyBlock {
+			directoryHeader := parseDirectoryHeader(buffer, block)
+			headerFileCount = directoryHeader.ActiveFileCount
+			v.checkDate(path, block, buffer[0x1C:0x20], "creation")
+			// ProDOS numbers entries from one but this package used to
+			// number them from zero so both are accepted
+			if directoryHeader.IsSubDirectory &&
+				(directoryHeader.ParentBlock != parentBlock ||
+					(directoryHeader.ParentEntry != parentEntry && directoryHeader.ParentEntry != parentEntry-1)) {
+				v.addProblem(VerifyDirectoryLink, path, block,
+					"directory header links to parent entry %04X:%d instead of %04X:%d",
+					directoryHeader.ParentBlock, directoryHeader.ParentEntry, parentBlock, parentEntry)
+			}
+			entryOffset += 39
+		}
+
+		for ; entryOffset+39 <= 512; entryOffset += 39 {
+			if buffer[entryOffset]>>4 == StorageDeleted {
+				continue
+			}
+			activeFileCount++
+			entry := buffer[entryOffset : entryOffset+39]
+			fileEntry := parseFileEntry(entry, block, uint16(entryOffset))
+			v.checkFileEntry(path+"/"+fileEntry.FileName, fileEntry, entry, directoryEntryNumber(uint16(entryOffset)))
+		}
+
+		previousBlock = block
+		block = uint16(buffer[2]) + uint16(buffer[3])*256
+	}
+
+	if activeFileCount != headerFileCount {
+		v.addProblem(VerifyFileCountMismatch, path, keyBlock,
+			"directory has %d active files but the header count is %d", activeFileCount, headerFileCount)
+	}
+
+	return blockCount
+}
+
+// checkFileEntry checks the name, dates and blocks of a directory entry
+func (v *verifier) checkFileEntry(path string, fileEntry FileEntry, entry []byte, entryNumber uint16) {
+	block := fileEntry.DirectoryBlock
+	v.checkName(path, block, fileEntry.FileName)
+	v.checkDate(path, block, entry[0x18:0x1C], "creation")
+	v.checkDate(path, block, entry[0x21:0x25], "modification")
+
+	var blocksUsed uint16
+	var endOfFileValid bool
+	switch fileEntry.StorageType {
+	case StorageSeedling, StorageSapling, StorageTree:
+		v.report.Files++
+		blocksUsed, endOfFileValid = v.checkFileBlocks(path, fileEntry.StorageType, fileEntry.KeyPointer, fileEntry.EndOfFile)
+	case StorageExtended:
+		v.report.Files++
+		blocksUsed, endOfFileValid = v.checkExtendedFile(path, fileEntry.KeyPointer)
+	case StorageDirectory:
+		blocksUsed = v.checkDirectory(path, fileEntry.KeyPointer, block, entryNumber)
+		endOfFileValid = fileEntry.EndOfFile == uint32(blocksUsed)*512
+	default:
+		v.addProblem(VerifyInvalidStorageType, path, block, "unsupported storage type %d", fileEntry.StorageType)
+		return
+	}
+
+	if blocksUsed != fileEntry.BlocksUsed {
+		v.addProblem(VerifyBlocksUsedMismatch, path, block,
+			"entry has %d blocks used but the file has %d blocks", fileEntry.BlocksUsed, blocksUsed)
+	}
+	if !endOfFileValid {
+		v.addProblem(VerifyEndOfFileMismatch, path, block,
+			"end of file %d does not match the blocks of the file", fileEntry.EndOfFile)
+	}
+}
+
+// checkExtendedFile checks both forks of an extended file
+func (v *verifier) checkExtendedFile(path string, keyBlock uint16) (uint16, bool) {
+	if !v.markBlock(keyBlock, path) {
+		return 1, true
+	}
+	buffer, err := ReadBlock(v.reader, keyBlock)
+	if err != nil {
+		v.addProblem(VerifyBlockOutOfRange, path, keyBlock, "%s", err)
+		return 1, true
+	}
+
+	blocksUsed := uint16(1)
+	endOfFileValid := true
+	for _, fork := range []struct {
+		name   string
+		offset int
+	}{{"data fork", 0x000}, {"resource fork", 0x100}} {
+		forkEntry := parseForkEntry(buffer[fork.offset:])
+		forkPath := path + " (" + fork.name + ")"
+		if forkEntry.StorageType < StorageSeedling || forkEntry.StorageType > StorageTree {
+			v.addProblem(VerifyInvalidStorageType, forkPath, keyBlock, "unsupported storage type %d", forkEntry.StorageType)
+			continue
+		}
+		forkBlocksUsed, forkEndOfFileValid := v.checkFileBlocks(forkPath, forkEntry.StorageType, forkEntry.KeyPointer, forkEntry.EndOfFile)
+		if forkBlocksUsed != forkEntry.BlocksUsed {
+			v.addProblem(VerifyBlocksUsedMismatch, forkPath, keyBlock,
+				"fork has %d blocks used but has %d blocks", forkEntry.BlocksUsed, forkBlocksUsed)
+		}
+		blocksUsed += forkBlocksUsed
+		endOfFileValid = endOfFileValid && forkEndOfFileValid
+	}
+
+	return blocksUsed, endOfFileValid
+}
+
+// checkFileBlocks marks the index and data blocks of a seedling, sapling
+// or tree returning the number of blocks and whether the end of file is
+// within the data blocks and past the last one that is allocated
+func (v *verifier) checkFileBlocks(path string, storageType uint8, keyBlock uint16, endOfFile uint32) (uint16, bool) {
+	if !v.markBlock(keyBlock, path) {
+		return 1, true
+	}
+	if storageType == StorageSeedling {
+		return 1, endOfFile <= 512
+	}
+
+	blocksUsed := uint16(1)
+	dataBlockCount := uint32(0)
+	indexBlocks := []uint16{keyBlock}
+	indexEntries := 256
+
+	if storageType == StorageTree {
+		masterIndex, err := ReadBlock(v.reader, keyBlock)
+		if err != nil {
+			v.addProblem(VerifyBlockOutOfRange, path, keyBlock, "%s", err)
+			return blocksUsed, true
+		}
+		indexBlocks = make([]uint16, 128)
+		for i := 0; i < 128; i++ {
+			indexBlocks[i] = uint16(masterIndex[i]) + uint16(masterIndex[i+256])*256
+		}
+		indexEntries = 256 * 128
+	}
+
+	for i, indexBlock := range indexBlocks {
+		if indexBlock == 0 {
+			continue
+		}
+		if storageType == StorageTree {
+			if !v.markBlock(indexBlock, path) {
+				continue
+			}
+			blocksUsed++
+		}
+		index, err := ReadBlock(v.reader, indexBlock)
+		if err != nil {
+			v.addProblem(VerifyBlockOutOfRange, path, indexBlock, "%s", err)
+			continue
+		}
+		for j := 0; j < 256; j++ {
+			dataBlock := uint16(index[j]) + uint16(index[j+256])*256
+			if dataBlock == 0 {
+				continue
+			}
+			if v.markBlock(dataBlock, path) {
+				blocksUsed++
+			}
+			dataBlockCount = uint32(i*256+j) + 1
+		}
+	}
+
+	endOfFileValid := endOfFile <= uint32(indexEntries)*512 && endOfFile > (dataBlockCount-1)*512
+	if dataBlockCount == 0 {
+		endOfFileValid = endOfFile <= uint32(indexEntries)*512
+	}
+
+	return blocksUsed, endOfFileValid
+}
+
+// isValidProDOSDateTime returns true if the date and time is empty
+// or has a month, day, hour and minute that can exist
+func isValidProDOSDateTime(buffer []byte) bool {
+	if buffer[0] == 0 && buffer[1] == 0 && buffer[2] == 0 && buffer[3] == 0 {
+		return true
+	}
+
+	month := int(buffer[0]>>5 + (buffer[1]&1)<<3)
+	day := int(buffer[0] & 31)
+
+	return month >= 1 && month <= 12 && day >= 1 && buffer[2] < 60 && buffer[3] < 24
+}
@@ -0,0 +1,115 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for checking the consistency of a volume
+
+package prodos
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func createVerifyVolume() *MemoryFile {
+	volume := NewMemoryFile(0x2000000)
+	CreateVolume(volume, "verify", 2048)
+	CreateDirectory(volume, "/verify/docs")
+	WriteFile(volume, "/verify/small", 0x04, 0, time.Now(), time.Now(), []byte("SMALL"))
+	WriteFile(volume, "/verify/docs/medium", 0x06, 0x2000, time.Now(), time.Now(), bytes.Repeat([]byte{1}, 5000))
+	WriteFile(volume, "/verify/large", 0x06, 0x0000, time.Now(), time.Now(), bytes.Repeat([]byte{2}, 200000))
+	WriteForkedFile(volume, "/verify/forked", 0xB3, 0, time.Now(), time.Now(), []byte{1}, bytes.Repeat([]byte{3}, 1000), nil, WriteFileOptions{})
+	return volume
+}
+
+func TestVerify(t *testing.T) {
+	var tests = []struct {
+		testName string
+		corrupt  func(volume *MemoryFile)
+		wantKind VerifyProblemKind
+	}{
+		{"blockMarkedFree", func(volume *MemoryFile) {
+			fileEntry, _ := GetFileEntry(volume, "/verify/small")
+			volumeBitmap, _ := ReadVolumeBitmap(volume)
+			freeBlockInVolumeBitmap(volumeBitmap, fileEntry.KeyPointer)
+			writeVolumeBitmap(volume, volumeBitmap)
+		}, VerifyBlockMarkedFree},
+		{"blockNotReferenced", func(volume *MemoryFile) {
+			volumeBitmap, _ := ReadVolumeBitmap(volume)
+			markBlockInVolumeBitmap(volumeBitmap, 2000)
+			writeVolumeBitmap(volume, volumeBitmap)
+		}, VerifyBlockNotReferenced},
+		{"crossLinked", func(volume *MemoryFile) {
+			small, _ := GetFileEntry(volume, "/verify/small")
+			medium, _ := GetFileEntry(volume, "/verify/docs/medium")
+			index, _ := ReadBlock(volume, medium.KeyPointer)
+			index[0] = byte(small.KeyPointer)
+			index[256] = byte(small.KeyPointer >> 8)
+			WriteBlock(volume, medium.KeyPointer, index)
+		}, VerifyBlockCrossLinked},
+		{"blocksUsed", func(volume *MemoryFile) {
+			fileEntry, _ := GetFileEntry(volume, "/verify/large")
+			fileEntry.BlocksUsed++
+			writeFileEntry(volume, fileEntry)
+		}, VerifyBlocksUsedMismatch},
+		{"endOfFile", func(volume *MemoryFile) {
+			fileEntry, _ := GetFileEntry(volume, "/verify/docs/medium")
+			fileEntry.EndOfFile = 100
+			writeFileEntry(volume, fileEntry)
+		}, VerifyEndOfFileMismatch},
+		{"fileCount", func(volume *MemoryFile) {
+			_, directoryHeader, _, _ := ReadDirectory(volume, "/verify/docs")
+			directoryHeader.ActiveFileCount = 3
+			writeDirectoryHeader(volume, directoryHeader)
+		}, VerifyFileCountMismatch},
+		{"previousLink", func(volume *MemoryFile) {
+			buffer, _ := ReadBlock(volume, 3)
+			buffer[0] = 0x09
+			WriteBlock(volume, 3, buffer)
+		}, VerifyDirectoryLink},
+		{"invalidName", func(volume *MemoryFile) {
+			fileEntry, _ := GetFileEntry(volume, "/verify/small")
+			fileEntry.FileName = "1SMALL"
+			writeFileEntry(volume, fileEntry)
+		}, VerifyInvalidName},
+		{"invalidDate", func(volume *MemoryFile) {
+			fileEntry, _ := GetFileEntry(volume, "/verify/small")
+			volume.data[int(fileEntry.DirectoryBlock)*512+int(fileEntry.DirectoryOffset)+0x24] = 30
+			volume.data[int(fileEntry.DirectoryBlock)*512+int(fileEntry.DirectoryOffset)+0x23] = 10
+		}, VerifyInvalidDate},
+	}
+
+	t.Run("clean", func(t *testing.T) {
+		report, err := Verify(createVerifyVolume())
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		if report.HasProblems() {
+			t.Errorf("got problems %v", report.Problems)
+		}
+		if report.Files != 4 || report.Directories != 2 {
+			t.Errorf("got %d files %d directories, want 4 files 2 directories", report.Files, report.Directories)
+		}
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			volume := createVerifyVolume()
+			tt.corrupt(volume)
+			report, err := Verify(volume)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			found := false
+			for _, problem := range report.Problems {
+				if problem.Kind == tt.wantKind {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("got problems %v, want kind %d", report.Problems, tt.wantKind)
+			}
+		})
+	}
+}
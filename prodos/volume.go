@@ -0,0 +1,349 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides a volume that caches blocks and directories
+// of a ProDOS drive image in memory until they are synced
+
+package prodos
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// Volume caches the blocks read from a drive image along with parsed
+// directories so the volume header, bitmap and directories are only read
+// once. Writes are kept in memory and written to the drive image by Sync
+// or Close. The drive image must not be changed other than through the
+// Volume while it is open. A Volume can be passed to any function that
+// takes a ReaderWriterAt.
+type Volume struct {
+	readerWriter    ReaderWriterAt
+	blocks          map[uint16][]byte
+	dirtyBlocks     map[uint16]bool
+	directories     map[uint16]cachedDirectory
+	directoryBlocks map[uint16]uint16
+}
+
+type cachedDirectory struct {
+	directoryHeader DirectoryHeader
+	fileEntries     []FileEntry
+	blocks          []uint16
+}
+
+// readOnlyReaderWriter lets a reader be cached by a Volume
+type readOnlyReaderWriter struct {
+	io.ReaderAt
+}
+
+func (readOnlyReaderWriter) WriteAt(data []byte, offset int64) (int, error) {
+	return 0, errors.New("drive image is read only")
+}
+
+// OpenVolume opens a ProDOS volume on a drive image
+func OpenVolume(readerWriter ReaderWriterAt) (*Volume, error) {
+	volume := newVolume(readerWriter)
+	buffer, err := ReadBlock(volume, 2)
+	if err != nil {
+		return nil, err
+	}
+	if buffer[4]>>4 != 0x0F {
+		return nil, errors.New("missing ProDOS volume header")
+	}
+
+	return volume, nil
+}
+
+func newVolume(readerWriter ReaderWriterAt) *Volume {
+	return &Volume{
+		readerWriter:    readerWriter,
+		blocks:          make(map[uint16][]byte),
+		dirtyBlocks:     make(map[uint16]bool),
+		directories:     make(map[uint16]cachedDirectory),
+		directoryBlocks: make(map[uint16]uint16),
+	}
+}
+
+// withVolume runs a function with the drive image opened as a volume,
+// syncing the changes afterwards unless it already is a volume
+func withVolume(readerWriter ReaderWriterAt, fn func(volume *Volume) error) error {
+	if volume, ok := readerWriter.(*Volume); ok {
+		return fn(volume)
+	}
+
+	volume := newVolume(readerWriter)
+	err := fn(volume)
+	// changes made before a failure are written as they would be without the cache
+	syncErr := volume.Sync()
+	if err != nil {
+		return err
+	}
+	return syncErr
+}
+
+// withVolumeReader runs a function with the drive image opened as
+// a volume that cannot be written to unless it already is a volume
+func withVolumeReader(reader io.ReaderAt, fn func(volume *Volume) error) error {
+	readerWriter, ok := reader.(ReaderWriterAt)
+	if !ok {
+		readerWriter = readOnlyReaderWriter{reader}
+	}
+	return withVolume(readerWriter, fn)
+}
+
+// Header returns the volume header
+func (volume *Volume) Header() (VolumeHeader, error) {
+	buffer, err := ReadBlock(volume, 2)
+	if err != nil {
+		return VolumeHeader{}, err
+	}
+	return parseVolumeHeader(buffer), nil
+}
+
+// ReadAt reads data from the cached blocks
+func (volume *Volume) ReadAt(data []byte, offset int64) (int, error) {
+	count := 0
+	for count < len(data) {
+		block, blockOffset, err := volumeBlockAt(offset + int64(count))
+		if err != nil {
+			return count, err
+		}
+		buffer, err := volume.loadBlock(block, false)
+		if err != nil {
+			return count, err
+		}
+		count += copy(data[count:], buffer[blockOffset:])
+	}
+
+	return count, nil
+}
+
+// WriteAt writes data to the cached blocks marking them to be written by Sync
+func (volume *Volume) WriteAt(data []byte, offset int64) (int, error) {
+	count := 0
+	for count < len(data) {
+		block, blockOffset, err := volumeBlockAt(offset + int64(count))
+		if err != nil {
+			return count, err
+		}
+
+		var buffer []byte
+		if blockOffset == 0 && len(data)-count >= 512 {
+			buffer = make([]byte, 512)
+		} else {
+			buffer, err = volume.loadBlock(block, true)
+			if err != nil {
+				return count, err
+			}
+		}
+		count += copy(buffer[blockOffset:], data[count:])
+
+		volume.blocks[block] = buffer
+		volume.dirtyBlocks[block] = true
+		if keyBlock, found := volume.directoryBlocks[block]; found {
+			volume.forgetDirectory(keyBlock)
+		}
+	}
+
+	return count, nil
+}
+
+// Sync writes the changed blocks to the drive image
+func (volume *Volume) Sync() error {
+	blocks := make([]int, 0, len(volume.dirtyBlocks))
+	for block := range volume.dirtyBlocks {
+		blocks = append(blocks, int(block))
+	}
+	sort.Ints(blocks)
+
+	for _, block := range blocks {
+		err := WriteBlock(volume.readerWriter, uint16(block), volume.blocks[uint16(block)])
+		if err != nil {
+			return err
+		}
+		delete(volume.dirtyBlocks, uint16(block))
+	}
+
+	return nil
+}
+
+// Close writes the changed blocks to the drive image, the drive
+// image itself is left open
+func (volume *Volume) Close() error {
+	return volume.Sync()
+}
+
+// GetFileEntry returns a file entry for the given path
+func (volume *Volume) GetFileEntry(path string) (FileEntry, error) {
+	return getFileEntry(volume, path)
+}
+
+// FileExists return true if the file exists
+func (volume *Volume) FileExists(path string) (bool, error) {
+	return fileExists(volume, path)
+}
+
+// ReadDirectory reads the directory information from a specified path
+func (volume *Volume) ReadDirectory(path string) (VolumeHeader, DirectoryHeader, []FileEntry, error) {
+	return readDirectory(volume, path)
+}
+
+// CreateDirectory creates a directory
+func (volume *Volume) CreateDirectory(path string) error {
+	return createDirectory(volume, path)
+}
+
+// LoadFile loads in a file from the volume into a byte array
+func (volume *Volume) LoadFile(path string) ([]byte, error) {
+	return loadFile(volume, path)
+}
+
+// WriteFile writes a file to the volume from a byte array
+func (volume *Volume) WriteFile(path string, fileType uint8, auxType uint16, createdTime time.Time, modifiedTime time.Time, buffer []byte) error {
+	return writeFileWithOptions(volume, path, fileType, auxType, createdTime, modifiedTime, buffer, WriteFileOptions{})
+}
+
+// WriteFileWithOptions writes a file to the volume from a byte array
+// optionally replacing an existing file
+func (volume *Volume) WriteFileWithOptions(
+	path string,
+	fileType uint8,
+	auxType uint16,
+	createdTime time.Time,
+	modifiedTime time.Time,
+	buffer []byte,
+	options WriteFileOptions,
+) error {
+	return writeFileWithOptions(volume, path, fileType, auxType, createdTime, modifiedTime, buffer, options)
+}
+
+// DeleteFile deletes a file from the volume
+func (volume *Volume) DeleteFile(path string) error {
+	return deleteFile(volume, path)
+}
+
+// DeleteDirectory deletes a directory from the volume, when recursive
+// is set all files and subdirectories it contains are deleted as well
+func (volume *Volume) DeleteDirectory(path string, recursive bool) error {
+	return deleteDirectory(volume, path, recursive)
+}
+
+// Rename renames a file or directory on the volume
+func (volume *Volume) Rename(oldPath string, newPath string) error {
+	return rename(volume, oldPath, newPath)
+}
+
+// Move moves a file or directory to another directory on the volume
+func (volume *Volume) Move(oldPath string, newPath string) error {
+	return move(volume, oldPath, newPath)
+}
+
+// LoadFileForks loads the data fork, resource fork and Finder info of a file
+func (volume *Volume) LoadFileForks(path string) ([]byte, []byte, []byte, error) {
+	return loadFileForks(volume, path)
+}
+
+// WriteForkedFile writes an extended file with a data fork, resource fork
+// and optional Finder info to the volume
+func (volume *Volume) WriteForkedFile(
+	path string,
+	fileType uint8,
+	auxType uint16,
+	createdTime time.Time,
+	modifiedTime time.Time,
+	dataFork []byte,
+	resourceFork []byte,
+	finderInfo []byte,
+	options WriteFileOptions,
+) error {
+	return writeForkedFile(volume, path, fileType, auxType, createdTime, modifiedTime, dataFork, resourceFork, finderInfo, options)
+}
+
+// AddFilesFromHostDirectory adds all files from a host directory
+// skipping files that already exist
+func (volume *Volume) AddFilesFromHostDirectory(directory string, path string, recursive bool) error {
+	return addFilesFromHostDirectory(volume, directory, path, recursive, WriteFileOptions{IgnoreDuplicates: true})
+}
+
+// AddFilesFromHostDirectoryWithOptions adds all files from a host directory
+// optionally replacing existing files
+func (volume *Volume) AddFilesFromHostDirectoryWithOptions(directory string, path string, recursive bool, options WriteFileOptions) error {
+	return addFilesFromHostDirectory(volume, directory, path, recursive, options)
+}
+
+// AddFilesFromNuFXArchive writes the records of a NuFX archive to the volume
+func (volume *Volume) AddFilesFromNuFXArchive(records []NuFXRecord, path string, options WriteFileOptions) error {
+	return addFilesFromNuFXArchive(volume, records, path, options)
+}
+
+// ExtractFilesToHostDirectory writes the files in the path of the volume
+// to a host directory
+func (volume *Volume) ExtractFilesToHostDirectory(path string, directory string, options ExtractOptions) error {
+	return extractFilesToHostDirectory(volume, path, directory, options)
+}
+
+// volumeBlockAt returns the block and offset within the block of an offset
+func volumeBlockAt(offset int64) (uint16, int, error) {
+	if offset < 0 || offset >= 65536*512 {
+		errString := fmt.Sprintf("offset %d is beyond a ProDOS volume", offset)
+		return 0, 0, errors.New(errString)
+	}
+	return uint16(offset / 512), int(offset % 512), nil
+}
+
+// loadBlock returns a cached block reading it from the drive image if
+// needed, blocks past the end of the drive image are empty when writing
+func (volume *Volume) loadBlock(block uint16, writing bool) ([]byte, error) {
+	buffer, found := volume.blocks[block]
+	if found {
+		return buffer, nil
+	}
+
+	buffer = make([]byte, 512)
+	_, err := volume.readerWriter.ReadAt(buffer, int64(block)*512)
+	if err != nil && !(writing && err == io.EOF) {
+		return nil, err
+	}
+	volume.blocks[block] = buffer
+
+	return buffer, nil
+}
+
+// cachedDirectoryEntries returns the parsed header and entries of a
+// directory reading them from the blocks the first time
+func (volume *Volume) cachedDirectoryEntries(keyBlock uint16) (DirectoryHeader, []FileEntry, error) {
+	directory, found := volume.directories[keyBlock]
+	if !found {
+		blocks, err := getDirectoryBlocks(volume, keyBlock)
+		if err != nil {
+			return DirectoryHeader{}, nil, err
+		}
+		directoryHeader, fileEntries, err := parseDirectoryBlocks(volume, blocks)
+		if err != nil {
+			return DirectoryHeader{}, nil, err
+		}
+
+		directory = cachedDirectory{directoryHeader: directoryHeader, fileEntries: fileEntries, blocks: blocks}
+		volume.directories[keyBlock] = directory
+		for _, block := range blocks {
+			volume.directoryBlocks[block] = keyBlock
+		}
+	}
+
+	// callers may change the entries they are given
+	fileEntries := make([]FileEntry, len(directory.fileEntries))
+	copy(fileEntries, directory.fileEntries)
+	return directory.directoryHeader, fileEntries, nil
+}
+
+// forgetDirectory removes a directory from the cache when one of its blocks changes
+func (volume *Volume) forgetDirectory(keyBlock uint16) {
+	for _, block := range volume.directories[keyBlock].blocks {
+		delete(volume.directoryBlocks, block)
+	}
+	delete(volume.directories, keyBlock)
+}
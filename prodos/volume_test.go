@@ -0,0 +1,151 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for the volume cache
+
+package prodos
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// countingReaderWriter counts the reads of each block of a drive image
+type countingReaderWriter struct {
+	readerWriter ReaderWriterAt
+	reads        map[int64]int
+}
+
+func (counter *countingReaderWriter) ReadAt(data []byte, offset int64) (int, error) {
+	counter.reads[offset/512]++
+	return counter.readerWriter.ReadAt(data, offset)
+}
+
+func (counter *countingReaderWriter) WriteAt(data []byte, offset int64) (int, error) {
+	return counter.readerWriter.WriteAt(data, offset)
+}
+
+func TestVolume(t *testing.T) {
+	memoryFile := NewMemoryFile(0x2000000)
+	CreateVolume(memoryFile, "cache", 65535)
+	counter := &countingReaderWriter{readerWriter: memoryFile, reads: make(map[int64]int)}
+
+	volume, err := OpenVolume(counter)
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	err = volume.CreateDirectory("/cache/files")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+	for i := 0; i < 200; i++ {
+		err = volume.WriteFile(fmt.Sprintf("/cache/files/file%d", i), 0x06, 0x2000, time.Now(), time.Now(), bytes.Repeat([]byte{byte(i)}, 1000+i))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+	}
+	err = volume.DeleteFile("/cache/files/file10")
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	for block, reads := range counter.reads {
+		if reads > 1 {
+			t.Errorf("got block %04X read %d times, want once", block, reads)
+		}
+	}
+
+	exists, _ := FileExists(memoryFile, "/cache/files/file5")
+	if exists {
+		t.Errorf("got file written before sync")
+	}
+
+	err = volume.Close()
+	if err != nil {
+		t.Fatalf("got error %s", err)
+	}
+
+	for _, tt := range []struct {
+		path       string
+		wantExists bool
+		wantLength int
+	}{
+		{"/cache/files/file5", true, 1005},
+		{"/cache/files/file10", false, 0},
+		{"/cache/files/file199", true, 1199},
+	} {
+		got, err := LoadFile(memoryFile, tt.path)
+		if (err == nil) != tt.wantExists || len(got) != tt.wantLength {
+			t.Errorf("got %s length %d with error %v, want exists %t length %d", tt.path, len(got), err, tt.wantExists, tt.wantLength)
+		}
+	}
+
+	report, _ := Verify(memoryFile)
+	if report.HasProblems() || report.Files != 199 {
+		t.Errorf("got %d files and problems %v, want 199 files", report.Files, report.Problems)
+	}
+}
+
+func TestEntryPointsReadBlocksOnce(t *testing.T) {
+	var tests = []struct {
+		testName string
+		action   func(readerWriter ReaderWriterAt) error
+	}{
+		{"rename", func(readerWriter ReaderWriterAt) error {
+			return Rename(readerWriter, "/cache/files/file150", "renamed")
+		}},
+		{"move", func(readerWriter ReaderWriterAt) error {
+			return Move(readerWriter, "/cache/files/file150", "/cache/")
+		}},
+		{"deleteDirectory", func(readerWriter ReaderWriterAt) error {
+			return DeleteDirectory(readerWriter, "/cache/files", true)
+		}},
+		{"loadFileForks", func(readerWriter ReaderWriterAt) error {
+			_, _, _, err := LoadFileForks(readerWriter, "/cache/files/file150")
+			return err
+		}},
+		{"writeForkedFile", func(readerWriter ReaderWriterAt) error {
+			return WriteForkedFile(readerWriter, "/cache/files/forked", 0x06, 0, time.Now(), time.Now(), []byte{1}, []byte{2}, nil, WriteFileOptions{})
+		}},
+		{"addFilesFromNuFXArchive", func(readerWriter ReaderWriterAt) error {
+			records := []NuFXRecord{{FileName: "FILES/NUFX", FileType: 0x06, Access: 0xE3, DataFork: []byte{1}}}
+			return AddFilesFromNuFXArchive(readerWriter, records, "/cache", WriteFileOptions{})
+		}},
+		{"extractFilesToHostDirectory", func(readerWriter ReaderWriterAt) error {
+			return ExtractFilesToHostDirectory(readerWriter, "/cache", t.TempDir(), ExtractOptions{Recursive: true})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			memoryFile := NewMemoryFile(0x2000000)
+			CreateVolume(memoryFile, "cache", 65535)
+			CreateDirectory(memoryFile, "/cache/files")
+			for i := 0; i < 200; i++ {
+				WriteFile(memoryFile, fmt.Sprintf("/cache/files/file%d", i), 0x06, 0x2000, time.Now(), time.Now(), []byte{byte(i)})
+			}
+			counter := &countingReaderWriter{readerWriter: memoryFile, reads: make(map[int64]int)}
+
+			err := tt.action(counter)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			for block, reads := range counter.reads {
+				if reads > 1 {
+					t.Errorf("got block %04X read %d times, want once", block, reads)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenVolumeNotProDOS(t *testing.T) {
+	_, err := OpenVolume(NewMemoryFile(0x10000))
+	if err == nil {
+		t.Errorf("got no error, want error for missing volume header")
+	}
+}
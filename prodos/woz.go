@@ -0,0 +1,541 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides read-only access to WOZ 1.0 and 2.0 floppy
+// images by decoding the GCR bitstream of each track into blocks
+
+package prodos
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strings"
+)
+
+const (
+	// WozDiskType525 signifies a 5.25" floppy disk
+	WozDiskType525 = 1
+	// WozDiskType35 signifies a 3.5" floppy disk
+	WozDiskType35 = 2
+)
+
+const woz1TrackSize = 6656
+
+// diskBytes are the valid disk nibbles for 6-and-2 encoding
+// used by both 5.25" and 3.5" disks
+var diskBytes = [64]byte{
+	0x96, 0x97, 0x9A, 0x9B, 0x9D, 0x9E, 0x9F, 0xA6,
+	0xA7, 0xAB, 0xAC, 0xAD, 0xAE, 0xAF, 0xB2, 0xB3,
+	0xB4, 0xB5, 0xB6, 0xB7, 0xB9, 0xBA, 0xBB, 0xBC,
+	0xBD, 0xBE, 0xBF, 0xCB, 0xCD, 0xCE, 0xCF, 0xD3,
+	0xD6, 0xD7, 0xD9, 0xDA, 0xDB, 0xDC, 0xDD, 0xDE,
+	0xDF, 0xE5, 0xE6, 0xE7, 0xE9, 0xEA, 0xEB, 0xEC,
+	0xED, 0xEE, 0xEF, 0xF2, 0xF3, 0xF4, 0xF5, 0xF6,
+	0xF7, 0xF9, 0xFA, 0xFB, 0xFC, 0xFD, 0xFE, 0xFF,
+}
+
+var diskBytesInverse = invertDiskBytes()
+
+// each ProDOS block on a 5.25" track is made up of two physical sectors
+var prodosPhysicalSectors = [16]int{0, 2, 4, 6, 8, 10, 12, 14, 1, 3, 5, 7, 9, 11, 13, 15}
+
+// Woz is a read-only WOZ 1.0 or 2.0 floppy image that decodes ProDOS
+// blocks from the track bitstreams so it can be used with all functions
+// in this package that read from a drive image
+type Woz struct {
+	Version        int
+	DiskType       uint8
+	WriteProtected bool
+	Creator        string
+	Sides          int
+	Blocks         int
+
+	data          []byte
+	trackMap      []byte
+	tracks        []wozTrack
+	decodedTracks map[int]map[int][]byte
+}
+
+type wozTrack struct {
+	offset   int
+	bitCount int
+}
+
+// IsWoz returns true if the image starts with a WOZ 1.0 or 2.0 header
+func IsWoz(reader io.ReaderAt) bool {
+	magic := make([]byte, 4)
+	_, err := reader.ReadAt(magic, 0)
+	return err == nil && (string(magic) == "WOZ1" || string(magic) == "WOZ2")
+}
+
+// OpenWoz reads a WOZ image of the specified size in bytes, validates
+// its CRC32 and parses the INFO, TMAP and TRKS chunks
+func OpenWoz(reader io.ReaderAt, size int64) (*Woz, error) {
+	if size < 12 {
+		return nil, errors.New("missing WOZ header")
+	}
+
+	data := make([]byte, size)
+	_, err := reader.ReadAt(data, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to read WOZ image: %w", err)
+	}
+
+	woz := &Woz{data: data, decodedTracks: make(map[int]map[int][]byte)}
+	switch string(data[0:4]) {
+	case "WOZ1":
+		woz.Version = 1
+	case "WOZ2":
+		woz.Version = 2
+	default:
+		return nil, errors.New("missing WOZ header")
+	}
+
+	if data[4] != 0xFF || data[5] != 0x0A || data[6] != 0x0D || data[7] != 0x0A {
+		return nil, errors.New("invalid WOZ header, the image may have been altered by a text conversion")
+	}
+
+	crc := binary.LittleEndian.Uint32(data[8:])
+	if crc != 0 && crc != crc32.ChecksumIEEE(data[12:]) {
+		return nil, errors.New("WOZ CRC32 mismatch, the image is corrupt")
+	}
+
+	var info []byte
+	for offset := 12; offset+8 <= len(data); {
+		chunkID := string(data[offset : offset+4])
+		chunkSize := int(binary.LittleEndian.Uint32(data[offset+4:]))
+		chunkStart := offset + 8
+		if chunkSize < 0 || chunkStart+chunkSize > len(data) {
+			errString := fmt.Sprintf("truncated WOZ chunk %s", chunkID)
+			return nil, errors.New(errString)
+		}
+
+		switch chunkID {
+		case "INFO":
+			info = data[chunkStart : chunkStart+chunkSize]
+		case "TMAP":
+			woz.trackMap = data[chunkStart : chunkStart+chunkSize]
+		case "TRKS":
+			err = woz.parseTracks(chunkStart, chunkSize)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		offset = chunkStart + chunkSize
+	}
+
+	if len(info) < 37 || len(woz.trackMap) < 160 || woz.tracks == nil {
+		return nil, errors.New("WOZ image is missing INFO, TMAP or TRKS chunk")
+	}
+
+	woz.DiskType = info[1]
+	woz.WriteProtected = info[2] == 1
+	woz.Creator = strings.TrimRight(string(info[5:37]), " \x00")
+
+	switch woz.DiskType {
+	case WozDiskType525:
+		woz.Sides = 1
+		woz.Blocks = 280
+	case WozDiskType35:
+		woz.Sides = woz.getSides35(info)
+		woz.Blocks = 800 * woz.Sides
+	default:
+		errString := fmt.Sprintf("unsupported WOZ disk type %d", woz.DiskType)
+		return nil, errors.New(errString)
+	}
+
+	return woz, nil
+}
+
+// ReadAt reads data from the specified offset as if the image were
+// a ProDOS ordered drive image
+func (woz *Woz) ReadAt(data []byte, offset int64) (int, error) {
+	if offset < 0 || offset+int64(len(data)) > int64(woz.Blocks)*512 {
+		return 0, errors.New("read beyond end of WOZ image")
+	}
+
+	total := 0
+	for total < len(data) {
+		position := offset + int64(total)
+		buffer, err := woz.readBlock(int(position / 512))
+		if err != nil {
+			return total, err
+		}
+		total += copy(data[total:], buffer[position%512:])
+	}
+
+	return total, nil
+}
+
+// WriteAt always fails as WOZ images are read-only
+func (woz *Woz) WriteAt(data []byte, offset int64) (int, error) {
+	return 0, errors.New("WOZ images are read-only")
+}
+
+func (woz *Woz) parseTracks(chunkStart int, chunkSize int) error {
+	if woz.Version == 1 {
+		for offset := chunkStart; offset+woz1TrackSize <= chunkStart+chunkSize; offset += woz1TrackSize {
+			bitCount := int(binary.LittleEndian.Uint16(woz.data[offset+6648:]))
+			if bitCount > 6646*8 {
+				return errors.New("invalid WOZ track bit count")
+			}
+			woz.tracks = append(woz.tracks, wozTrack{offset: offset, bitCount: bitCount})
+		}
+		return nil
+	}
+
+	if chunkSize < 160*8 {
+		return errors.New("truncated WOZ track list")
+	}
+
+	woz.tracks = make([]wozTrack, 160)
+	for i := 0; i < 160; i++ {
+		entry := woz.data[chunkStart+i*8:]
+		startingBlock := int(binary.LittleEndian.Uint16(entry[0:]))
+		bitCount := int(binary.LittleEndian.Uint32(entry[4:]))
+		if startingBlock == 0 {
+			continue
+		}
+		if startingBlock*512+(bitCount+7)/8 > len(woz.data) {
+			return errors.New("invalid WOZ track bit count")
+		}
+		woz.tracks[i] = wozTrack{offset: startingBlock * 512, bitCount: bitCount}
+	}
+
+	return nil
+}
+
+// getSides35 returns the number of sides from WOZ 2.0 INFO or
+// by checking the track map for side 1 tracks
+func (woz *Woz) getSides35(info []byte) int {
+	if info[0] >= 2 && len(info) > 37 && info[37] == 2 {
+		return 2
+	}
+	if info[0] >= 2 && len(info) > 37 && info[37] == 1 {
+		return 1
+	}
+
+	for i := 1; i < 160; i += 2 {
+		if woz.trackMap[i] != 0xFF {
+			return 2
+		}
+	}
+	return 1
+}
+
+func (woz *Woz) readBlock(block int) ([]byte, error) {
+	if woz.DiskType == WozDiskType525 {
+		track := block / 8
+		first, err := woz.readSector(track, 0, prodosPhysicalSectors[(block%8)*2])
+		if err != nil {
+			return nil, err
+		}
+		second, err := woz.readSector(track, 0, prodosPhysicalSectors[(block%8)*2+1])
+		if err != nil {
+			return nil, err
+		}
+		return append(append([]byte{}, first...), second...), nil
+	}
+
+	for track := 0; track < 80; track++ {
+		sectors := getSectorsPerTrack35(track)
+		for side := 0; side < woz.Sides; side++ {
+			if block < sectors {
+				return woz.readSector(track, side, block)
+			}
+			block -= sectors
+		}
+	}
+
+	return nil, errors.New("read beyond end of WOZ image")
+}
+
+// readSector returns a sector decoding and caching the whole track
+// the first time it is accessed
+func (woz *Woz) readSector(track int, side int, sector int) ([]byte, error) {
+	key := track*2 + side
+	sectors, ok := woz.decodedTracks[key]
+	if !ok {
+		sectors = woz.decodeTrack(track, side)
+		woz.decodedTracks[key] = sectors
+	}
+
+	buffer, ok := sectors[sector]
+	if !ok {
+		errString := fmt.Sprintf("unable to decode track %d side %d sector %d, the disk may be copy protected", track, side, sector)
+		return nil, errors.New(errString)
+	}
+
+	return buffer, nil
+}
+
+func (woz *Woz) decodeTrack(track int, side int) map[int][]byte {
+	trackMapIndex := track * 4
+	if woz.DiskType == WozDiskType35 {
+		trackMapIndex = track*2 + side
+	}
+
+	trackIndex := int(woz.trackMap[trackMapIndex])
+	if trackIndex >= len(woz.tracks) || woz.tracks[trackIndex].bitCount == 0 {
+		return map[int][]byte{}
+	}
+
+	nibbles := woz.readNibbles(woz.tracks[trackIndex])
+	if woz.DiskType == WozDiskType35 {
+		return decodeTrack35(nibbles, track, side)
+	}
+	return decodeTrack525(nibbles, track)
+}
+
+// readNibbles reads the bitstream of a track as nibbles going around
+// twice so sectors that wrap past the end of the track are complete
+func (woz *Woz) readNibbles(track wozTrack) []byte {
+	nibbles := make([]byte, 0, track.bitCount/4)
+	nibble := byte(0)
+
+	for i := 0; i < track.bitCount*2; i++ {
+		bitIndex := i % track.bitCount
+		bit := (woz.data[track.offset+bitIndex/8] >> (7 - bitIndex%8)) & 1
+		nibble = nibble<<1 | bit
+		if nibble&0x80 != 0 {
+			nibbles = append(nibbles, nibble)
+			nibble = 0
+		}
+	}
+
+	return nibbles
+}
+
+// decodeTrack525 finds and decodes all 16 sector 6-and-2 encoded
+// sectors in the nibbles of a 5.25" track
+func decodeTrack525(nibbles []byte, track int) map[int][]byte {
+	sectors := make(map[int][]byte)
+
+	for i := 0; i+11 <= len(nibbles); i++ {
+		if nibbles[i] != 0xD5 || nibbles[i+1] != 0xAA || nibbles[i+2] != 0x96 {
+			continue
+		}
+
+		volume := decode44(nibbles[i+3], nibbles[i+4])
+		addressTrack := decode44(nibbles[i+5], nibbles[i+6])
+		sector := int(decode44(nibbles[i+7], nibbles[i+8]))
+		checksum := decode44(nibbles[i+9], nibbles[i+10])
+		if volume^addressTrack^byte(sector) != checksum || int(addressTrack) != track || sector > 15 {
+			continue
+		}
+		if _, found := sectors[sector]; found {
+			continue
+		}
+
+		dataStart := findDataPrologue(nibbles, i+11)
+		if dataStart < 0 || dataStart+343 > len(nibbles) {
+			continue
+		}
+
+		buffer, ok := decodeNibbles62(nibbles[dataStart : dataStart+343])
+		if ok {
+			sectors[sector] = buffer
+		}
+	}
+
+	return sectors
+}
+
+// decodeTrack35 finds and decodes all sectors in the nibbles
+// of a 3.5" track
+func decodeTrack35(nibbles []byte, track int, side int) map[int][]byte {
+	sectors := make(map[int][]byte)
+	sectorsPerTrack := getSectorsPerTrack35(track)
+
+	for i := 0; i+8 <= len(nibbles); i++ {
+		if nibbles[i] != 0xD5 || nibbles[i+1] != 0xAA || nibbles[i+2] != 0x96 {
+			continue
+		}
+
+		address, ok := translateNibbles(nibbles[i+3 : i+8])
+		if !ok || address[0]^address[1]^address[2]^address[3] != address[4] {
+			continue
+		}
+		addressTrack := int(address[0]) | int(address[2]&0x1F)<<6
+		addressSide := int(address[2]>>5) & 1
+		sector := int(address[1])
+		if addressTrack != track || addressSide != side || sector >= sectorsPerTrack {
+			continue
+		}
+		if _, found := sectors[sector]; found {
+			continue
+		}
+
+		dataStart := findDataPrologue(nibbles, i+8)
+		if dataStart < 0 || dataStart+704 > len(nibbles) {
+			continue
+		}
+
+		values, ok := translateNibbles(nibbles[dataStart : dataStart+704])
+		if !ok || int(values[0]) != sector {
+			continue
+		}
+
+		buffer, ok := decodeNibbles35(values[1:])
+		if ok {
+			// the first 12 bytes are tags not used by ProDOS
+			sectors[sector] = buffer[12:]
+		}
+	}
+
+	return sectors
+}
+
+// findDataPrologue returns the index after the D5 AA AD data prologue
+// following an address field or -1 if another address field is found first
+func findDataPrologue(nibbles []byte, start int) int {
+	for i := start; i+3 <= len(nibbles) && i < start+64; i++ {
+		if nibbles[i] != 0xD5 || nibbles[i+1] != 0xAA {
+			continue
+		}
+		if nibbles[i+2] == 0xAD {
+			return i + 3
+		}
+		if nibbles[i+2] == 0x96 {
+			return -1
+		}
+	}
+
+	return -1
+}
+
+func decode44(first byte, second byte) byte {
+	return (first<<1 | 1) & second
+}
+
+// decodeNibbles62 decodes 343 nibbles of a 6-and-2 encoded data field
+// into 256 bytes returning false if the checksum does not match
+func decodeNibbles62(nibbles []byte) ([]byte, bool) {
+	values, ok := translateNibbles(nibbles)
+	if !ok {
+		return nil, false
+	}
+
+	previous := byte(0)
+	for i := 0; i < len(values); i++ {
+		previous ^= values[i]
+		values[i] = previous
+	}
+	if previous != 0 {
+		return nil, false
+	}
+
+	buffer := make([]byte, 256)
+	for i := 0; i < 256; i++ {
+		twoBits := values[i%86] >> ((i / 86) * 2)
+		buffer[i] = values[86+i]<<2 | (twoBits&0x01)<<1 | (twoBits&0x02)>>1
+	}
+
+	return buffer, true
+}
+
+// decodeNibbles35 decodes 703 six bit values of a 3.5" data field into
+// 524 bytes of tags and data returning false if the checksum does not match
+func decodeNibbles35(values []byte) ([]byte, bool) {
+	const groups = 175
+	var b1, b2, b3 [groups]byte
+	var w3 byte
+
+	index := 0
+	for i := 0; i < groups; i++ {
+		w4 := values[index]
+		w1 := values[index+1]
+		w2 := values[index+2]
+		index += 3
+		if i != groups-1 {
+			w3 = values[index]
+			index++
+		}
+		b1[i] = w1&0x3F | (w4<<2)&0xC0
+		b2[i] = w2&0x3F | (w4<<4)&0xC0
+		b3[i] = w3&0x3F | (w4<<6)&0xC0
+	}
+
+	buffer := make([]byte, 0, 524)
+	var c1, c2, c3 uint32
+	for j := 0; ; j++ {
+		c1 = (c1 & 0xFF) << 1
+		if c1&0x100 != 0 {
+			c1++
+		}
+
+		value := b1[j] ^ byte(c1)
+		c3 += uint32(value)
+		if c1&0x100 != 0 {
+			c3++
+			c1 &= 0xFF
+		}
+		buffer = append(buffer, value)
+
+		value = b2[j] ^ byte(c3)
+		c2 += uint32(value)
+		if c3 > 0xFF {
+			c2++
+			c3 &= 0xFF
+		}
+		buffer = append(buffer, value)
+
+		if len(buffer) == 524 {
+			break
+		}
+
+		value = b3[j] ^ byte(c2)
+		c1 += uint32(value)
+		if c2 > 0xFF {
+			c1++
+			c2 &= 0xFF
+		}
+		buffer = append(buffer, value)
+	}
+
+	c4 := (c1&0xC0)>>6 | (c2&0xC0)>>4 | (c3&0xC0)>>2
+	checksum := values[index : index+4]
+	if uint32(checksum[0]) != c4&0x3F || uint32(checksum[1]) != c3&0x3F ||
+		uint32(checksum[2]) != c2&0x3F || uint32(checksum[3]) != c1&0x3F {
+		return nil, false
+	}
+
+	return buffer, true
+}
+
+// translateNibbles converts disk nibbles to six bit values returning
+// false if any nibble is not a valid disk byte
+func translateNibbles(nibbles []byte) ([]byte, bool) {
+	values := make([]byte, len(nibbles))
+	for i := 0; i < len(nibbles); i++ {
+		values[i] = diskBytesInverse[nibbles[i]]
+		if values[i] == 0xFF {
+			return nil, false
+		}
+	}
+
+	return values, true
+}
+
+func invertDiskBytes() [256]byte {
+	var inverse [256]byte
+	for i := 0; i < 256; i++ {
+		inverse[i] = 0xFF
+	}
+	for i := 0; i < len(diskBytes); i++ {
+		inverse[diskBytes[i]] = byte(i)
+	}
+
+	return inverse
+}
+
+// getSectorsPerTrack35 returns the number of sectors in a track
+// of a 3.5" disk which has five speed zones of 16 tracks
+func getSectorsPerTrack35(track int) int {
+	return 12 - track/16
+}
@@ -0,0 +1,369 @@
+// Copyright Terence J. Boldt (c)2026
+// Use of this source code is governed by an MIT
+// license that can be found in the LICENSE file.
+
+// This file provides tests for reading WOZ floppy images
+
+package prodos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadWoz(t *testing.T) {
+	var tests = []struct {
+		testName string
+		version  int
+		diskType uint8
+		blocks   uint16
+	}{
+		{"woz1Floppy525", 1, WozDiskType525, 280},
+		{"woz2Floppy525", 2, WozDiskType525, 280},
+		{"woz2Floppy35", 2, WozDiskType35, 1600},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.testName, func(t *testing.T) {
+			image := NewMemoryFile(int(tt.blocks) * 512)
+			CreateVolume(image, "woz", tt.blocks)
+			want := make([]byte, 20000)
+			for i := 0; i < len(want); i++ {
+				want[i] = byte(i * 7)
+			}
+			err := WriteFile(image, "/woz/test", 0x06, 0x2000, time.Now(), time.Now(), want)
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+
+			wozData := encodeTestWoz(image.data, tt.version, tt.diskType)
+			woz, err := OpenWoz(bytes.NewReader(wozData), int64(len(wozData)))
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if woz.Blocks != int(tt.blocks) {
+				t.Errorf("got %d blocks, want %d", woz.Blocks, tt.blocks)
+			}
+
+			for block := 0; block < int(tt.blocks); block++ {
+				got, err := ReadBlock(woz, uint16(block))
+				if err != nil {
+					t.Fatalf("got error %s", err)
+				}
+				if !bytes.Equal(got, image.data[block*512:block*512+512]) {
+					t.Fatalf("block %d does not match", block)
+				}
+			}
+
+			got, err := LoadFile(woz, "/woz/test")
+			if err != nil {
+				t.Fatalf("got error %s", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("file read from WOZ image does not match")
+			}
+
+			err = WriteFile(woz, "/woz/new", 0x06, 0x2000, time.Now(), time.Now(), want)
+			if err == nil {
+				t.Errorf("got no error writing to WOZ image")
+			}
+		})
+	}
+}
+
+func TestReadWozErrors(t *testing.T) {
+	image := NewMemoryFile(280 * 512)
+	CreateVolume(image, "woz", 280)
+	wozData := encodeTestWoz(image.data, 2, WozDiskType525)
+
+	t.Run("crc", func(t *testing.T) {
+		corrupt := append([]byte{}, wozData...)
+		corrupt[len(corrupt)-1] ^= 0xFF
+		_, err := OpenWoz(bytes.NewReader(corrupt), int64(len(corrupt)))
+		if err == nil || !strings.Contains(err.Error(), "CRC32") {
+			t.Errorf("got error %v, want CRC32 mismatch", err)
+		}
+	})
+
+	t.Run("header", func(t *testing.T) {
+		corrupt := append([]byte{}, wozData...)
+		corrupt[5] = 0x0D
+		_, err := OpenWoz(bytes.NewReader(corrupt), int64(len(corrupt)))
+		if err == nil {
+			t.Errorf("got no error for altered header")
+		}
+	})
+
+	t.Run("copyProtectedTrack", func(t *testing.T) {
+		// wipe the bitstream of track 1 so none of its sectors decode
+		corrupt := append([]byte{}, wozData...)
+		trackEntry := 256 + 1*8
+		startingBlock := int(binary.LittleEndian.Uint16(corrupt[trackEntry:]))
+		blockCount := int(binary.LittleEndian.Uint16(corrupt[trackEntry+2:]))
+		for i := startingBlock * 512; i < (startingBlock+blockCount)*512; i++ {
+			corrupt[i] = 0xAA
+		}
+		binary.LittleEndian.PutUint32(corrupt[8:], crc32.ChecksumIEEE(corrupt[12:]))
+
+		woz, err := OpenWoz(bytes.NewReader(corrupt), int64(len(corrupt)))
+		if err != nil {
+			t.Fatalf("got error %s", err)
+		}
+		_, err = ReadBlock(woz, 2)
+		if err != nil {
+			t.Errorf("got error %s reading track 0", err)
+		}
+		_, err = ReadBlock(woz, 8)
+		if err == nil || !strings.Contains(err.Error(), "copy protected") {
+			t.Errorf("got error %v, want undecodable track error", err)
+		}
+	})
+}
+
+// encodeTestWoz encodes a ProDOS ordered image as a WOZ image
+func encodeTestWoz(image []byte, version int, diskType uint8) []byte {
+	var tracks []*testBitstream
+	trackMap := make([]byte, 160)
+	for i := 0; i < len(trackMap); i++ {
+		trackMap[i] = 0xFF
+	}
+
+	if diskType == WozDiskType525 {
+		for track := 0; track < 35; track++ {
+			trackMap[track*4] = byte(len(tracks))
+			tracks = append(tracks, encodeTestTrack525(image, track))
+		}
+	} else {
+		block := 0
+		for track := 0; track < 80; track++ {
+			for side := 0; side < 2; side++ {
+				trackMap[track*2+side] = byte(len(tracks))
+				sectors := getSectorsPerTrack35(track)
+				tracks = append(tracks, encodeTestTrack35(image[block*512:(block+sectors)*512], track, side))
+				block += sectors
+			}
+		}
+	}
+
+	info := make([]byte, 60)
+	info[0] = byte(version)
+	info[1] = diskType
+	copy(info[5:37], "ProDOS-Utilities test")
+	if version == 2 {
+		info[37] = byte(diskType)
+	}
+
+	woz := []byte("WOZ1\xFF\x0A\x0D\x0A\x00\x00\x00\x00")
+	if version == 2 {
+		woz[3] = '2'
+	}
+	woz = appendTestChunk(woz, "INFO", info)
+	woz = appendTestChunk(woz, "TMAP", trackMap)
+
+	var trks []byte
+	if version == 1 {
+		for _, bits := range tracks {
+			track := make([]byte, woz1TrackSize)
+			copy(track, bits.bytes())
+			binary.LittleEndian.PutUint16(track[6646:], uint16(len(bits.bytes())))
+			binary.LittleEndian.PutUint16(track[6648:], uint16(bits.bitCount))
+			trks = append(trks, track...)
+		}
+	} else {
+		trks = make([]byte, 160*8)
+		block := 3
+		var trackData []byte
+		for i, bits := range tracks {
+			blockCount := (len(bits.bytes()) + 511) / 512
+			binary.LittleEndian.PutUint16(trks[i*8:], uint16(block))
+			binary.LittleEndian.PutUint16(trks[i*8+2:], uint16(blockCount))
+			binary.LittleEndian.PutUint32(trks[i*8+4:], uint32(bits.bitCount))
+			padded := make([]byte, blockCount*512)
+			copy(padded, bits.bytes())
+			trackData = append(trackData, padded...)
+			block += blockCount
+		}
+		trks = append(trks, trackData...)
+	}
+	woz = appendTestChunk(woz, "TRKS", trks)
+
+	binary.LittleEndian.PutUint32(woz[8:], crc32.ChecksumIEEE(woz[12:]))
+	return woz
+}
+
+func appendTestChunk(woz []byte, chunkID string, data []byte) []byte {
+	header := make([]byte, 8)
+	copy(header, chunkID)
+	binary.LittleEndian.PutUint32(header[4:], uint32(len(data)))
+	return append(append(woz, header...), data...)
+}
+
+type testBitstream struct {
+	data     []byte
+	bitCount int
+}
+
+func (bits *testBitstream) bytes() []byte {
+	return bits.data
+}
+
+func (bits *testBitstream) writeBit(bit byte) {
+	if bits.bitCount%8 == 0 {
+		bits.data = append(bits.data, 0)
+	}
+	bits.data[bits.bitCount/8] |= bit << (7 - bits.bitCount%8)
+	bits.bitCount++
+}
+
+func (bits *testBitstream) writeNibbles(nibbles ...byte) {
+	for _, nibble := range nibbles {
+		for i := 7; i >= 0; i-- {
+			bits.writeBit((nibble >> i) & 1)
+		}
+	}
+}
+
+// writeSync writes self-sync nibbles which are FF followed by two zero bits
+func (bits *testBitstream) writeSync(count int) {
+	for i := 0; i < count; i++ {
+		bits.writeNibbles(0xFF)
+		bits.writeBit(0)
+		bits.writeBit(0)
+	}
+}
+
+func (bits *testBitstream) writeValues(values ...byte) {
+	for _, value := range values {
+		bits.writeNibbles(diskBytes[value])
+	}
+}
+
+func encodeTestTrack525(image []byte, track int) *testBitstream {
+	bits := &testBitstream{}
+	for sector := 0; sector < 16; sector++ {
+		var offset int
+		for i := 0; i < 16; i++ {
+			if prodosPhysicalSectors[i] == sector {
+				offset = (track*8+i/2)*512 + (i%2)*256
+			}
+		}
+
+		bits.writeSync(16)
+		bits.writeNibbles(0xD5, 0xAA, 0x96)
+		for _, value := range []byte{254, byte(track), byte(sector), 254 ^ byte(track) ^ byte(sector)} {
+			bits.writeNibbles(value>>1|0xAA, value|0xAA)
+		}
+		bits.writeNibbles(0xDE, 0xAA, 0xEB)
+		bits.writeSync(6)
+		bits.writeNibbles(0xD5, 0xAA, 0xAD)
+		bits.writeValues(encodeTestNibbles62(image[offset : offset+256])...)
+		bits.writeNibbles(0xDE, 0xAA, 0xEB)
+	}
+	bits.writeSync(32)
+
+	return bits
+}
+
+func encodeTestNibbles62(buffer []byte) []byte {
+	values := make([]byte, 342)
+	for i := 0; i < 256; i++ {
+		values[86+i] = buffer[i] >> 2
+		twoBits := (buffer[i]&0x01)<<1 | (buffer[i]&0x02)>>1
+		values[i%86] |= twoBits << ((i / 86) * 2)
+	}
+
+	encoded := make([]byte, 343)
+	previous := byte(0)
+	for i := 0; i < 342; i++ {
+		encoded[i] = values[i] ^ previous
+		previous = values[i]
+	}
+	encoded[342] = previous
+
+	return encoded
+}
+
+func encodeTestTrack35(image []byte, track int, side int) *testBitstream {
+	bits := &testBitstream{}
+	for sector := 0; sector < len(image)/512; sector++ {
+		sideValue := byte(side<<5 | track>>6)
+		address := []byte{byte(track & 0x3F), byte(sector), sideValue, 0x22}
+		address = append(address, address[0]^address[1]^address[2]^address[3])
+
+		bits.writeSync(16)
+		bits.writeNibbles(0xD5, 0xAA, 0x96)
+		bits.writeValues(address...)
+		bits.writeNibbles(0xDE, 0xAA)
+		bits.writeSync(6)
+		bits.writeNibbles(0xD5, 0xAA, 0xAD)
+		bits.writeValues(byte(sector))
+		buffer := make([]byte, 524)
+		copy(buffer[12:], image[sector*512:sector*512+512])
+		bits.writeValues(encodeTestNibbles35(buffer)...)
+		bits.writeNibbles(0xDE, 0xAA)
+	}
+	bits.writeSync(32)
+
+	return bits
+}
+
+func encodeTestNibbles35(buffer []byte) []byte {
+	const groups = 175
+	var b1, b2, b3 [groups]byte
+	var c1, c2, c3 uint32
+
+	index := 0
+	for j := 0; ; j++ {
+		c1 = (c1 & 0xFF) << 1
+		if c1&0x100 != 0 {
+			c1++
+		}
+
+		value := buffer[index]
+		index++
+		b1[j] = value ^ byte(c1)
+		c3 += uint32(value)
+		if c1&0x100 != 0 {
+			c3++
+			c1 &= 0xFF
+		}
+
+		value = buffer[index]
+		index++
+		b2[j] = value ^ byte(c3)
+		c2 += uint32(value)
+		if c3 > 0xFF {
+			c2++
+			c3 &= 0xFF
+		}
+
+		if index == 524 {
+			break
+		}
+
+		value = buffer[index]
+		index++
+		b3[j] = value ^ byte(c2)
+		c1 += uint32(value)
+		if c2 > 0xFF {
+			c1++
+			c2 &= 0xFF
+		}
+	}
+
+	var values []byte
+	for i := 0; i < groups; i++ {
+		w4 := (b1[i]&0xC0)>>2 | (b2[i]&0xC0)>>4 | (b3[i]&0xC0)>>6
+		values = append(values, w4, b1[i]&0x3F, b2[i]&0x3F)
+		if i != groups-1 {
+			values = append(values, b3[i]&0x3F)
+		}
+	}
+
+	c4 := (c1&0xC0)>>6 | (c2&0xC0)>>4 | (c3&0xC0)>>2
+	return append(values, byte(c4&0x3F), byte(c3&0x3F), byte(c2&0x3F), byte(c1&0x3F))
+}